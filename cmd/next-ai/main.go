@@ -56,6 +56,7 @@ func main() {
 	if err != nil {
 		log.Fatalf("Failed to init services: %v", err)
 	}
+	defer services.MCP.Close()
 	handlers := handler.NewHandlers(services)
 
 	// 初始化路由
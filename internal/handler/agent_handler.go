@@ -1,6 +1,11 @@
 package handler
 
 import (
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/ashwinyue/next-ai/internal/middleware"
 	"github.com/ashwinyue/next-ai/internal/service"
 	agentService "github.com/ashwinyue/next-ai/internal/service/agent"
 	"github.com/gin-gonic/gin"
@@ -116,6 +121,149 @@ func (h *AgentHandler) CopyAgent(c *gin.Context) {
 	Created(c, copiedAgent)
 }
 
+// ListAgentVersions 列出Agent版本
+func (h *AgentHandler) ListAgentVersions(c *gin.Context) {
+	id := c.Param("id")
+
+	versions, err := h.svc.Agent.ListVersions(c.Request.Context(), id)
+	if err != nil {
+		Error(c, err)
+		return
+	}
+
+	Success(c, versions)
+}
+
+// DiffAgentVersions 比较Agent的两个版本
+// GET /api/v1/agents/:id/versions/diff?from=1&to=2（to 缺省为最新版本）
+func (h *AgentHandler) DiffAgentVersions(c *gin.Context) {
+	id := c.Param("id")
+	from := parseInt(c.Query("from"), 0)
+	if from == 0 {
+		BadRequest(c, "from version is required")
+		return
+	}
+	to := parseInt(c.Query("to"), 0)
+
+	diff, err := h.svc.Agent.DiffVersions(c.Request.Context(), id, from, to)
+	if err != nil {
+		Error(c, err)
+		return
+	}
+
+	Success(c, diff)
+}
+
+// PublishAgentVersion 发布Agent版本
+func (h *AgentHandler) PublishAgentVersion(c *gin.Context) {
+	id := c.Param("id")
+	version := parseInt(c.Param("version"), 0)
+	if version == 0 {
+		BadRequest(c, "invalid version")
+		return
+	}
+
+	agent, err := h.svc.Agent.PublishVersion(c.Request.Context(), id, version)
+	if err != nil {
+		Error(c, err)
+		return
+	}
+
+	Success(c, agent)
+}
+
+// RollbackAgent 回滚Agent到指定版本
+func (h *AgentHandler) RollbackAgent(c *gin.Context) {
+	id := c.Param("id")
+	var req agentService.RollbackRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		BadRequest(c, err.Error())
+		return
+	}
+
+	version, err := h.svc.Agent.Rollback(c.Request.Context(), id, &req)
+	if err != nil {
+		Error(c, err)
+		return
+	}
+
+	Created(c, version)
+}
+
+// ExportAgent 导出Agent配置包
+// GET /api/v1/agents/:id/export?format=yaml&version=2（format 缺省为 json，version 缺省为已发布版本）
+func (h *AgentHandler) ExportAgent(c *gin.Context) {
+	id := c.Param("id")
+	format := c.DefaultQuery("format", "json")
+	if format != "json" && format != "yaml" {
+		BadRequest(c, "format must be json or yaml")
+		return
+	}
+
+	bundle, err := h.svc.Agent.ExportAgent(c.Request.Context(), id, parseInt(c.Query("version"), 0), middleware.GetTenantID(c))
+	if err != nil {
+		Error(c, err)
+		return
+	}
+	data, err := agentService.MarshalBundle(bundle, format)
+	if err != nil {
+		Error(c, err)
+		return
+	}
+
+	contentType := "application/json"
+	if format == "yaml" {
+		contentType = "application/yaml"
+	}
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", bundle.Agent.Name+".agent."+format))
+	c.Data(http.StatusOK, contentType, data)
+}
+
+// ImportAgent 导入Agent配置包
+// POST /api/v1/agents/import?name=&dry_run=true&allow_default_model=true，请求体为 JSON/YAML 配置包，或以 multipart 的 file 字段上传
+// 依赖缺失时不创建 Agent，返回缺失的依赖列表
+func (h *AgentHandler) ImportAgent(c *gin.Context) {
+	var reader io.Reader = c.Request.Body
+	if fileHeader, err := c.FormFile("file"); err == nil {
+		f, err := fileHeader.Open()
+		if err != nil {
+			Error(c, err)
+			return
+		}
+		defer f.Close()
+		reader = f
+	}
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		BadRequest(c, "failed to read bundle: "+err.Error())
+		return
+	}
+
+	bundle, err := agentService.UnmarshalBundle(data)
+	if err != nil {
+		BadRequest(c, err.Error())
+		return
+	}
+
+	result, err := h.svc.Agent.ImportAgent(c.Request.Context(), &agentService.ImportAgentRequest{
+		Bundle:            bundle,
+		Name:              c.Query("name"),
+		DryRun:            c.Query("dry_run") == "true",
+		AllowDefaultModel: c.Query("allow_default_model") == "true",
+		TenantID:          middleware.GetTenantID(c),
+	})
+	if err != nil {
+		BadRequest(c, err.Error())
+		return
+	}
+
+	if result.Imported {
+		Created(c, result)
+		return
+	}
+	Success(c, result)
+}
+
 // GetPlaceholders 获取占位符定义
 func (h *AgentHandler) GetPlaceholders(c *gin.Context) {
 	Success(c, getAllPlaceholders())
@@ -143,6 +291,8 @@ func (h *AgentHandler) RunAgent(c *gin.Context) {
 		BadRequest(c, err.Error())
 		return
 	}
+	req.TenantID = middleware.GetTenantID(c)
+	req.UserID = getUserID(c)
 
 	resp, err := h.svc.Agent.Run(c.Request.Context(), id, &req)
 	if err != nil {
@@ -161,6 +311,8 @@ func (h *AgentHandler) StreamAgent(c *gin.Context) {
 		BadRequest(c, err.Error())
 		return
 	}
+	req.TenantID = middleware.GetTenantID(c)
+	req.UserID = getUserID(c)
 
 	eventCh, err := h.svc.Agent.Stream(c.Request.Context(), id, &req)
 	if err != nil {
@@ -168,26 +320,7 @@ func (h *AgentHandler) StreamAgent(c *gin.Context) {
 		return
 	}
 
-	// 设置 SSE 响应头
-	c.Writer.Header().Set("Content-Type", "text/event-stream")
-	c.Writer.Header().Set("Cache-Control", "no-cache")
-	c.Writer.Header().Set("Connection", "keep-alive")
-	c.Writer.Header().Set("Transfer-Encoding", "chunked")
-
-	// 发送流式事件
-	for event := range eventCh {
-		select {
-		case <-c.Request.Context().Done():
-			return
-		default:
-			c.SSEvent("", event)
-			c.Writer.Flush()
-		}
-
-		if event.Type == "end" || event.Type == "error" {
-			return
-		}
-	}
+	StreamSSE(c, eventCh)
 }
 
 // InitBuiltinAgents 初始化内置 Agent
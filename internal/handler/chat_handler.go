@@ -1,9 +1,18 @@
 package handler
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
 	"strconv"
+	"time"
 
+	"github.com/ashwinyue/next-ai/internal/middleware"
+	"github.com/ashwinyue/next-ai/internal/model"
 	"github.com/ashwinyue/next-ai/internal/service"
+	agentService "github.com/ashwinyue/next-ai/internal/service/agent"
 	"github.com/ashwinyue/next-ai/internal/service/chat"
 	"github.com/gin-gonic/gin"
 )
@@ -41,6 +50,11 @@ func getUserID(c *gin.Context) string {
 	return ""
 }
 
+// getOwner 获取请求方（租户 + 用户），会话只对其所有者可见
+func getOwner(c *gin.Context) model.Owner {
+	return model.Owner{TenantID: middleware.GetTenantID(c), UserID: getUserID(c)}
+}
+
 // CreateSession 创建会话
 func (h *ChatHandler) CreateSession(c *gin.Context) {
 	var req chat.CreateSessionRequest
@@ -49,7 +63,7 @@ func (h *ChatHandler) CreateSession(c *gin.Context) {
 		return
 	}
 
-	session, err := h.svc.Chat.CreateSession(c.Request.Context(), &req)
+	session, err := h.svc.Chat.CreateSession(c.Request.Context(), getOwner(c), &req)
 	if err != nil {
 		Error(c, err)
 		return
@@ -62,7 +76,7 @@ func (h *ChatHandler) CreateSession(c *gin.Context) {
 func (h *ChatHandler) GetSession(c *gin.Context) {
 	id := c.Param("id")
 
-	session, err := h.svc.Chat.GetSession(c.Request.Context(), id)
+	session, err := h.svc.Chat.GetSession(c.Request.Context(), getOwner(c), id)
 	if err != nil {
 		Error(c, err)
 		return
@@ -72,11 +86,32 @@ func (h *ChatHandler) GetSession(c *gin.Context) {
 }
 
 // ListSessions 列出会话
+// GET /api/v1/sessions?status=active|archived|all&page=&page_size=（status 缺省为 active）
+// 带 cursor 参数时使用游标分页：GET /api/v1/sessions?cursor=&page_size=，首页 cursor 为空
 func (h *ChatHandler) ListSessions(c *gin.Context) {
+	status, ok := sessionStatusQuery(c)
+	if !ok {
+		BadRequest(c, "status must be active, archived or all")
+		return
+	}
 	page, pageSize := getPagination(c)
 
-	sessions, total, err := h.svc.Chat.ListSessions(c.Request.Context(), &chat.ListSessionsRequest{
-		UserID: getUserID(c),
+	if cursor, ok := c.GetQuery("cursor"); ok {
+		result, err := h.svc.Chat.ListSessionsByCursor(c.Request.Context(), getOwner(c), &chat.ListSessionsByCursorRequest{
+			Status: status,
+			Cursor: cursor,
+			Size:   pageSize,
+		})
+		if err != nil {
+			BadRequest(c, err.Error())
+			return
+		}
+		Success(c, result)
+		return
+	}
+
+	sessions, total, err := h.svc.Chat.ListSessions(c.Request.Context(), getOwner(c), &chat.ListSessionsRequest{
+		Status: status,
 		Page:   page,
 		Size:   pageSize,
 	})
@@ -88,6 +123,74 @@ func (h *ChatHandler) ListSessions(c *gin.Context) {
 	SuccessWithPagination(c, sessions, total, page, pageSize)
 }
 
+// sessionStatusQuery 解析 status 查询参数，all 表示不限状态
+func sessionStatusQuery(c *gin.Context) (string, bool) {
+	switch status := c.DefaultQuery("status", model.SessionStatusActive); status {
+	case model.SessionStatusActive, model.SessionStatusArchived:
+		return status, true
+	case "all":
+		return "", true
+	default:
+		return "", false
+	}
+}
+
+// SearchSessions 检索会话
+// GET /api/v1/sessions/search?q=&agent_id=&status=&from=&to=&page=&page_size=
+// from/to 支持 2006-01-02 或 RFC3339，日期形式的 to 包含当天
+func (h *ChatHandler) SearchSessions(c *gin.Context) {
+	query := c.Query("q")
+	if query == "" {
+		BadRequest(c, "q is required")
+		return
+	}
+	from, err := parseQueryTime(c.Query("from"), false)
+	if err != nil {
+		BadRequest(c, "invalid from: "+err.Error())
+		return
+	}
+	to, err := parseQueryTime(c.Query("to"), true)
+	if err != nil {
+		BadRequest(c, "invalid to: "+err.Error())
+		return
+	}
+	page, pageSize := getPagination(c)
+
+	results, total, err := h.svc.Chat.SearchSessions(c.Request.Context(), getOwner(c), &chat.SearchSessionsRequest{
+		Query:   query,
+		AgentID: c.Query("agent_id"),
+		Status:  c.Query("status"),
+		From:    from,
+		To:      to,
+		Page:    page,
+		Size:    pageSize,
+	})
+	if err != nil {
+		BadRequest(c, err.Error())
+		return
+	}
+
+	SuccessWithPagination(c, results, total, page, pageSize)
+}
+
+// parseQueryTime 解析时间查询参数，endOfDay 为 true 时日期形式取次日零点（作为开区间上界）
+func parseQueryTime(s string, endOfDay bool) (*time.Time, error) {
+	if s == "" {
+		return nil, nil
+	}
+	if t, err := time.ParseInLocation(time.DateOnly, s, time.Local); err == nil {
+		if endOfDay {
+			t = t.AddDate(0, 0, 1)
+		}
+		return &t, nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
 // UpdateSession 更新会话
 func (h *ChatHandler) UpdateSession(c *gin.Context) {
 	id := c.Param("id")
@@ -97,7 +200,7 @@ func (h *ChatHandler) UpdateSession(c *gin.Context) {
 		return
 	}
 
-	session, err := h.svc.Chat.UpdateSession(c.Request.Context(), id, &req)
+	session, err := h.svc.Chat.UpdateSession(c.Request.Context(), getOwner(c), id, &req)
 	if err != nil {
 		Error(c, err)
 		return
@@ -107,10 +210,17 @@ func (h *ChatHandler) UpdateSession(c *gin.Context) {
 }
 
 // DeleteSession 删除会话
+// DELETE /api/v1/sessions/:id 移入回收站；?permanent=true 永久删除会话及其消息
 func (h *ChatHandler) DeleteSession(c *gin.Context) {
 	id := c.Param("id")
 
-	if err := h.svc.Chat.DeleteSession(c.Request.Context(), id); err != nil {
+	var err error
+	if c.Query("permanent") == "true" {
+		err = h.svc.Chat.PurgeSession(c.Request.Context(), getOwner(c), id)
+	} else {
+		err = h.svc.Chat.DeleteSession(c.Request.Context(), getOwner(c), id)
+	}
+	if err != nil {
 		Error(c, err)
 		return
 	}
@@ -118,6 +228,90 @@ func (h *ChatHandler) DeleteSession(c *gin.Context) {
 	NoContent(c)
 }
 
+// ArchiveSession 归档会话
+// POST /api/v1/sessions/:id/archive
+func (h *ChatHandler) ArchiveSession(c *gin.Context) {
+	session, err := h.svc.Chat.ArchiveSession(c.Request.Context(), getOwner(c), c.Param("id"))
+	if err != nil {
+		Error(c, err)
+		return
+	}
+	Success(c, session)
+}
+
+// UnarchiveSession 取消归档
+// POST /api/v1/sessions/:id/unarchive
+func (h *ChatHandler) UnarchiveSession(c *gin.Context) {
+	session, err := h.svc.Chat.UnarchiveSession(c.Request.Context(), getOwner(c), c.Param("id"))
+	if err != nil {
+		Error(c, err)
+		return
+	}
+	Success(c, session)
+}
+
+// PinSession 置顶会话
+// POST /api/v1/sessions/:id/pin
+func (h *ChatHandler) PinSession(c *gin.Context) {
+	session, err := h.svc.Chat.PinSession(c.Request.Context(), getOwner(c), c.Param("id"), true)
+	if err != nil {
+		Error(c, err)
+		return
+	}
+	Success(c, session)
+}
+
+// UnpinSession 取消置顶
+// DELETE /api/v1/sessions/:id/pin
+func (h *ChatHandler) UnpinSession(c *gin.Context) {
+	session, err := h.svc.Chat.PinSession(c.Request.Context(), getOwner(c), c.Param("id"), false)
+	if err != nil {
+		Error(c, err)
+		return
+	}
+	Success(c, session)
+}
+
+// RestoreSession 从回收站恢复会话
+// POST /api/v1/sessions/:id/restore
+func (h *ChatHandler) RestoreSession(c *gin.Context) {
+	session, err := h.svc.Chat.RestoreSession(c.Request.Context(), getOwner(c), c.Param("id"))
+	if err != nil {
+		Error(c, err)
+		return
+	}
+	Success(c, session)
+}
+
+// ListTrash 列出回收站中的会话（按删除时间倒序）
+// GET /api/v1/sessions/trash
+func (h *ChatHandler) ListTrash(c *gin.Context) {
+	page, pageSize := getPagination(c)
+
+	sessions, total, err := h.svc.Chat.ListSessions(c.Request.Context(), getOwner(c), &chat.ListSessionsRequest{
+		Deleted: true,
+		Page:    page,
+		Size:    pageSize,
+	})
+	if err != nil {
+		Error(c, err)
+		return
+	}
+
+	SuccessWithPagination(c, sessions, total, page, pageSize)
+}
+
+// EmptyTrash 清空回收站
+// DELETE /api/v1/sessions/trash
+func (h *ChatHandler) EmptyTrash(c *gin.Context) {
+	purged, err := h.svc.Chat.EmptyTrash(c.Request.Context(), getOwner(c))
+	if err != nil {
+		BadRequest(c, err.Error())
+		return
+	}
+	Success(c, gin.H{"purged": purged})
+}
+
 // SendMessage 发送消息
 func (h *ChatHandler) SendMessage(c *gin.Context) {
 	id := c.Param("id")
@@ -128,7 +322,7 @@ func (h *ChatHandler) SendMessage(c *gin.Context) {
 		return
 	}
 
-	message, err := h.svc.Chat.SendMessage(c.Request.Context(), id, &req)
+	message, err := h.svc.Chat.SendMessage(c.Request.Context(), getOwner(c), id, &req)
 	if err != nil {
 		Error(c, err)
 		return
@@ -141,7 +335,31 @@ func (h *ChatHandler) SendMessage(c *gin.Context) {
 func (h *ChatHandler) GetMessages(c *gin.Context) {
 	id := c.Param("id")
 
-	messages, err := h.svc.Chat.GetMessages(c.Request.Context(), id)
+	messages, err := h.svc.Chat.GetMessages(c.Request.Context(), getOwner(c), id)
+	if err != nil {
+		Error(c, err)
+		return
+	}
+
+	Success(c, gin.H{"messages": messages})
+}
+
+// ListMessageBranches 列出与指定消息处于同一位置的分支
+// GET /api/v1/sessions/:id/messages/:message_id/branches
+func (h *ChatHandler) ListMessageBranches(c *gin.Context) {
+	branches, err := h.svc.Chat.ListBranches(c.Request.Context(), getOwner(c), c.Param("id"), c.Param("message_id"))
+	if err != nil {
+		Error(c, err)
+		return
+	}
+
+	Success(c, branches)
+}
+
+// SwitchBranch 切换到指定消息所在的分支，返回新的当前分支消息
+// POST /api/v1/sessions/:id/messages/:message_id/checkout
+func (h *ChatHandler) SwitchBranch(c *gin.Context) {
+	messages, err := h.svc.Chat.SwitchBranch(c.Request.Context(), getOwner(c), c.Param("id"), c.Param("message_id"))
 	if err != nil {
 		Error(c, err)
 		return
@@ -150,6 +368,48 @@ func (h *ChatHandler) GetMessages(c *gin.Context) {
 	Success(c, gin.H{"messages": messages})
 }
 
+// EditMessage 编辑用户消息并以 SSE 输出新分支的回复
+// POST /api/v1/sessions/:id/messages/:message_id/edit
+func (h *ChatHandler) EditMessage(c *gin.Context) {
+	var req agentService.EditMessageRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		BadRequest(c, err.Error())
+		return
+	}
+	req.TenantID = middleware.GetTenantID(c)
+	req.UserID = getUserID(c)
+
+	eventCh, err := h.svc.Agent.EditMessage(c.Request.Context(), c.Param("id"), c.Param("message_id"), &req)
+	if err != nil {
+		Error(c, err)
+		return
+	}
+
+	StreamSSE(c, eventCh)
+}
+
+// RegenerateMessage 重新生成回复并以 SSE 输出新分支
+// POST /api/v1/sessions/:id/messages/:message_id/regenerate
+func (h *ChatHandler) RegenerateMessage(c *gin.Context) {
+	var req agentService.RegenerateRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			BadRequest(c, err.Error())
+			return
+		}
+	}
+	req.TenantID = middleware.GetTenantID(c)
+	req.UserID = getUserID(c)
+
+	eventCh, err := h.svc.Agent.RegenerateMessage(c.Request.Context(), c.Param("id"), c.Param("message_id"), &req)
+	if err != nil {
+		Error(c, err)
+		return
+	}
+
+	StreamSSE(c, eventCh)
+}
+
 // ========== 独立消息管理 ==========
 
 // LoadMessages 加载消息历史（支持分页和时间筛选）
@@ -158,7 +418,7 @@ func (h *ChatHandler) LoadMessages(c *gin.Context) {
 	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
 	beforeTime := c.Query("before_time")
 
-	messages, err := h.svc.Chat.LoadMessages(c.Request.Context(), sessionID, &chat.LoadMessagesRequest{
+	messages, err := h.svc.Chat.LoadMessages(c.Request.Context(), getOwner(c), sessionID, &chat.LoadMessagesRequest{
 		Limit:      limit,
 		BeforeTime: beforeTime,
 	})
@@ -174,7 +434,7 @@ func (h *ChatHandler) LoadMessages(c *gin.Context) {
 func (h *ChatHandler) GetMessage(c *gin.Context) {
 	messageID := c.Param("id")
 
-	message, err := h.svc.Chat.GetMessage(c.Request.Context(), messageID)
+	message, err := h.svc.Chat.GetMessage(c.Request.Context(), getOwner(c), messageID)
 	if err != nil {
 		Error(c, err)
 		return
@@ -188,7 +448,7 @@ func (h *ChatHandler) DeleteMessage(c *gin.Context) {
 	sessionID := c.Param("session_id")
 	messageID := c.Param("id")
 
-	if err := h.svc.Chat.DeleteMessage(c.Request.Context(), sessionID, messageID); err != nil {
+	if err := h.svc.Chat.DeleteMessage(c.Request.Context(), getOwner(c), sessionID, messageID); err != nil {
 		Error(c, err)
 		return
 	}
@@ -196,6 +456,92 @@ func (h *ChatHandler) DeleteMessage(c *gin.Context) {
 	Success(c, gin.H{"message": "Message deleted successfully"})
 }
 
+// ========== 会话导出导入 ==========
+
+// exportContentTypes 各导出格式的 Content-Type
+var exportContentTypes = map[string]string{
+	chat.ExportFormatMarkdown: "text/markdown; charset=utf-8",
+	chat.ExportFormatJSON:     "application/json",
+	chat.ExportFormatJSONL:    "application/x-ndjson",
+}
+
+// ExportSession 导出单个会话
+// GET /api/v1/sessions/:id/export?format=md|json|jsonl（format 缺省为 json）
+func (h *ChatHandler) ExportSession(c *gin.Context) {
+	id := c.Param("id")
+	format := c.DefaultQuery("format", chat.ExportFormatJSON)
+	contentType, ok := exportContentTypes[format]
+	if !ok {
+		BadRequest(c, "format must be md, json or jsonl")
+		return
+	}
+
+	data, err := h.svc.Chat.ExportSession(c.Request.Context(), getOwner(c), id, format)
+	if err != nil {
+		Error(c, err)
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", id+"."+format))
+	c.Data(http.StatusOK, contentType, data)
+}
+
+// ExportSessions 批量导出当前用户的会话为 zip
+// GET /api/v1/sessions/export?format=md|json|jsonl（format 缺省为 json）
+func (h *ChatHandler) ExportSessions(c *gin.Context) {
+	format := c.DefaultQuery("format", chat.ExportFormatJSON)
+	if _, ok := exportContentTypes[format]; !ok {
+		BadRequest(c, "format must be md, json or jsonl")
+		return
+	}
+
+	owner := getOwner(c)
+	if owner.UserID == "" {
+		BadRequest(c, "user_id is required")
+		return
+	}
+	req := &chat.ExportSessionsRequest{Format: format}
+
+	c.Header("Content-Type", "application/zip")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", "sessions-"+time.Now().Format("20060102150405")+".zip"))
+	if err := h.svc.Chat.ExportSessions(c.Request.Context(), owner, c.Writer, req); err != nil {
+		// 已开始写出 zip 时无法再返回错误响应，只能中断
+		if !c.Writer.Written() {
+			Error(c, err)
+			return
+		}
+		_ = c.Error(err)
+	}
+}
+
+// ImportSession 导入会话
+// POST /api/v1/sessions/import，请求体为 JSON 导出文件，或以 multipart 的 file 字段上传
+func (h *ChatHandler) ImportSession(c *gin.Context) {
+	var reader io.Reader = c.Request.Body
+	if fileHeader, err := c.FormFile("file"); err == nil {
+		f, err := fileHeader.Open()
+		if err != nil {
+			Error(c, err)
+			return
+		}
+		defer f.Close()
+		reader = f
+	}
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		BadRequest(c, "failed to read export: "+err.Error())
+		return
+	}
+
+	session, err := h.svc.Chat.ImportSession(c.Request.Context(), getOwner(c), data)
+	if err != nil {
+		BadRequest(c, err.Error())
+		return
+	}
+
+	Created(c, session)
+}
+
 // ========== 会话标题生成 ==========
 
 // GenerateTitle 生成会话标题
@@ -208,7 +554,7 @@ func (h *ChatHandler) GenerateTitle(c *gin.Context) {
 		return
 	}
 
-	title, err := h.svc.Chat.GenerateTitle(c.Request.Context(), sessionID, &req)
+	title, err := h.svc.Chat.GenerateTitle(c.Request.Context(), getOwner(c), sessionID, &req)
 	if err != nil {
 		Error(c, err)
 		return
@@ -243,6 +589,8 @@ func (h *ChatHandler) AgentChat(c *gin.Context) {
 		SessionID: sessionID,
 		AgentID:   req.AgentID,
 		Query:     req.Query,
+		TenantID:  middleware.GetTenantID(c),
+		UserID:    getUserID(c),
 	}
 
 	// 调用 Agent 聊天（流式）
@@ -252,21 +600,7 @@ func (h *ChatHandler) AgentChat(c *gin.Context) {
 		return
 	}
 
-	// 设置 SSE 流式响应
-	c.Header("Content-Type", "text/event-stream")
-	c.Header("Cache-Control", "no-cache")
-	c.Header("Connection", "keep-alive")
-
-	// 发送事件
-	for evt := range eventCh {
-		// 格式化为 SSE 格式
-		c.SSEvent("message", evt)
-		c.Writer.Flush()
-	}
-
-	// 发送结束事件
-	c.SSEvent("end", gin.H{"session_id": sessionID})
-	c.Writer.Flush()
+	StreamSSE(c, eventCh)
 }
 
 // ========== 会话流控制（WeKnora API 兼容）==========
@@ -277,9 +611,9 @@ type StopSessionRequest struct {
 }
 
 // StopSession 停止会话生成
-// POST /api/v1/sessions/:session_id/stop
+// POST /api/v1/sessions/:id/stop
 func (h *ChatHandler) StopSession(c *gin.Context) {
-	sessionID := c.Param("session_id")
+	sessionID := c.Param("id")
 
 	var req StopSessionRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -287,7 +621,12 @@ func (h *ChatHandler) StopSession(c *gin.Context) {
 		return
 	}
 
-	// 使用会话管理器停止流
+	if err := h.svc.Chat.CheckSession(c.Request.Context(), getOwner(c), sessionID); err != nil {
+		NotFound(c, err.Error())
+		return
+	}
+
+	// 使用会话管理器停止流（流在其他副本时通过 Redis 通知）
 	stopped := h.svc.SessionMgr.StopStream(sessionID, req.MessageID)
 
 	if !stopped {
@@ -309,10 +648,14 @@ func (h *ChatHandler) StopSession(c *gin.Context) {
 	})
 }
 
-// ContinueStream 继续接收流
-// GET /api/v1/sessions/continue-stream/:session_id?message_id=xxx
+// continueStreamPollInterval 续传时等待新事件的轮询间隔
+const continueStreamPollInterval = 200 * time.Millisecond
+
+// ContinueStream 断线续传：以 SSE 重放流事件并继续跟随直到流结束
+// GET /api/v1/sessions/continue-stream/:id?message_id=xxx&offset=n
+// 从 Last-Event-ID 之后的事件开始重放，未携带时使用 offset（默认 0，即从头重放）
 func (h *ChatHandler) ContinueStream(c *gin.Context) {
-	sessionID := c.Param("session_id")
+	sessionID := c.Param("id")
 	messageID := c.Query("message_id")
 
 	if messageID == "" {
@@ -320,36 +663,133 @@ func (h *ChatHandler) ContinueStream(c *gin.Context) {
 		return
 	}
 
-	// 获取流状态
-	stream := h.svc.SessionMgr.GetStream(sessionID, messageID)
+	offset, err := streamOffset(c)
+	if err != nil {
+		BadRequest(c, err.Error())
+		return
+	}
 
-	if stream == nil {
-		// 流不存在，可能已完成或从未存在
-		Success(c, gin.H{
-			"success":    true,
-			"session_id": sessionID,
-			"message_id": messageID,
-			"done":       true,
-			"content":    "",
-			"found":      false,
-		})
+	ctx := c.Request.Context()
+	if err := h.svc.Chat.CheckSession(ctx, getOwner(c), sessionID); err != nil {
+		NotFound(c, err.Error())
 		return
 	}
 
-	// 获取当前内容
-	content := stream.GetContent()
-	done := stream.IsDone()
+	events, done, found, err := h.svc.SessionMgr.ReadEvents(ctx, sessionID, messageID, offset)
+	if err != nil {
+		Error(c, err)
+		return
+	}
+	if !found {
+		NotFound(c, "stream not found or expired")
+		return
+	}
 
-	// 获取新增的块（用于增量更新）
-	chunks := stream.GetPartialChunks()
+	setSSEHeaders(c)
+	for {
+		for _, data := range events {
+			var evt struct {
+				Type string `json:"type"`
+			}
+			_ = json.Unmarshal(data, &evt)
+			writeSSE(c, offset, evt.Type, data)
+			offset++
+		}
+		if done {
+			return
+		}
 
-	Success(c, gin.H{
-		"success":    true,
-		"session_id": sessionID,
-		"message_id": messageID,
-		"done":       done,
-		"content":    content,
-		"chunks":     chunks,
-		"found":      true,
-	})
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(continueStreamPollInterval):
+		}
+
+		events, done, found, err = h.svc.SessionMgr.ReadEvents(ctx, sessionID, messageID, offset)
+		if err != nil || !found {
+			return
+		}
+	}
+}
+
+// streamOffset 解析续传起始序号
+func streamOffset(c *gin.Context) (int, error) {
+	if lastID := c.GetHeader("Last-Event-ID"); lastID != "" {
+		seq, err := strconv.Atoi(lastID)
+		if err != nil {
+			return 0, fmt.Errorf("invalid Last-Event-ID: %s", lastID)
+		}
+		return seq + 1, nil
+	}
+	if v := c.Query("offset"); v != "" {
+		offset, err := strconv.Atoi(v)
+		if err != nil || offset < 0 {
+			return 0, fmt.Errorf("invalid offset: %s", v)
+		}
+		return offset, nil
+	}
+	return 0, nil
+}
+
+// GetSessionPlan 获取会话最近一次 plan-execute 运行的计划
+// GET /api/v1/sessions/:id/plan
+func (h *ChatHandler) GetSessionPlan(c *gin.Context) {
+	plan, err := h.svc.Agent.GetPlan(c.Request.Context(), getOwner(c), c.Param("id"))
+	if err != nil {
+		Error(c, err)
+		return
+	}
+	if plan == nil {
+		NotFound(c, "plan not found")
+		return
+	}
+
+	Success(c, plan)
+}
+
+// ========== 工具调用审批 ==========
+
+// ApproveToolCallRequest 工具调用审批请求
+type ApproveToolCallRequest = agentService.ApproveRequest
+
+// GetPendingApproval 获取会话中待审批的工具调用
+// GET /api/v1/sessions/:id/approval
+func (h *ChatHandler) GetPendingApproval(c *gin.Context) {
+	pending, err := h.svc.Agent.GetPendingApproval(c.Request.Context(), getOwner(c), c.Param("id"))
+	if err != nil {
+		if errors.Is(err, agentService.ErrNoPendingApproval) {
+			NotFound(c, err.Error())
+			return
+		}
+		Error(c, err)
+		return
+	}
+
+	Success(c, pending)
+}
+
+// ApproveToolCall 批准或拒绝待审批的工具调用，并以 SSE 继续输出 Agent 运行结果
+// POST /api/v1/sessions/:id/approve
+func (h *ChatHandler) ApproveToolCall(c *gin.Context) {
+	sessionID := c.Param("id")
+
+	var req ApproveToolCallRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		BadRequest(c, err.Error())
+		return
+	}
+	req.TenantID = middleware.GetTenantID(c)
+	req.UserID = getUserID(c)
+
+	eventCh, err := h.svc.Agent.Approve(c.Request.Context(), sessionID, &req)
+	if err != nil {
+		if errors.Is(err, agentService.ErrNoPendingApproval) {
+			NotFound(c, err.Error())
+			return
+		}
+		Error(c, err)
+		return
+	}
+
+	StreamSSE(c, eventCh)
 }
@@ -0,0 +1,171 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/ashwinyue/next-ai/internal/config"
+	"github.com/ashwinyue/next-ai/internal/model"
+	"github.com/ashwinyue/next-ai/internal/repository"
+	"github.com/ashwinyue/next-ai/internal/service"
+	"github.com/ashwinyue/next-ai/internal/service/chat"
+	svctypes "github.com/ashwinyue/next-ai/internal/service/types"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// testDatabaseEnv 设置后使用 NEXT_AI_DATABASE_* 指向的 PostgreSQL 运行数据库测试
+const testDatabaseEnv = "NEXT_AI_TEST_DATABASE"
+
+// openTestRepositories 连接测试数据库，未配置时跳过测试
+func openTestRepositories(t *testing.T) *repository.Repositories {
+	t.Helper()
+	if os.Getenv(testDatabaseEnv) == "" {
+		t.Skipf("%s not set, skipping database test", testDatabaseEnv)
+	}
+	cfg, err := config.Load("")
+	if err != nil {
+		t.Fatalf("load config: %v", err)
+	}
+	db, err := repository.NewDB(cfg)
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+	return repository.NewRepositories(db.DB)
+}
+
+// stubAgentService 不运行 Agent 的 chat.AgentService
+type stubAgentService struct{}
+
+func (stubAgentService) StreamWithContext(ctx context.Context, agentID string, req interface{}) (<-chan svctypes.StreamEvent, error) {
+	return nil, nil
+}
+
+func (stubAgentService) ReleaseSession(ctx context.Context, sessionID string) {}
+
+// newTestChatRouter 注册会话路由，请求方由 X-User-ID / X-Tenant-ID 头指定
+func newTestChatRouter(repo *repository.Repositories) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	h := NewChatHandler(&service.Services{
+		Chat: chat.NewServiceWithAgent(chat.NewService(repo, nil), stubAgentService{}, nil, nil),
+	})
+
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		c.Set("user_id", c.GetHeader("X-User-ID"))
+		c.Set("tenant_id", c.GetHeader("X-Tenant-ID"))
+	})
+	sessions := r.Group("/api/v1/sessions")
+	sessions.GET("/search", h.SearchSessions)
+	sessions.GET("/:id", h.GetSession)
+	sessions.DELETE("/:id", h.DeleteSession)
+	sessions.GET("/:id/messages", h.GetMessages)
+	sessions.GET("/:id/export", h.ExportSession)
+	return r
+}
+
+func doRequest(r http.Handler, method, path string, owner model.Owner) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	req.Header.Set("X-User-ID", owner.UserID)
+	req.Header.Set("X-Tenant-ID", owner.TenantID)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestSessionAccessIsScopedToOwner(t *testing.T) {
+	repo := openTestRepositories(t)
+	r := newTestChatRouter(repo)
+
+	tenantID := uuid.New().String()
+	ownerA := model.Owner{TenantID: tenantID, UserID: uuid.New().String()}
+	ownerB := model.Owner{TenantID: tenantID, UserID: uuid.New().String()}
+	otherTenant := model.Owner{TenantID: uuid.New().String(), UserID: ownerA.UserID}
+
+	keyword := "ownership" + uuid.New().String()[:8]
+	session := &model.ChatSession{ID: uuid.New().String(), Title: "session of A", Status: model.SessionStatusActive}
+	message := &model.ChatMessage{
+		ID:        uuid.New().String(),
+		SessionID: session.ID,
+		Role:      "user",
+		Content:   "a message mentioning " + keyword,
+	}
+	session.ActiveLeafID = message.ID
+	if err := repo.Chat.ForOwner(ownerA).CreateSessionWithMessages(session, []*model.ChatMessage{message}); err != nil {
+		t.Fatalf("create session: %v", err)
+	}
+	t.Cleanup(func() { _ = repo.Chat.PurgeSession(session.ID) })
+
+	base := "/api/v1/sessions/" + session.ID
+	for _, owner := range []model.Owner{ownerB, otherTenant} {
+		for _, path := range []string{base, base + "/messages", base + "/export?format=json"} {
+			if w := doRequest(r, http.MethodGet, path, owner); w.Code != http.StatusNotFound {
+				t.Errorf("GET %s as %+v: status %d, want 404 (%s)", path, owner, w.Code, w.Body)
+			}
+		}
+		if w := doRequest(r, http.MethodDelete, base, owner); w.Code != http.StatusNotFound {
+			t.Errorf("DELETE %s as %+v: status %d, want 404 (%s)", base, owner, w.Code, w.Body)
+		}
+		if total := searchTotal(t, r, keyword, owner); total != 0 {
+			t.Errorf("search as %+v found %d sessions, want 0", owner, total)
+		}
+	}
+
+	// 所有者仍可正常访问，且其他用户的删除请求没有生效
+	for _, path := range []string{base, base + "/messages", base + "/export?format=json"} {
+		if w := doRequest(r, http.MethodGet, path, ownerA); w.Code != http.StatusOK {
+			t.Errorf("GET %s as owner: status %d, want 200 (%s)", path, w.Code, w.Body)
+		}
+	}
+	if total := searchTotal(t, r, keyword, ownerA); total != 1 {
+		t.Errorf("search as owner found %d sessions, want 1", total)
+	}
+	if w := doRequest(r, http.MethodDelete, base, ownerA); w.Code != http.StatusNoContent {
+		t.Errorf("DELETE %s as owner: status %d, want 204 (%s)", base, w.Code, w.Body)
+	}
+}
+
+// searchTotal 以指定请求方检索关键词，返回命中的会话数
+func searchTotal(t *testing.T, r http.Handler, keyword string, owner model.Owner) int64 {
+	t.Helper()
+	w := doRequest(r, http.MethodGet, "/api/v1/sessions/search?q="+keyword, owner)
+	if w.Code != http.StatusOK {
+		t.Fatalf("search as %+v: status %d (%s)", owner, w.Code, w.Body)
+	}
+	var resp struct {
+		Data struct {
+			Total int64 `json:"total"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode search response: %v", err)
+	}
+	return resp.Data.Total
+}
+
+func TestErrorMapsNotFound(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cases := []struct {
+		err  error
+		want int
+	}{
+		{fmt.Errorf("session not found: %w", gorm.ErrRecordNotFound), http.StatusNotFound},
+		{errors.New("connection refused"), http.StatusInternalServerError},
+	}
+	for _, tc := range cases {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		Error(c, tc.err)
+		if w.Code != tc.want {
+			t.Errorf("Error(%v): status %d, want %d", tc.err, w.Code, tc.want)
+		}
+	}
+}
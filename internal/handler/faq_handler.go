@@ -0,0 +1,213 @@
+// Package handler 提供 FAQ 相关的 HTTP 处理器
+package handler
+
+import (
+	"strconv"
+
+	"github.com/ashwinyue/next-ai/internal/middleware"
+	"github.com/ashwinyue/next-ai/internal/service"
+	"github.com/ashwinyue/next-ai/internal/service/faq"
+	"github.com/gin-gonic/gin"
+)
+
+// FAQHandler FAQ 处理器
+type FAQHandler struct {
+	svc *service.Services
+}
+
+// NewFAQHandler 创建 FAQ 处理器
+func NewFAQHandler(svc *service.Services) *FAQHandler {
+	return &FAQHandler{svc: svc}
+}
+
+// CreateFAQRequest 创建 FAQ 请求
+type CreateFAQRequest = faq.CreateFAQRequest
+
+// UpdateFAQRequest 更新 FAQ 请求
+type UpdateFAQRequest = faq.UpdateFAQRequest
+
+// CreateFAQ 创建 FAQ
+// @Summary      创建 FAQ
+// @Tags         FAQ
+// @Accept       json
+// @Produce      json
+// @Param        request  body      CreateFAQRequest  true  "FAQ 信息"
+// @Success      201      {object}  Response
+// @Router       /api/v1/faqs [post]
+func (h *FAQHandler) CreateFAQ(c *gin.Context) {
+	var req CreateFAQRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		BadRequest(c, err.Error())
+		return
+	}
+	req.TenantID = middleware.GetTenantID(c)
+
+	item, err := h.svc.FAQ.CreateFAQ(c.Request.Context(), &req)
+	if err != nil {
+		BadRequest(c, err.Error())
+		return
+	}
+
+	Created(c, item)
+}
+
+// ListFAQs 列出 FAQ
+// @Summary      列出 FAQ
+// @Tags         FAQ
+// @Produce      json
+// @Param        category   query     string  false  "分类"
+// @Param        page       query     int     false  "页码"
+// @Param        page_size  query     int     false  "每页数量"
+// @Success      200        {object}  Response
+// @Router       /api/v1/faqs [get]
+func (h *FAQHandler) ListFAQs(c *gin.Context) {
+	h.listFAQs(c, false)
+}
+
+// ListActiveFAQs 列出启用的 FAQ
+// @Summary      列出启用的 FAQ
+// @Tags         FAQ
+// @Produce      json
+// @Param        category   query     string  false  "分类"
+// @Param        page       query     int     false  "页码"
+// @Param        page_size  query     int     false  "每页数量"
+// @Success      200        {object}  Response
+// @Router       /api/v1/faqs/active [get]
+func (h *FAQHandler) ListActiveFAQs(c *gin.Context) {
+	h.listFAQs(c, true)
+}
+
+// listFAQs 分页列出 FAQ
+func (h *FAQHandler) listFAQs(c *gin.Context, activeOnly bool) {
+	page, pageSize := getPagination(c)
+
+	items, total, err := h.svc.FAQ.ListFAQs(c.Request.Context(), &faq.ListFAQsRequest{
+		TenantID:   middleware.GetTenantID(c),
+		Category:   c.Query("category"),
+		ActiveOnly: activeOnly,
+		Page:       page,
+		Size:       pageSize,
+	})
+	if err != nil {
+		Error(c, err)
+		return
+	}
+
+	SuccessWithPagination(c, items, total, page, pageSize)
+}
+
+// SearchFAQs 搜索 FAQ
+// @Summary      搜索 FAQ
+// @Description  按完全匹配、语义相似度和字符相似度搜索启用的 FAQ
+// @Tags         FAQ
+// @Produce      json
+// @Param        q      query     string  true   "查询问题"
+// @Param        limit  query     int     false  "返回数量（默认 10）"
+// @Success      200    {object}  Response
+// @Router       /api/v1/faqs/search [get]
+func (h *FAQHandler) SearchFAQs(c *gin.Context) {
+	query := c.Query("q")
+	if query == "" {
+		BadRequest(c, "q is required")
+		return
+	}
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "10"))
+
+	results, err := h.svc.FAQ.SearchFAQs(c.Request.Context(), middleware.GetTenantID(c), query, limit)
+	if err != nil {
+		Error(c, err)
+		return
+	}
+
+	Success(c, results)
+}
+
+// ImportFAQs 批量导入 FAQ
+// @Summary      批量导入 FAQ
+// @Description  从 CSV 或 Excel（.xlsx）导入，列顺序：问题, 答案, 相似问法（| 分隔）, 分类
+// @Tags         FAQ
+// @Accept       multipart/form-data
+// @Produce      json
+// @Param        file  formData  file  true  "CSV 或 Excel 文件"
+// @Success      200   {object}  Response
+// @Router       /api/v1/faqs/import [post]
+func (h *FAQHandler) ImportFAQs(c *gin.Context) {
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		BadRequest(c, "file is required: "+err.Error())
+		return
+	}
+
+	f, err := fileHeader.Open()
+	if err != nil {
+		Error(c, err)
+		return
+	}
+	defer f.Close()
+
+	result, err := h.svc.FAQ.ImportFAQs(c.Request.Context(), middleware.GetTenantID(c), fileHeader.Filename, f)
+	if err != nil {
+		BadRequest(c, err.Error())
+		return
+	}
+
+	Success(c, result)
+}
+
+// GetFAQ 获取 FAQ
+// @Summary      获取 FAQ
+// @Tags         FAQ
+// @Produce      json
+// @Param        id   path      string  true  "FAQ ID"
+// @Success      200  {object}  Response
+// @Failure      404  {object}  Response
+// @Router       /api/v1/faqs/{id} [get]
+func (h *FAQHandler) GetFAQ(c *gin.Context) {
+	item, err := h.svc.FAQ.GetFAQ(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		NotFound(c, err.Error())
+		return
+	}
+
+	Success(c, item)
+}
+
+// UpdateFAQ 更新 FAQ
+// @Summary      更新 FAQ
+// @Tags         FAQ
+// @Accept       json
+// @Produce      json
+// @Param        id       path      string            true  "FAQ ID"
+// @Param        request  body      UpdateFAQRequest  true  "更新内容"
+// @Success      200      {object}  Response
+// @Router       /api/v1/faqs/{id} [put]
+func (h *FAQHandler) UpdateFAQ(c *gin.Context) {
+	var req UpdateFAQRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		BadRequest(c, err.Error())
+		return
+	}
+
+	item, err := h.svc.FAQ.UpdateFAQ(c.Request.Context(), c.Param("id"), &req)
+	if err != nil {
+		BadRequest(c, err.Error())
+		return
+	}
+
+	Success(c, item)
+}
+
+// DeleteFAQ 删除 FAQ
+// @Summary      删除 FAQ
+// @Tags         FAQ
+// @Param        id   path      string  true  "FAQ ID"
+// @Success      204
+// @Router       /api/v1/faqs/{id} [delete]
+func (h *FAQHandler) DeleteFAQ(c *gin.Context) {
+	if err := h.svc.FAQ.DeleteFAQ(c.Request.Context(), c.Param("id")); err != nil {
+		Error(c, err)
+		return
+	}
+
+	NoContent(c)
+}
@@ -18,6 +18,8 @@ type Handlers struct {
 	System         *SystemHandler
 	Message        *MessageHandler
 	WebSearch      *WebSearchHandler
+	Knowledge      *KnowledgeHandler
+	FAQ            *FAQHandler
 }
 
 // NewHandlers 创建所有处理器
@@ -35,5 +37,7 @@ func NewHandlers(svc *service.Services) *Handlers {
 		System:         NewSystemHandler(svc),
 		Message:        NewMessageHandler(svc.Chat),
 		WebSearch:      NewWebSearchHandler(),
+		Knowledge:      NewKnowledgeHandler(svc),
+		FAQ:            NewFAQHandler(svc),
 	}
 }
@@ -0,0 +1,236 @@
+// Package handler 提供知识库相关的 HTTP 处理器
+package handler
+
+import (
+	"github.com/ashwinyue/next-ai/internal/middleware"
+	"github.com/ashwinyue/next-ai/internal/service"
+	"github.com/ashwinyue/next-ai/internal/service/knowledge"
+	"github.com/gin-gonic/gin"
+)
+
+// KnowledgeHandler 知识库处理器
+type KnowledgeHandler struct {
+	svc *service.Services
+}
+
+// NewKnowledgeHandler 创建知识库处理器
+func NewKnowledgeHandler(svc *service.Services) *KnowledgeHandler {
+	return &KnowledgeHandler{svc: svc}
+}
+
+// CreateKnowledgeBaseRequest 创建知识库请求
+type CreateKnowledgeBaseRequest = knowledge.CreateKnowledgeBaseRequest
+
+// UpdateKnowledgeBaseRequest 更新知识库请求
+type UpdateKnowledgeBaseRequest = knowledge.UpdateKnowledgeBaseRequest
+
+// CreateKnowledgeBase 创建知识库
+// @Summary      创建知识库
+// @Description  创建新的知识库，可指定分块大小和重叠
+// @Tags         知识库
+// @Accept       json
+// @Produce      json
+// @Param        request  body      CreateKnowledgeBaseRequest  true  "知识库信息"
+// @Success      201      {object}  Response
+// @Router       /api/v1/knowledge-bases [post]
+func (h *KnowledgeHandler) CreateKnowledgeBase(c *gin.Context) {
+	var req CreateKnowledgeBaseRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		BadRequest(c, err.Error())
+		return
+	}
+	req.TenantID = middleware.GetTenantID(c)
+
+	kb, err := h.svc.Knowledge.CreateKnowledgeBase(c.Request.Context(), &req)
+	if err != nil {
+		BadRequest(c, err.Error())
+		return
+	}
+
+	Created(c, kb)
+}
+
+// ListKnowledgeBases 列出知识库
+// @Summary      列出知识库
+// @Description  分页获取当前租户的知识库
+// @Tags         知识库
+// @Produce      json
+// @Param        page       query     int  false  "页码"
+// @Param        page_size  query     int  false  "每页数量"
+// @Success      200        {object}  Response
+// @Router       /api/v1/knowledge-bases [get]
+func (h *KnowledgeHandler) ListKnowledgeBases(c *gin.Context) {
+	page, pageSize := getPagination(c)
+
+	kbs, total, err := h.svc.Knowledge.ListKnowledgeBases(c.Request.Context(), &knowledge.ListKnowledgeBasesRequest{
+		TenantID: middleware.GetTenantID(c),
+		Page:     page,
+		Size:     pageSize,
+	})
+	if err != nil {
+		Error(c, err)
+		return
+	}
+
+	SuccessWithPagination(c, kbs, total, page, pageSize)
+}
+
+// GetKnowledgeBase 获取知识库
+// @Summary      获取知识库
+// @Tags         知识库
+// @Produce      json
+// @Param        id   path      string  true  "知识库ID"
+// @Success      200  {object}  Response
+// @Failure      404  {object}  Response
+// @Router       /api/v1/knowledge-bases/{id} [get]
+func (h *KnowledgeHandler) GetKnowledgeBase(c *gin.Context) {
+	kb, err := h.svc.Knowledge.GetKnowledgeBase(c.Request.Context(), middleware.GetTenantID(c), c.Param("id"))
+	if err != nil {
+		NotFound(c, err.Error())
+		return
+	}
+
+	Success(c, kb)
+}
+
+// UpdateKnowledgeBase 更新知识库
+// @Summary      更新知识库
+// @Tags         知识库
+// @Accept       json
+// @Produce      json
+// @Param        id       path      string                      true  "知识库ID"
+// @Param        request  body      UpdateKnowledgeBaseRequest  true  "更新内容"
+// @Success      200      {object}  Response
+// @Router       /api/v1/knowledge-bases/{id} [put]
+func (h *KnowledgeHandler) UpdateKnowledgeBase(c *gin.Context) {
+	var req UpdateKnowledgeBaseRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		BadRequest(c, err.Error())
+		return
+	}
+
+	kb, err := h.svc.Knowledge.UpdateKnowledgeBase(c.Request.Context(), middleware.GetTenantID(c), c.Param("id"), &req)
+	if err != nil {
+		InvalidRequest(c, err)
+		return
+	}
+
+	Success(c, kb)
+}
+
+// DeleteKnowledgeBase 删除知识库
+// @Summary      删除知识库
+// @Description  删除知识库及其全部文档、分块和索引数据
+// @Tags         知识库
+// @Param        id   path      string  true  "知识库ID"
+// @Success      204
+// @Router       /api/v1/knowledge-bases/{id} [delete]
+func (h *KnowledgeHandler) DeleteKnowledgeBase(c *gin.Context) {
+	if err := h.svc.Knowledge.DeleteKnowledgeBase(c.Request.Context(), middleware.GetTenantID(c), c.Param("id")); err != nil {
+		Error(c, err)
+		return
+	}
+
+	NoContent(c)
+}
+
+// UploadDocument 上传文档
+// @Summary      上传文档
+// @Description  上传文档到知识库，后台异步完成解析、分块和向量化（支持 pdf/docx/txt/md/csv/json）
+// @Tags         知识库
+// @Accept       multipart/form-data
+// @Produce      json
+// @Param        id           path      string  true   "知识库ID"
+// @Param        file         formData  file    true   "文档"
+// @Param        title        formData  string  false  "标题（默认文件名）"
+// @Param        description  formData  string  false  "描述"
+// @Success      201          {object}  Response
+// @Router       /api/v1/knowledge-bases/{id}/documents [post]
+func (h *KnowledgeHandler) UploadDocument(c *gin.Context) {
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		BadRequest(c, "file is required: "+err.Error())
+		return
+	}
+
+	f, err := fileHeader.Open()
+	if err != nil {
+		Error(c, err)
+		return
+	}
+	defer f.Close()
+
+	doc, err := h.svc.Knowledge.UploadDocument(c.Request.Context(), c.Param("id"), &knowledge.UploadDocumentRequest{
+		FileName:    fileHeader.Filename,
+		ContentType: fileHeader.Header.Get("Content-Type"),
+		Size:        fileHeader.Size,
+		Reader:      f,
+		TenantID:    middleware.GetTenantID(c),
+		Title:       c.PostForm("title"),
+		Description: c.PostForm("description"),
+	})
+	if err != nil {
+		InvalidRequest(c, err)
+		return
+	}
+
+	Created(c, doc)
+}
+
+// ListDocuments 列出知识库文档
+// @Summary      列出知识库文档
+// @Tags         知识库
+// @Produce      json
+// @Param        id         path      string  true   "知识库ID"
+// @Param        page       query     int     false  "页码"
+// @Param        page_size  query     int     false  "每页数量"
+// @Success      200        {object}  Response
+// @Router       /api/v1/knowledge-bases/{id}/documents [get]
+func (h *KnowledgeHandler) ListDocuments(c *gin.Context) {
+	page, pageSize := getPagination(c)
+
+	docs, total, err := h.svc.Knowledge.ListDocuments(c.Request.Context(), middleware.GetTenantID(c), c.Param("id"), &knowledge.ListDocumentsRequest{
+		Page: page,
+		Size: pageSize,
+	})
+	if err != nil {
+		Error(c, err)
+		return
+	}
+
+	SuccessWithPagination(c, docs, total, page, pageSize)
+}
+
+// GetDocument 获取文档
+// @Summary      获取文档
+// @Description  获取文档信息及处理状态
+// @Tags         知识库
+// @Produce      json
+// @Param        id   path      string  true  "文档ID"
+// @Success      200  {object}  Response
+// @Failure      404  {object}  Response
+// @Router       /api/v1/documents/{id} [get]
+func (h *KnowledgeHandler) GetDocument(c *gin.Context) {
+	doc, err := h.svc.Knowledge.GetDocument(c.Request.Context(), middleware.GetTenantID(c), c.Param("id"))
+	if err != nil {
+		NotFound(c, err.Error())
+		return
+	}
+
+	Success(c, doc)
+}
+
+// DeleteDocument 删除文档
+// @Summary      删除文档
+// @Tags         知识库
+// @Param        id   path      string  true  "文档ID"
+// @Success      204
+// @Router       /api/v1/documents/{id} [delete]
+func (h *KnowledgeHandler) DeleteDocument(c *gin.Context) {
+	if err := h.svc.Knowledge.DeleteDocument(c.Request.Context(), middleware.GetTenantID(c), c.Param("id")); err != nil {
+		Error(c, err)
+		return
+	}
+
+	NoContent(c)
+}
@@ -64,7 +64,7 @@ func (h *MessageHandler) LoadMessages(c *gin.Context) {
 
 	if beforeTimeStr == "" {
 		// 获取最近的消息
-		messages, err := h.chatService.Service.LoadMessages(ctx, sessionID, &chat.LoadMessagesRequest{
+		messages, err := h.chatService.Service.LoadMessages(ctx, getOwner(c), sessionID, &chat.LoadMessagesRequest{
 			Limit: limit,
 		})
 		if err != nil {
@@ -83,7 +83,7 @@ func (h *MessageHandler) LoadMessages(c *gin.Context) {
 	}
 
 	// 验证时间格式（不进行实际转换，直接传递字符串）
-	messages, err := h.chatService.Service.LoadMessages(ctx, sessionID, &chat.LoadMessagesRequest{
+	messages, err := h.chatService.Service.LoadMessages(ctx, getOwner(c), sessionID, &chat.LoadMessagesRequest{
 		BeforeTime: beforeTimeStr,
 		Limit:      limit,
 	})
@@ -138,7 +138,7 @@ func (h *MessageHandler) DeleteMessage(c *gin.Context) {
 	}
 
 	// 删除消息
-	err := h.chatService.Service.DeleteMessage(ctx, sessionID, messageID)
+	err := h.chatService.Service.DeleteMessage(ctx, getOwner(c), sessionID, messageID)
 	if err != nil {
 		// 检查错误类型
 		errMsg := err.Error()
@@ -1,9 +1,14 @@
 package handler
 
 import (
+	"errors"
 	"net/http"
+	"strconv"
 
+	svctypes "github.com/ashwinyue/next-ai/internal/service/types"
+	"github.com/gin-contrib/sse"
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 // ========== WeKnora API 响应格式 ==========
@@ -66,13 +71,27 @@ func InternalServerError(c *gin.Context, msg string) {
 }
 
 // Error 根据错误类型返回相应的错误响应
+// 记录不存在（包括无权访问的会话，仓库按不存在处理）返回 404，其余返回 500
 func Error(c *gin.Context, err error) {
 	if err == nil {
 		return
 	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		NotFound(c, err.Error())
+		return
+	}
 	InternalServerError(c, err.Error())
 }
 
+// InvalidRequest 记录不存在返回 404，其余按请求参数错误返回 400
+func InvalidRequest(c *gin.Context, err error) {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		NotFound(c, err.Error())
+		return
+	}
+	BadRequest(c, err.Error())
+}
+
 // Pagination 分页响应数据结构
 type PaginationData struct {
 	Items      interface{} `json:"items"`
@@ -99,3 +118,36 @@ func SuccessWithPagination(c *gin.Context, items interface{}, total int64, page,
 		},
 	})
 }
+
+// StreamSSE 以 SSE 输出流式事件，事件类型作为 SSE event 名称，事件序号作为 SSE id
+// 客户端断开后继续读取剩余事件，避免生产者阻塞
+func StreamSSE(c *gin.Context, eventCh <-chan svctypes.StreamEvent) {
+	setSSEHeaders(c)
+
+	done := c.Request.Context().Done()
+	for evt := range eventCh {
+		select {
+		case <-done:
+			continue
+		default:
+		}
+		writeSSE(c, evt.Seq, evt.Type, evt)
+	}
+}
+
+// setSSEHeaders 设置 SSE 响应头
+func setSSEHeaders(c *gin.Context) {
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+}
+
+// writeSSE 输出一个带 id 的 SSE 事件
+func writeSSE(c *gin.Context, seq int, event string, data interface{}) {
+	c.Render(-1, sse.Event{
+		Id:    strconv.Itoa(seq),
+		Event: event,
+		Data:  data,
+	})
+	c.Writer.Flush()
+}
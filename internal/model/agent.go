@@ -12,6 +12,8 @@ import (
 // Agent 模式常量
 const (
 	AgentModeSmartReasoning = "smart-reasoning" // ReAct 多步推理模式
+	AgentModeSupervisor     = "supervisor"      // 监督者模式，将任务转交给子 Agent
+	AgentModePlanExecute    = "plan-execute"    // 先规划再逐步执行，执行后重新规划
 )
 
 // 内置 Agent ID 常量
@@ -36,6 +38,7 @@ func IsBuiltinAgentID(id string) bool {
 
 // ModelConfig represents AI model configuration
 type ModelConfig struct {
+	ModelID    string                 `json:"model_id,omitempty"` // 引用 models 表中的对话模型，为空时使用默认模型
 	Provider   string                 `json:"provider"`
 	Model      string                 `json:"model"`
 	APIKey     string                 `json:"api_key,omitempty"`
@@ -45,22 +48,28 @@ type ModelConfig struct {
 
 // Agent AI代理配置
 type Agent struct {
-	ID           string         `gorm:"primaryKey;type:varchar(36)" json:"id"`
-	Name         string         `gorm:"size:255;not null;uniqueIndex" json:"name"`
-	Description  string         `gorm:"type:text" json:"description"`
-	Avatar       string         `gorm:"size:64" json:"avatar,omitempty"`                   // 头像/图标
-	IsBuiltin    bool           `gorm:"default:false" json:"is_builtin"`                   // 是否内置 Agent
-	AgentMode    string         `gorm:"size:32;default:smart-reasoning" json:"agent_mode"` // Agent 模式
-	SystemPrompt string         `gorm:"type:text" json:"system_prompt"`
-	ModelConfig  ModelConfig    `gorm:"type:jsonb;serializer:json" json:"model_config"`
-	Tools        datatypes.JSON `gorm:"type:jsonb" json:"tools"`
-	MaxIter      int            `gorm:"default:10" json:"max_iterations"`
-	Temperature  float64        `gorm:"default:0.7" json:"temperature"` // 温度参数
-	IsActive     bool           `gorm:"index;default:true" json:"is_active"`
-	Metadata     datatypes.JSON `gorm:"type:jsonb" json:"metadata"`
-	CreatedAt    time.Time      `json:"created_at"`
-	UpdatedAt    time.Time      `json:"updated_at"`
-	DeletedAt    gorm.DeletedAt `gorm:"index" json:"-"`
+	ID               string         `gorm:"primaryKey;type:varchar(36)" json:"id"`
+	Name             string         `gorm:"size:255;not null;uniqueIndex" json:"name"`
+	Description      string         `gorm:"type:text" json:"description"`
+	Avatar           string         `gorm:"size:64" json:"avatar,omitempty"`                   // 头像/图标
+	IsBuiltin        bool           `gorm:"default:false" json:"is_builtin"`                   // 是否内置 Agent
+	AgentMode        string         `gorm:"size:32;default:smart-reasoning" json:"agent_mode"` // Agent 模式
+	SystemPrompt     string         `gorm:"type:text" json:"system_prompt"`
+	ModelConfig      ModelConfig    `gorm:"type:jsonb;serializer:json" json:"model_config"`
+	Tools            datatypes.JSON `gorm:"type:jsonb" json:"tools"`
+	KnowledgeBases   datatypes.JSON `gorm:"type:jsonb" json:"knowledge_bases"` // 绑定的知识库 ID 列表，供 knowledge_search 检索
+	ApprovalTools    datatypes.JSON `gorm:"type:jsonb" json:"approval_tools"`  // 调用前需要人工审批的工具名称列表
+	SubAgents        datatypes.JSON `gorm:"type:jsonb" json:"sub_agents"`      // supervisor 模式下可转交的子 Agent ID 列表
+	FallbackModels   datatypes.JSON `gorm:"type:jsonb" json:"fallback_models"` // 主模型失败时按顺序尝试的备用模型 ID 列表
+	MaxIter          int            `gorm:"default:10" json:"max_iterations"`
+	Temperature      float64        `gorm:"default:0.7" json:"temperature"` // 温度参数
+	IsActive         bool           `gorm:"index;default:true" json:"is_active"`
+	LatestVersion    int            `gorm:"default:0" json:"latest_version"`    // 最新版本号（当前编辑的配置）
+	PublishedVersion int            `gorm:"default:0" json:"published_version"` // 新会话使用的版本号，0 表示未版本化（直接使用当前配置）
+	Metadata         datatypes.JSON `gorm:"type:jsonb" json:"metadata"`
+	CreatedAt        time.Time      `json:"created_at"`
+	UpdatedAt        time.Time      `json:"updated_at"`
+	DeletedAt        gorm.DeletedAt `gorm:"index" json:"-"`
 }
 
 // TableName 指定表名
@@ -68,6 +77,68 @@ func (Agent) TableName() string {
 	return "agents"
 }
 
+// AgentVersionConfig Agent 影响运行行为的配置，版本快照保存的内容
+type AgentVersionConfig struct {
+	Description    string         `json:"description"`
+	AgentMode      string         `json:"agent_mode"`
+	SystemPrompt   string         `json:"system_prompt"`
+	ModelConfig    ModelConfig    `json:"model_config"`
+	Tools          datatypes.JSON `json:"tools"`
+	KnowledgeBases datatypes.JSON `json:"knowledge_bases"`
+	ApprovalTools  datatypes.JSON `json:"approval_tools"`
+	SubAgents      datatypes.JSON `json:"sub_agents"`
+	FallbackModels datatypes.JSON `json:"fallback_models"`
+	MaxIter        int            `json:"max_iterations"`
+	Temperature    float64        `json:"temperature"`
+}
+
+// Config 返回 Agent 当前配置的快照
+func (a *Agent) Config() AgentVersionConfig {
+	return AgentVersionConfig{
+		Description:    a.Description,
+		AgentMode:      a.AgentMode,
+		SystemPrompt:   a.SystemPrompt,
+		ModelConfig:    a.ModelConfig,
+		Tools:          a.Tools,
+		KnowledgeBases: a.KnowledgeBases,
+		ApprovalTools:  a.ApprovalTools,
+		SubAgents:      a.SubAgents,
+		FallbackModels: a.FallbackModels,
+		MaxIter:        a.MaxIter,
+		Temperature:    a.Temperature,
+	}
+}
+
+// ApplyConfig 用快照覆盖 Agent 的运行配置
+func (a *Agent) ApplyConfig(c AgentVersionConfig) {
+	a.Description = c.Description
+	a.AgentMode = c.AgentMode
+	a.SystemPrompt = c.SystemPrompt
+	a.ModelConfig = c.ModelConfig
+	a.Tools = c.Tools
+	a.KnowledgeBases = c.KnowledgeBases
+	a.ApprovalTools = c.ApprovalTools
+	a.SubAgents = c.SubAgents
+	a.FallbackModels = c.FallbackModels
+	a.MaxIter = c.MaxIter
+	a.Temperature = c.Temperature
+}
+
+// AgentVersion Agent 配置的不可变版本
+type AgentVersion struct {
+	ID        string             `gorm:"primaryKey;type:varchar(36)" json:"id"`
+	AgentID   string             `gorm:"size:36;not null;uniqueIndex:idx_agent_version" json:"agent_id"`
+	Version   int                `gorm:"not null;uniqueIndex:idx_agent_version" json:"version"`
+	Config    AgentVersionConfig `gorm:"type:jsonb;serializer:json" json:"config"`
+	Note      string             `gorm:"size:255" json:"note,omitempty"` // 版本说明
+	CreatedAt time.Time          `json:"created_at"`
+}
+
+// TableName 指定表名
+func (AgentVersion) TableName() string {
+	return "agent_versions"
+}
+
 // ModelConfig 实现 driver.Valuer 和 sql.Scanner
 func (m ModelConfig) Value() (driver.Value, error) {
 	return json.Marshal(m)
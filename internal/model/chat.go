@@ -1,27 +1,84 @@
 package model
 
-import "time"
+import (
+	"strings"
+	"time"
+
+	"github.com/ashwinyue/next-ai/internal/pkg/tokenizer"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
 
 // ChatSession 聊天会话
 type ChatSession struct {
-	ID        string        `gorm:"primaryKey;size:36"`
-	UserID    string        `gorm:"index;size:36"`
-	AgentID   string        `gorm:"index;size:36"`
-	Title     string        `gorm:"size:255"`
-	Status    string        `gorm:"index;size:20;default:active"`
-	CreatedAt time.Time     `gorm:"autoCreateTime"`
-	UpdatedAt time.Time     `gorm:"autoUpdateTime"`
-	Messages  []ChatMessage `gorm:"foreignKey:SessionID"`
+	ID           string         `gorm:"primaryKey;size:36"`
+	TenantID     string         `gorm:"index;size:36"`
+	UserID       string         `gorm:"index;size:36"`
+	AgentID      string         `gorm:"index;size:36"`
+	AgentVersion int            `gorm:"default:0"` // 会话固定使用的 Agent 版本，首次运行时确定
+	Title        string         `gorm:"size:255"`
+	Status       string         `gorm:"index;size:20;default:active"` // active, archived
+	PinnedAt     *time.Time     // 置顶时间，置顶会话排在列表最前
+	Summary      string         `gorm:"type:text"` // 早期对话的滚动摘要（上下文压缩）
+	SummaryUntil *time.Time     // 摘要覆盖到的最后一条消息的创建时间
+	ActiveLeafID string         `gorm:"size:36"` // 当前分支的最后一条消息，消息按 ParentID 组成树
+	CreatedAt    time.Time      `gorm:"autoCreateTime"`
+	UpdatedAt    time.Time      `gorm:"autoUpdateTime"`
+	DeletedAt    gorm.DeletedAt `gorm:"index"` // 软删除，已删除的会话在回收站中可恢复
+	Messages     []ChatMessage  `gorm:"foreignKey:SessionID"`
+}
+
+// Owner 会话归属，会话的读写要求租户和用户同时匹配
+type Owner struct {
+	TenantID string
+	UserID   string
 }
 
+// 会话状态
+const (
+	SessionStatusActive   = "active"
+	SessionStatusArchived = "archived"
+)
+
 // ChatMessage 聊天消息
 type ChatMessage struct {
-	ID        string    `gorm:"primaryKey;size:36"`
-	SessionID string    `gorm:"index;size:36"`
-	Role      string    `gorm:"size:20;index"` // user, assistant, system, tool
-	Content   string    `gorm:"type:text"`
-	TokenUsed int       `gorm:"default:0"`
-	CreatedAt time.Time `gorm:"autoCreateTime;index"`
+	ID               string         `gorm:"primaryKey;size:36"`
+	SessionID        string         `gorm:"index;size:36"`
+	ParentID         string         `gorm:"index;size:36"` // 上一条消息，同一父消息下的多条消息互为分支（编辑或重新生成）
+	Role             string         `gorm:"size:20;index"` // user, assistant, system, tool
+	Content          string         `gorm:"type:text"`
+	ReasoningContent string         `gorm:"type:text"`  // 助手消息的思考过程
+	ToolCalls        datatypes.JSON `gorm:"type:jsonb"` // 助手消息发起的工具调用
+	ToolCallID       string         `gorm:"size:64"`    // tool 消息对应的工具调用 ID
+	ToolName         string         `gorm:"size:100"`   // tool 消息的工具名称
+	PromptTokens     int            `gorm:"default:0"`
+	CompletionTokens int            `gorm:"default:0"`
+	TokenUsed        int            `gorm:"default:0"`          // 总 token 数
+	SearchTokens     *string        `gorm:"type:text" json:"-"` // 分词后的检索文本（全文检索），NULL 表示尚未建立索引
+	CreatedAt        time.Time      `gorm:"autoCreateTime;index"`
+}
+
+// BeforeCreate GORM 钩子，创建前生成检索文本
+func (m *ChatMessage) BeforeCreate(tx *gorm.DB) error {
+	tokens := MessageSearchTokens(m.Role, m.Content)
+	m.SearchTokens = &tokens
+	return nil
+}
+
+// MessageSearchTokens 生成消息的检索文本：仅索引用户和助手的消息，词元去重后以空格拼接
+func MessageSearchTokens(role, content string) string {
+	if role != "user" && role != "assistant" {
+		return ""
+	}
+	seen := make(map[string]bool)
+	var tokens []string
+	for _, t := range tokenizer.Tokenize(content) {
+		if !seen[t] {
+			seen[t] = true
+			tokens = append(tokens, t)
+		}
+	}
+	return strings.Join(tokens, " ")
 }
 
 // TableName 指定表名
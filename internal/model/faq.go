@@ -0,0 +1,53 @@
+// Package model 提供 FAQ 相关的数据模型
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// FAQ 常见问题
+type FAQ struct {
+	ID               string   `json:"id" gorm:"type:varchar(36);primaryKey"`
+	TenantID         string   `json:"tenant_id" gorm:"type:varchar(36);index"`
+	Question         string   `json:"question" gorm:"type:text;not null"`
+	Answer           string   `json:"answer" gorm:"type:text;not null"`
+	SimilarQuestions []string `json:"similar_questions" gorm:"type:jsonb;serializer:json"` // 相似问法
+	Category         string   `json:"category" gorm:"type:varchar(100);index"`
+	IsActive         bool     `json:"is_active" gorm:"index;default:true"`
+	HitCount         int64    `json:"hit_count" gorm:"default:0"`
+
+	// 问题及相似问法的向量（与 Questions() 顺序一致），用于语义匹配
+	Embeddings [][]float64 `json:"-" gorm:"type:jsonb;serializer:json"`
+
+	CreatedAt time.Time      `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt time.Time      `json:"updated_at" gorm:"autoUpdateTime"`
+	DeletedAt gorm.DeletedAt `json:"deleted_at,omitempty" gorm:"index"`
+}
+
+// Questions 返回标准问题和全部相似问法
+func (f *FAQ) Questions() []string {
+	questions := make([]string, 0, len(f.SimilarQuestions)+1)
+	questions = append(questions, f.Question)
+	for _, q := range f.SimilarQuestions {
+		if q != "" {
+			questions = append(questions, q)
+		}
+	}
+	return questions
+}
+
+// BeforeCreate GORM 钩子
+func (f *FAQ) BeforeCreate(tx *gorm.DB) error {
+	if f.ID == "" {
+		f.ID = uuid.New().String()
+	}
+	return nil
+}
+
+// TableName 指定表名
+func (FAQ) TableName() string {
+	return "faqs"
+}
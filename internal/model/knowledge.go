@@ -0,0 +1,113 @@
+// Package model 提供知识库相关的数据模型
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ParseStatus 文档处理状态
+type ParseStatus string
+
+const (
+	ParseStatusPending    ParseStatus = "pending"    // 等待处理
+	ParseStatusProcessing ParseStatus = "processing" // 解析/向量化中
+	ParseStatusCompleted  ParseStatus = "completed"  // 已完成
+	ParseStatusFailed     ParseStatus = "failed"     // 处理失败
+)
+
+// ChunkType 分块类型
+const (
+	ChunkTypeText = "text"
+)
+
+// KnowledgeBase 知识库
+type KnowledgeBase struct {
+	ID            string `json:"id" gorm:"type:varchar(36);primaryKey"`
+	TenantID      string `json:"tenant_id" gorm:"type:varchar(36);index"`
+	Name          string `json:"name" gorm:"type:varchar(255);not null"`
+	Description   string `json:"description" gorm:"type:text"`
+	ChunkSize     int    `json:"chunk_size" gorm:"default:1000"`   // 分块大小（字符）
+	ChunkOverlap  int    `json:"chunk_overlap" gorm:"default:200"` // 分块重叠（字符）
+	DocumentCount int    `json:"document_count" gorm:"-"`
+
+	CreatedAt time.Time      `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt time.Time      `json:"updated_at" gorm:"autoUpdateTime"`
+	DeletedAt gorm.DeletedAt `json:"deleted_at,omitempty" gorm:"index"`
+}
+
+// BeforeCreate GORM 钩子
+func (kb *KnowledgeBase) BeforeCreate(tx *gorm.DB) error {
+	if kb.ID == "" {
+		kb.ID = uuid.New().String()
+	}
+	return nil
+}
+
+// TableName 指定表名
+func (KnowledgeBase) TableName() string {
+	return "knowledge_bases"
+}
+
+// Knowledge 知识库中的文档
+type Knowledge struct {
+	ID              string      `json:"id" gorm:"type:varchar(36);primaryKey"`
+	TenantID        string      `json:"tenant_id" gorm:"type:varchar(36);index"`
+	KnowledgeBaseID string      `json:"knowledge_base_id" gorm:"type:varchar(36);index;not null"`
+	FileID          string      `json:"file_id" gorm:"type:varchar(36)"` // StoredFile.ID
+	Title           string      `json:"title" gorm:"type:varchar(255)"`
+	Description     string      `json:"description" gorm:"type:text"`
+	FileName        string      `json:"file_name" gorm:"type:varchar(255)"`
+	FileType        string      `json:"file_type" gorm:"type:varchar(50)"`
+	FileSize        int64       `json:"file_size"`
+	ParseStatus     ParseStatus `json:"parse_status" gorm:"type:varchar(50);default:'pending';index"`
+	ErrorMessage    string      `json:"error_message,omitempty" gorm:"type:text"`
+	ChunkCount      int         `json:"chunk_count" gorm:"default:0"`
+
+	CreatedAt time.Time      `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt time.Time      `json:"updated_at" gorm:"autoUpdateTime"`
+	DeletedAt gorm.DeletedAt `json:"deleted_at,omitempty" gorm:"index"`
+}
+
+// BeforeCreate GORM 钩子
+func (k *Knowledge) BeforeCreate(tx *gorm.DB) error {
+	if k.ID == "" {
+		k.ID = uuid.New().String()
+	}
+	return nil
+}
+
+// TableName 指定表名
+func (Knowledge) TableName() string {
+	return "knowledges"
+}
+
+// Chunk 文档分块
+// 内容同时写入 Elasticsearch（含向量），数据库保留一份用于展示和重建索引
+type Chunk struct {
+	ID              string `json:"id" gorm:"type:varchar(36);primaryKey"`
+	TenantID        string `json:"tenant_id" gorm:"type:varchar(36);index"`
+	KnowledgeBaseID string `json:"knowledge_base_id" gorm:"type:varchar(36);index;not null"`
+	KnowledgeID     string `json:"knowledge_id" gorm:"type:varchar(36);index;not null"`
+	ChunkIndex      int    `json:"chunk_index"`
+	Content         string `json:"content" gorm:"type:text"`
+	ChunkType       string `json:"chunk_type" gorm:"type:varchar(20);default:'text'"`
+
+	CreatedAt time.Time `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt time.Time `json:"updated_at" gorm:"autoUpdateTime"`
+}
+
+// BeforeCreate GORM 钩子
+func (c *Chunk) BeforeCreate(tx *gorm.DB) error {
+	if c.ID == "" {
+		c.ID = uuid.New().String()
+	}
+	return nil
+}
+
+// TableName 指定表名
+func (Chunk) TableName() string {
+	return "chunks"
+}
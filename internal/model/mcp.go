@@ -50,9 +50,9 @@ type MCPAuthConfig struct {
 
 // MCPAdvancedConfig MCP 高级配置
 type MCPAdvancedConfig struct {
-	Timeout    int `json:"timeout"`     // 超时时间（秒），默认 30
-	RetryCount int `json:"retry_count"` // 重试次数，默认 3
-	RetryDelay int `json:"retry_delay"` // 重试延迟（秒），默认 1
+	Timeout    int  `json:"timeout"`               // 超时时间（秒），默认 30
+	RetryCount *int `json:"retry_count,omitempty"` // 重试次数，未设置时默认 3，0 表示不重试
+	RetryDelay int  `json:"retry_delay"`           // 重试延迟（秒），默认 1
 }
 
 // MCPStdioConfig Stdio 传输配置
@@ -210,9 +210,10 @@ func (e *MCPEnvVars) Scan(value interface{}) error {
 
 // GetDefaultAdvancedConfig 返回默认高级配置
 func GetDefaultAdvancedConfig() *MCPAdvancedConfig {
+	retryCount := 3
 	return &MCPAdvancedConfig{
 		Timeout:    30,
-		RetryCount: 3,
+		RetryCount: &retryCount,
 		RetryDelay: 1,
 	}
 }
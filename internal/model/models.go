@@ -6,10 +6,15 @@ var AllModels = []interface{}{
 	&ChatSession{},
 	&ChatMessage{},
 	&Agent{},
+	&AgentVersion{},
 	&Tool{},
 	&User{},
 	&AuthToken{},
 	&StoredFile{},
 	&Tenant{},
 	&MCPService{},
+	&KnowledgeBase{},
+	&Knowledge{},
+	&Chunk{},
+	&FAQ{},
 }
@@ -55,14 +55,15 @@ type AgentConfig struct {
 	AllowedTools      []string `json:"allowed_tools"`
 	Temperature       float64  `json:"temperature"`
 	SystemPrompt      string   `json:"system_prompt,omitempty"`
+	AllowedTables     []string `json:"allowed_tables,omitempty"` // database_query 工具可查询的表，为空时使用默认白名单
 }
 
 // ContextConfig 上下文配置
 type ContextConfig struct {
 	MaxRounds        int     `json:"max_rounds"`
 	EmbeddingTopK    int     `json:"embedding_top_k"`
-	KeywordThreshold float64 `json:"keyword_threshold"`
-	VectorThreshold  float64 `json:"vector_threshold"`
+	KeywordThreshold float64 `json:"keyword_threshold"` // 按本次最高分归一化后的 BM25 分数
+	VectorThreshold  float64 `json:"vector_threshold"`  // 余弦相似度
 }
 
 // WebSearchConfig 网络搜索配置
@@ -88,6 +89,8 @@ type ConversationConfig struct {
 	EnableQueryExpansion bool    `json:"enable_query_expansion"`
 	FallbackStrategy     string  `json:"fallback_strategy"`
 	FallbackResponse     string  `json:"fallback_response"`
+	EnableFAQ            bool    `json:"enable_faq"`    // 调用 Agent 前先匹配 FAQ
+	FAQThreshold         float64 `json:"faq_threshold"` // FAQ 直接回答的最低置信度
 }
 
 // Value 实现 driver.Valuer for AgentConfig
@@ -0,0 +1,54 @@
+// Package tokenizer 提供不依赖外部词典的轻量分词，供 BM25 重排和全文检索共用
+package tokenizer
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Tokenize 分词：拉丁字母/数字按单词切分并转小写，中日韩文字按单字和相邻双字切分
+func Tokenize(text string) []string {
+	var tokens []string
+	var word []rune
+	var cjk []rune
+
+	flushWord := func() {
+		if len(word) > 0 {
+			tokens = append(tokens, strings.ToLower(string(word)))
+			word = word[:0]
+		}
+	}
+	flushCJK := func() {
+		for i, c := range cjk {
+			tokens = append(tokens, string(c))
+			if i+1 < len(cjk) {
+				tokens = append(tokens, string(cjk[i:i+2]))
+			}
+		}
+		cjk = cjk[:0]
+	}
+
+	for _, c := range text {
+		switch {
+		case IsCJK(c):
+			flushWord()
+			cjk = append(cjk, c)
+		case unicode.IsLetter(c) || unicode.IsDigit(c):
+			flushCJK()
+			word = append(word, c)
+		default:
+			flushWord()
+			flushCJK()
+		}
+	}
+	flushWord()
+	flushCJK()
+
+	return tokens
+}
+
+// IsCJK 判断是否为中日韩文字
+func IsCJK(c rune) bool {
+	return unicode.Is(unicode.Han, c) || unicode.Is(unicode.Hiragana, c) ||
+		unicode.Is(unicode.Katakana, c) || unicode.Is(unicode.Hangul, c)
+}
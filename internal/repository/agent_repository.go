@@ -63,3 +63,50 @@ func (r *AgentRepository) Update(agent *model.Agent) error {
 func (r *AgentRepository) Delete(id string) error {
 	return r.db.Delete(&model.Agent{}, "id = ?", id).Error
 }
+
+// CreateWithVersion 创建Agent及其首个版本
+func (r *AgentRepository) CreateWithVersion(agent *model.Agent, version *model.AgentVersion) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(agent).Error; err != nil {
+			return err
+		}
+		return tx.Create(version).Error
+	})
+}
+
+// UpdateWithVersions 更新Agent并追加版本
+func (r *AgentRepository) UpdateWithVersions(agent *model.Agent, versions ...*model.AgentVersion) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(agent).Error; err != nil {
+			return err
+		}
+		for _, version := range versions {
+			if err := tx.Create(version).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// UpdatePublishedVersion 更新Agent的发布版本
+func (r *AgentRepository) UpdatePublishedVersion(id string, version int) error {
+	return r.db.Model(&model.Agent{}).Where("id = ?", id).Update("published_version", version).Error
+}
+
+// GetVersion 获取Agent的指定版本
+func (r *AgentRepository) GetVersion(agentID string, version int) (*model.AgentVersion, error) {
+	var v model.AgentVersion
+	err := r.db.Where("agent_id = ? AND version = ?", agentID, version).First(&v).Error
+	if err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+// ListVersions 列出Agent的所有版本
+func (r *AgentRepository) ListVersions(agentID string) ([]*model.AgentVersion, error) {
+	var versions []*model.AgentVersion
+	err := r.db.Where("agent_id = ?", agentID).Order("version DESC").Find(&versions).Error
+	return versions, err
+}
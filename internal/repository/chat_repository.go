@@ -1,13 +1,18 @@
 package repository
 
 import (
+	"strings"
+	"time"
+
 	"github.com/ashwinyue/next-ai/internal/model"
 	"gorm.io/gorm"
 )
 
 // ChatRepository 聊天数据访问
+// 通过 ForOwner 获得按归属限定的仓库，面向用户的读写都应经过它；未限定的仓库供 Agent 运行时等内部流程使用
 type ChatRepository struct {
-	db *gorm.DB
+	db    *gorm.DB
+	owner *model.Owner
 }
 
 // NewChatRepository 创建聊天仓库
@@ -15,63 +20,312 @@ func NewChatRepository(db *gorm.DB) *ChatRepository {
 	return &ChatRepository{db: db}
 }
 
+// ForOwner 返回按归属限定的仓库：只能读写租户和用户均匹配的会话及其中的消息，
+// 不匹配的会话与不存在一样返回 gorm.ErrRecordNotFound
+func (r *ChatRepository) ForOwner(owner model.Owner) *ChatRepository {
+	return &ChatRepository{db: r.db, owner: &owner}
+}
+
+// sessionQuery 会话查询，限定归属时只包含归属会话
+func (r *ChatRepository) sessionQuery(db *gorm.DB) *gorm.DB {
+	query := db.Model(&model.ChatSession{})
+	if r.owner != nil {
+		query = query.Where("chat_sessions.tenant_id = ? AND chat_sessions.user_id = ?", r.owner.TenantID, r.owner.UserID)
+	}
+	return query
+}
+
+// messageQuery 消息查询，限定归属时只包含归属会话（不含回收站）中的消息
+func (r *ChatRepository) messageQuery(db *gorm.DB) *gorm.DB {
+	query := db.Model(&model.ChatMessage{})
+	if r.owner != nil {
+		query = query.Where("chat_messages.session_id IN (?)", r.sessionQuery(r.db).Select("id"))
+	}
+	return query
+}
+
+// checkSession 限定归属时校验会话属于当前归属
+func (r *ChatRepository) checkSession(db *gorm.DB, sessionID string) error {
+	if r.owner == nil {
+		return nil
+	}
+	var count int64
+	if err := r.sessionQuery(db).Where("id = ?", sessionID).Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// stampOwner 限定归属时将归属写入新会话
+func (r *ChatRepository) stampOwner(session *model.ChatSession) {
+	if r.owner != nil {
+		session.TenantID = r.owner.TenantID
+		session.UserID = r.owner.UserID
+	}
+}
+
 // CreateSession 创建会话
 func (r *ChatRepository) CreateSession(session *model.ChatSession) error {
+	r.stampOwner(session)
 	return r.db.Create(session).Error
 }
 
 // GetSessionByID 获取会话
 func (r *ChatRepository) GetSessionByID(id string) (*model.ChatSession, error) {
 	var session model.ChatSession
-	err := r.db.Preload("Messages").Where("id = ?", id).First(&session).Error
+	err := r.sessionQuery(r.db).Preload("Messages").Where("id = ?", id).First(&session).Error
 	if err != nil {
 		return nil, err
 	}
 	return &session, nil
 }
 
-// ListSessions 列出会话
-func (r *ChatRepository) ListSessions(userID string, offset, limit int) ([]*model.ChatSession, error) {
+// GetSessionMeta 获取会话基本信息（不加载消息）
+func (r *ChatRepository) GetSessionMeta(id string) (*model.ChatSession, error) {
+	var session model.ChatSession
+	err := r.sessionQuery(r.db).Omit("summary").Where("id = ?", id).First(&session).Error
+	if err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// SessionListFilter 会话列表条件
+type SessionListFilter struct {
+	Status  string // 为空时不限状态
+	Deleted bool   // 列出回收站中的会话
+}
+
+// SessionCursor 会话列表游标，对应排序键（置顶时间倒序、创建时间倒序、ID 倒序）的最后一项
+// PinnedAt 为 nil 表示最后一项未置顶
+type SessionCursor struct {
+	PinnedAt  *time.Time `json:"pt,omitempty"`
+	CreatedAt time.Time  `json:"t"`
+	ID        string     `json:"id"`
+}
+
+// sessionListQuery 构造会话列表查询
+func (r *ChatRepository) sessionListQuery(filter *SessionListFilter) *gorm.DB {
+	query := r.sessionQuery(r.db)
+	if filter.Deleted {
+		query = query.Unscoped().Where("deleted_at IS NOT NULL")
+	}
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+	return query
+}
+
+// sessionListOrder 会话列表排序：置顶会话在前并按置顶时间倒序，其余按创建时间倒序
+const sessionListOrder = "pinned_at DESC NULLS LAST, created_at DESC, id DESC"
+
+// ListSessions 分页列出会话：置顶会话在前，其余按创建时间倒序；回收站按删除时间倒序
+func (r *ChatRepository) ListSessions(filter *SessionListFilter, offset, limit int) ([]*model.ChatSession, int64, error) {
 	var sessions []*model.ChatSession
-	query := r.db.Order("created_at DESC").Offset(offset).Limit(limit)
-	if userID != "" {
-		query = query.Where("user_id = ?", userID)
+	var total int64
+
+	query := r.sessionListQuery(filter)
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	if filter.Deleted {
+		query = query.Order("deleted_at DESC")
+	} else {
+		query = query.Order(sessionListOrder)
+	}
+	err := query.Omit("summary").Offset(offset).Limit(limit).Find(&sessions).Error
+	return sessions, total, err
+}
+
+// CountSessions 统计会话数
+func (r *ChatRepository) CountSessions(filter *SessionListFilter) (int64, error) {
+	var total int64
+	err := r.sessionListQuery(filter).Count(&total).Error
+	return total, err
+}
+
+// ListSessionsAfter 按游标列出会话（排序与 ListSessions 一致），cursor 为 nil 时从头开始
+func (r *ChatRepository) ListSessionsAfter(filter *SessionListFilter, cursor *SessionCursor, limit int) ([]*model.ChatSession, error) {
+	var sessions []*model.ChatSession
+	query := r.sessionListQuery(filter)
+	if cursor != nil {
+		if cursor.PinnedAt != nil {
+			query = query.Where("(pinned_at IS NOT NULL AND (pinned_at, created_at, id) < (?, ?, ?)) OR pinned_at IS NULL",
+				*cursor.PinnedAt, cursor.CreatedAt, cursor.ID)
+		} else {
+			query = query.Where("pinned_at IS NULL AND (created_at, id) < (?, ?)", cursor.CreatedAt, cursor.ID)
+		}
 	}
-	err := query.Find(&sessions).Error
+	err := query.Omit("summary").Order(sessionListOrder).Limit(limit).Find(&sessions).Error
 	return sessions, err
 }
 
+// CreateSessionWithMessages 创建会话及其消息（导入）
+func (r *ChatRepository) CreateSessionWithMessages(session *model.ChatSession, messages []*model.ChatMessage) error {
+	r.stampOwner(session)
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(session).Error; err != nil {
+			return err
+		}
+		if len(messages) == 0 {
+			return nil
+		}
+		return tx.Create(messages).Error
+	})
+}
+
 // UpdateSession 更新会话
 func (r *ChatRepository) UpdateSession(session *model.ChatSession) error {
+	if err := r.checkSession(r.db, session.ID); err != nil {
+		return err
+	}
+	r.stampOwner(session)
 	return r.db.Save(session).Error
 }
 
-// DeleteSession 删除会话
+// GetSessionSummary 获取会话的滚动摘要（不加载消息）
+func (r *ChatRepository) GetSessionSummary(id string) (*model.ChatSession, error) {
+	var session model.ChatSession
+	err := r.sessionQuery(r.db).Select("id", "summary", "summary_until").Where("id = ?", id).First(&session).Error
+	if err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// UpdateSessionSummary 更新会话的滚动摘要
+func (r *ChatRepository) UpdateSessionSummary(id, summary string, until time.Time) error {
+	return r.sessionQuery(r.db).Where("id = ?", id).Updates(map[string]interface{}{
+		"summary":       summary,
+		"summary_until": until,
+	}).Error
+}
+
+// PinSessionAgentVersion 固定会话使用的 Agent 版本（仅在尚未固定时生效，未绑定 Agent 的会话同时绑定）
+// 返回会话固定的版本：已被其他请求固定时返回已有版本，会话属于其他 Agent 时返回 0
+func (r *ChatRepository) PinSessionAgentVersion(id, agentID string, version int) (int, error) {
+	var session model.ChatSession
+	err := r.sessionQuery(r.db).Select("id", "agent_id", "agent_version").Where("id = ?", id).First(&session).Error
+	if err != nil {
+		return 0, err
+	}
+	if session.AgentID != "" && session.AgentID != agentID {
+		return 0, nil
+	}
+	if session.AgentVersion > 0 {
+		return session.AgentVersion, nil
+	}
+
+	result := r.sessionQuery(r.db).
+		Where("id = ? AND agent_version = 0 AND (agent_id = ? OR agent_id = '')", id, agentID).
+		Updates(map[string]interface{}{
+			"agent_id":      agentID,
+			"agent_version": version,
+		})
+	if result.Error != nil {
+		return 0, result.Error
+	}
+	if result.RowsAffected == 0 {
+		// 并发请求已先固定
+		if err := r.sessionQuery(r.db).Select("agent_id", "agent_version").Where("id = ?", id).First(&session).Error; err != nil {
+			return 0, err
+		}
+		if session.AgentID != agentID {
+			return 0, nil
+		}
+		return session.AgentVersion, nil
+	}
+	return version, nil
+}
+
+// UpdateSessionStatus 更新会话状态
+func (r *ChatRepository) UpdateSessionStatus(id, status string) error {
+	return r.sessionQuery(r.db).Where("id = ?", id).Update("status", status).Error
+}
+
+// UpdateSessionPinned 置顶或取消置顶会话，pinnedAt 为 nil 时取消置顶
+func (r *ChatRepository) UpdateSessionPinned(id string, pinnedAt *time.Time) error {
+	return r.sessionQuery(r.db).Where("id = ?", id).Update("pinned_at", pinnedAt).Error
+}
+
+// DeleteSession 将会话移入回收站（软删除，保留消息）
 func (r *ChatRepository) DeleteSession(id string) error {
+	return r.sessionQuery(r.db).Where("id = ?", id).Delete(&model.ChatSession{}).Error
+}
+
+// GetDeletedSession 获取回收站中的会话
+func (r *ChatRepository) GetDeletedSession(id string) (*model.ChatSession, error) {
+	var session model.ChatSession
+	err := r.sessionQuery(r.db).Unscoped().Omit("summary").Where("id = ? AND deleted_at IS NOT NULL", id).First(&session).Error
+	if err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// RestoreSession 从回收站恢复会话
+func (r *ChatRepository) RestoreSession(id string) error {
+	return r.sessionQuery(r.db).Unscoped().Where("id = ? AND deleted_at IS NOT NULL", id).
+		Update("deleted_at", nil).Error
+}
+
+// PurgeSession 永久删除会话及其消息（包括回收站中的会话）
+func (r *ChatRepository) PurgeSession(id string) error {
 	return r.db.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := r.sessionQuery(tx).Unscoped().Where("id = ?", id).Count(&count).Error; err != nil {
+			return err
+		}
+		if count == 0 {
+			return gorm.ErrRecordNotFound
+		}
 		if err := tx.Delete(&model.ChatMessage{}, "session_id = ?", id).Error; err != nil {
 			return err
 		}
-		return tx.Delete(&model.ChatSession{}, "id = ?", id).Error
+		return tx.Unscoped().Delete(&model.ChatSession{}, "id = ?", id).Error
 	})
 }
 
+// PurgeDeletedSessions 清空用户的回收站，返回永久删除的会话数
+func (r *ChatRepository) PurgeDeletedSessions(userID string) (int64, error) {
+	var purged int64
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		deleted := r.sessionQuery(tx).Unscoped().Select("id").
+			Where("user_id = ? AND deleted_at IS NOT NULL", userID)
+		if err := tx.Where("session_id IN (?)", deleted).Delete(&model.ChatMessage{}).Error; err != nil {
+			return err
+		}
+		result := r.sessionQuery(tx).Unscoped().Where("user_id = ? AND deleted_at IS NOT NULL", userID).
+			Delete(&model.ChatSession{})
+		purged = result.RowsAffected
+		return result.Error
+	})
+	return purged, err
+}
+
 // CreateMessage 创建消息
 func (r *ChatRepository) CreateMessage(msg *model.ChatMessage) error {
+	if err := r.checkSession(r.db, msg.SessionID); err != nil {
+		return err
+	}
 	return r.db.Create(msg).Error
 }
 
 // GetMessagesBySessionID 获取会话消息
 func (r *ChatRepository) GetMessagesBySessionID(sessionID string) ([]*model.ChatMessage, error) {
 	var messages []*model.ChatMessage
-	err := r.db.Where("session_id = ?", sessionID).Order("created_at ASC").Find(&messages).Error
+	err := r.messageQuery(r.db).Where("session_id = ?", sessionID).Order("created_at ASC").Find(&messages).Error
 	return messages, err
 }
 
 // GetRecentMessagesBySession 获取会话最近的 N 条消息
 func (r *ChatRepository) GetRecentMessagesBySession(sessionID string, limit int) ([]*model.ChatMessage, error) {
 	var messages []*model.ChatMessage
-	err := r.db.Where("session_id = ?", sessionID).
+	err := r.messageQuery(r.db).Where("session_id = ?", sessionID).
 		Order("created_at DESC").
 		Limit(limit).
 		Find(&messages).Error
@@ -81,7 +335,7 @@ func (r *ChatRepository) GetRecentMessagesBySession(sessionID string, limit int)
 // GetMessagesBySessionBeforeTime 获取会话指定时间之前的消息
 func (r *ChatRepository) GetMessagesBySessionBeforeTime(sessionID string, beforeTime string, limit int) ([]*model.ChatMessage, error) {
 	var messages []*model.ChatMessage
-	query := r.db.Where("session_id = ?", sessionID)
+	query := r.messageQuery(r.db).Where("session_id = ?", sessionID)
 	if beforeTime != "" {
 		query = query.Where("created_at < ?", beforeTime)
 	}
@@ -92,14 +346,218 @@ func (r *ChatRepository) GetMessagesBySessionBeforeTime(sessionID string, before
 // GetMessageByID 获取单条消息
 func (r *ChatRepository) GetMessageByID(messageID string) (*model.ChatMessage, error) {
 	var message model.ChatMessage
-	err := r.db.Where("id = ?", messageID).First(&message).Error
+	err := r.messageQuery(r.db).Where("id = ?", messageID).First(&message).Error
 	if err != nil {
 		return nil, err
 	}
 	return &message, nil
 }
 
-// DeleteMessage 删除消息
+// DeleteMessage 删除消息，子消息挂到被删除消息的父消息上，当前叶子随之上移
 func (r *ChatRepository) DeleteMessage(messageID string) error {
-	return r.db.Delete(&model.ChatMessage{}, "id = ?", messageID).Error
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		var message model.ChatMessage
+		if err := r.messageQuery(tx).Where("id = ?", messageID).First(&message).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&model.ChatMessage{}).
+			Where("session_id = ? AND parent_id = ?", message.SessionID, messageID).
+			Update("parent_id", message.ParentID).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&model.ChatSession{}).
+			Where("id = ? AND active_leaf_id = ?", message.SessionID, messageID).
+			Update("active_leaf_id", message.ParentID).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&model.ChatMessage{}, "id = ?", messageID).Error
+	})
+}
+
+// ========== 消息分支 ==========
+
+// AppendMessages 按顺序保存一轮对话的消息，并将最后一条设为会话的当前叶子
+func (r *ChatRepository) AppendMessages(sessionID string, messages []*model.ChatMessage) error {
+	if len(messages) == 0 {
+		return nil
+	}
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := r.checkSession(tx, sessionID); err != nil {
+			return err
+		}
+		if err := tx.Create(messages).Error; err != nil {
+			return err
+		}
+		return tx.Model(&model.ChatSession{}).Where("id = ?", sessionID).
+			Update("active_leaf_id", messages[len(messages)-1].ID).Error
+	})
+}
+
+// ResolveActiveLeaf 获取会话的当前叶子
+// 分支功能之前的会话没有叶子，按创建时间将已有消息串成一条链并以最后一条作为叶子
+func (r *ChatRepository) ResolveActiveLeaf(sessionID string) (string, error) {
+	var session model.ChatSession
+	if err := r.sessionQuery(r.db).Select("id", "active_leaf_id").Where("id = ?", sessionID).First(&session).Error; err != nil {
+		return "", err
+	}
+	if session.ActiveLeafID != "" {
+		return session.ActiveLeafID, nil
+	}
+
+	var leafID string
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		var messages []*model.ChatMessage
+		if err := tx.Select("id", "parent_id").Where("session_id = ?", sessionID).
+			Order("created_at ASC").Find(&messages).Error; err != nil {
+			return err
+		}
+		for i, msg := range messages {
+			if i > 0 && msg.ParentID == "" {
+				if err := tx.Model(&model.ChatMessage{}).Where("id = ?", msg.ID).
+					Update("parent_id", messages[i-1].ID).Error; err != nil {
+					return err
+				}
+			}
+			leafID = msg.ID
+		}
+		if leafID == "" {
+			return nil
+		}
+		return tx.Model(&model.ChatSession{}).Where("id = ?", sessionID).
+			Update("active_leaf_id", leafID).Error
+	})
+	return leafID, err
+}
+
+// UpdateActiveLeaf 切换会话的当前叶子
+func (r *ChatRepository) UpdateActiveLeaf(sessionID, leafID string) error {
+	return r.sessionQuery(r.db).Where("id = ?", sessionID).
+		Update("active_leaf_id", leafID).Error
+}
+
+// GetMessagePath 获取从根消息到指定消息的路径（按时间顺序），leafID 为空时返回空路径
+func (r *ChatRepository) GetMessagePath(sessionID, leafID string) ([]*model.ChatMessage, error) {
+	var messages []*model.ChatMessage
+	if leafID == "" {
+		return messages, nil
+	}
+	if err := r.checkSession(r.db, sessionID); err != nil {
+		return nil, err
+	}
+	err := r.db.Raw(`
+		WITH RECURSIVE path AS (
+			SELECT * FROM chat_messages WHERE id = ? AND session_id = ?
+			UNION ALL
+			SELECT m.* FROM chat_messages m JOIN path p ON m.id = p.parent_id AND m.session_id = p.session_id
+		)
+		SELECT * FROM path ORDER BY created_at ASC`, leafID, sessionID).Scan(&messages).Error
+	return messages, err
+}
+
+// ListChildMessages 获取指定消息的子消息（按时间顺序），parentID 为空时返回根消息
+func (r *ChatRepository) ListChildMessages(sessionID, parentID string) ([]*model.ChatMessage, error) {
+	var messages []*model.ChatMessage
+	err := r.messageQuery(r.db).Where("session_id = ? AND parent_id = ?", sessionID, parentID).
+		Order("created_at ASC").Find(&messages).Error
+	return messages, err
+}
+
+// GetLatestLeaf 从指定消息沿最新的子消息向下，返回该分支的叶子
+func (r *ChatRepository) GetLatestLeaf(sessionID, messageID string) (string, error) {
+	leafID := messageID
+	for {
+		var child model.ChatMessage
+		err := r.messageQuery(r.db).Select("id").Where("session_id = ? AND parent_id = ?", sessionID, leafID).
+			Order("created_at DESC").Limit(1).Find(&child).Error
+		if err != nil {
+			return "", err
+		}
+		if child.ID == "" {
+			return leafID, nil
+		}
+		leafID = child.ID
+	}
+}
+
+// ========== 全文检索 ==========
+
+// messageMatchSQL 消息检索文本匹配条件，与 idx_chat_messages_search 索引表达式一致
+const messageMatchSQL = "to_tsvector('simple', coalesce(search_tokens, '')) @@ plainto_tsquery('simple', ?)"
+
+// SessionSearchFilter 会话检索条件
+type SessionSearchFilter struct {
+	Tokens   string   // 分词后的检索文本，匹配消息内容
+	Keywords []string // 原始关键词（至少一个），全部出现在标题中即匹配
+	AgentID  string
+	Status   string
+	From     *time.Time // 命中消息（标题命中时为会话）的创建时间范围
+	To       *time.Time
+}
+
+// SearchSessions 按标题或消息内容检索会话，按最近更新排序
+func (r *ChatRepository) SearchSessions(filter *SessionSearchFilter, offset, limit int) ([]*model.ChatSession, int64, error) {
+	var sessions []*model.ChatSession
+	var total int64
+
+	titleMatch := r.db
+	for _, keyword := range filter.Keywords {
+		titleMatch = titleMatch.Where(`chat_sessions.title ILIKE ? ESCAPE '\'`, "%"+escapeLike(keyword)+"%")
+	}
+	messageMatch := r.db.Table("chat_messages").Select("1").
+		Where("chat_messages.session_id = chat_sessions.id").
+		Where(messageMatchSQL, filter.Tokens)
+	if filter.From != nil {
+		titleMatch = titleMatch.Where("chat_sessions.created_at >= ?", *filter.From)
+		messageMatch = messageMatch.Where("chat_messages.created_at >= ?", *filter.From)
+	}
+	if filter.To != nil {
+		titleMatch = titleMatch.Where("chat_sessions.created_at < ?", *filter.To)
+		messageMatch = messageMatch.Where("chat_messages.created_at < ?", *filter.To)
+	}
+
+	query := r.sessionQuery(r.db).Where(titleMatch.Or("EXISTS (?)", messageMatch))
+	if filter.AgentID != "" {
+		query = query.Where("chat_sessions.agent_id = ?", filter.AgentID)
+	}
+	if filter.Status != "" {
+		query = query.Where("chat_sessions.status = ?", filter.Status)
+	}
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	err := query.Omit("summary").Order("chat_sessions.updated_at DESC").Offset(offset).Limit(limit).Find(&sessions).Error
+	return sessions, total, err
+}
+
+// likeEscaper 转义 LIKE 模式中的通配符和转义符
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// escapeLike 转义关键词，使其在 LIKE 模式中按字面匹配
+func escapeLike(s string) string {
+	return likeEscaper.Replace(s)
+}
+
+// SearchMessages 获取各会话中命中检索的消息，每个会话按相关度取前 perSession 条
+func (r *ChatRepository) SearchMessages(sessionIDs []string, filter *SessionSearchFilter, perSession int) ([]*model.ChatMessage, error) {
+	var messages []*model.ChatMessage
+	if len(sessionIDs) == 0 || filter.Tokens == "" {
+		return messages, nil
+	}
+
+	ranked := r.messageQuery(r.db).
+		Select("chat_messages.*, ROW_NUMBER() OVER (PARTITION BY session_id ORDER BY "+
+			"ts_rank(to_tsvector('simple', coalesce(search_tokens, '')), plainto_tsquery('simple', ?)) DESC, created_at DESC) AS rn", filter.Tokens).
+		Where("session_id IN ?", sessionIDs).
+		Where(messageMatchSQL, filter.Tokens)
+	if filter.From != nil {
+		ranked = ranked.Where("created_at >= ?", *filter.From)
+	}
+	if filter.To != nil {
+		ranked = ranked.Where("created_at < ?", *filter.To)
+	}
+
+	err := r.db.Table("(?) AS ranked", ranked).Where("rn <= ?", perSession).
+		Order("session_id, rn").Find(&messages).Error
+	return messages, err
 }
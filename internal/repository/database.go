@@ -80,5 +80,50 @@ func (db *DB) Ping(ctx context.Context) error {
 
 // autoMigrate 自动迁移
 func autoMigrate(db *gorm.DB) error {
-	return db.AutoMigrate(model.AllModels...)
+	if err := db.AutoMigrate(model.AllModels...); err != nil {
+		return err
+	}
+	if err := migrateSessionTenant(db); err != nil {
+		return err
+	}
+	return migrateChatSearch(db)
+}
+
+// migrateSessionTenant 为升级前的会话（tenant_id 为 NULL）回填所属用户的租户
+func migrateSessionTenant(db *gorm.DB) error {
+	err := db.Exec(`UPDATE chat_sessions SET tenant_id = COALESCE(
+		(SELECT users.tenant_id FROM users WHERE users.id = chat_sessions.user_id), '')
+		WHERE tenant_id IS NULL`).Error
+	if err != nil {
+		return fmt.Errorf("failed to backfill session tenant: %w", err)
+	}
+	return nil
+}
+
+// searchBackfillBatch 回填检索文本的批大小
+const searchBackfillBatch = 500
+
+// migrateChatSearch 建立消息全文检索索引，并为升级前的消息回填检索文本
+func migrateChatSearch(db *gorm.DB) error {
+	if err := db.Exec(`CREATE INDEX IF NOT EXISTS idx_chat_messages_search
+		ON chat_messages USING GIN (to_tsvector('simple', coalesce(search_tokens, '')))`).Error; err != nil {
+		return fmt.Errorf("failed to create search index: %w", err)
+	}
+
+	for {
+		var messages []*model.ChatMessage
+		if err := db.Select("id", "role", "content").Where("search_tokens IS NULL").
+			Limit(searchBackfillBatch).Find(&messages).Error; err != nil {
+			return fmt.Errorf("failed to load messages for search backfill: %w", err)
+		}
+		for _, msg := range messages {
+			if err := db.Model(&model.ChatMessage{}).Where("id = ?", msg.ID).
+				Update("search_tokens", model.MessageSearchTokens(msg.Role, msg.Content)).Error; err != nil {
+				return fmt.Errorf("failed to backfill search tokens: %w", err)
+			}
+		}
+		if len(messages) < searchBackfillBatch {
+			return nil
+		}
+	}
 }
@@ -0,0 +1,103 @@
+// Package repository 数据访问层
+package repository
+
+import (
+	"github.com/ashwinyue/next-ai/internal/model"
+	"gorm.io/gorm"
+)
+
+// FAQRepository FAQ 仓库
+type FAQRepository struct {
+	db *gorm.DB
+}
+
+// NewFAQRepository 创建 FAQ 仓库
+func NewFAQRepository(db *gorm.DB) *FAQRepository {
+	return &FAQRepository{db: db}
+}
+
+// Create 创建 FAQ
+func (r *FAQRepository) Create(faq *model.FAQ) error {
+	return r.db.Create(faq).Error
+}
+
+// CreateBatch 批量创建 FAQ
+func (r *FAQRepository) CreateBatch(faqs []*model.FAQ) error {
+	if len(faqs) == 0 {
+		return nil
+	}
+	return r.db.CreateInBatches(faqs, 100).Error
+}
+
+// GetByID 根据 ID 获取 FAQ
+func (r *FAQRepository) GetByID(id string) (*model.FAQ, error) {
+	var faq model.FAQ
+	err := r.db.Where("id = ?", id).First(&faq).Error
+	if err != nil {
+		return nil, err
+	}
+	return &faq, nil
+}
+
+// List 分页列出 FAQ
+func (r *FAQRepository) List(tenantID, category string, activeOnly bool, offset, limit int) ([]*model.FAQ, int64, error) {
+	var faqs []*model.FAQ
+	var total int64
+
+	query := r.db.Model(&model.FAQ{})
+	if tenantID != "" {
+		query = query.Where("tenant_id = ?", tenantID)
+	}
+	if category != "" {
+		query = query.Where("category = ?", category)
+	}
+	if activeOnly {
+		query = query.Where("is_active = ?", true)
+	}
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	err := query.Order("created_at DESC").Offset(offset).Limit(limit).Find(&faqs).Error
+	return faqs, total, err
+}
+
+// ListActive 列出租户全部启用的 FAQ（用于匹配）
+func (r *FAQRepository) ListActive(tenantID string) ([]*model.FAQ, error) {
+	var faqs []*model.FAQ
+	query := r.db.Where("is_active = ?", true)
+	if tenantID != "" {
+		query = query.Where("tenant_id = ?", tenantID)
+	}
+	err := query.Find(&faqs).Error
+	return faqs, err
+}
+
+// SearchByKeyword 按关键词模糊搜索启用的 FAQ（问题、相似问法、答案）
+func (r *FAQRepository) SearchByKeyword(tenantID, keyword string, limit int) ([]*model.FAQ, error) {
+	var faqs []*model.FAQ
+	pattern := "%" + keyword + "%"
+	query := r.db.Where("is_active = ?", true).
+		Where("question ILIKE ? OR answer ILIKE ? OR similar_questions::text ILIKE ?", pattern, pattern, pattern)
+	if tenantID != "" {
+		query = query.Where("tenant_id = ?", tenantID)
+	}
+	err := query.Order("hit_count DESC").Limit(limit).Find(&faqs).Error
+	return faqs, err
+}
+
+// Update 更新 FAQ
+func (r *FAQRepository) Update(faq *model.FAQ) error {
+	return r.db.Save(faq).Error
+}
+
+// Delete 删除 FAQ
+func (r *FAQRepository) Delete(id string) error {
+	return r.db.Where("id = ?", id).Delete(&model.FAQ{}).Error
+}
+
+// IncrementHitCount 增加命中次数
+func (r *FAQRepository) IncrementHitCount(id string) error {
+	return r.db.Model(&model.FAQ{}).Where("id = ?", id).
+		UpdateColumn("hit_count", gorm.Expr("hit_count + 1")).Error
+}
@@ -0,0 +1,161 @@
+// Package repository 数据访问层
+package repository
+
+import (
+	"github.com/ashwinyue/next-ai/internal/model"
+	"gorm.io/gorm"
+)
+
+// KnowledgeRepository 知识库仓库（知识库、文档、分块）
+type KnowledgeRepository struct {
+	db *gorm.DB
+}
+
+// NewKnowledgeRepository 创建知识库仓库
+func NewKnowledgeRepository(db *gorm.DB) *KnowledgeRepository {
+	return &KnowledgeRepository{db: db}
+}
+
+// ========== 知识库 ==========
+
+// CreateKnowledgeBase 创建知识库
+func (r *KnowledgeRepository) CreateKnowledgeBase(kb *model.KnowledgeBase) error {
+	return r.db.Create(kb).Error
+}
+
+// GetKnowledgeBaseByID 根据 ID 获取知识库
+func (r *KnowledgeRepository) GetKnowledgeBaseByID(id string) (*model.KnowledgeBase, error) {
+	var kb model.KnowledgeBase
+	err := r.db.Where("id = ?", id).First(&kb).Error
+	if err != nil {
+		return nil, err
+	}
+	return &kb, nil
+}
+
+// GetKnowledgeBaseByName 根据名称获取租户下的知识库
+func (r *KnowledgeRepository) GetKnowledgeBaseByName(tenantID, name string) (*model.KnowledgeBase, error) {
+	var kb model.KnowledgeBase
+	err := r.db.Where("tenant_id = ? AND name = ?", tenantID, name).First(&kb).Error
+	if err != nil {
+		return nil, err
+	}
+	return &kb, nil
+}
+
+// ListKnowledgeBases 列出租户的知识库
+func (r *KnowledgeRepository) ListKnowledgeBases(tenantID string, offset, limit int) ([]*model.KnowledgeBase, int64, error) {
+	var kbs []*model.KnowledgeBase
+	var total int64
+
+	query := r.db.Model(&model.KnowledgeBase{})
+	if tenantID != "" {
+		query = query.Where("tenant_id = ?", tenantID)
+	}
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	err := query.Order("created_at DESC").Offset(offset).Limit(limit).Find(&kbs).Error
+	return kbs, total, err
+}
+
+// UpdateKnowledgeBase 更新知识库
+func (r *KnowledgeRepository) UpdateKnowledgeBase(kb *model.KnowledgeBase) error {
+	return r.db.Save(kb).Error
+}
+
+// DeleteKnowledgeBase 删除知识库及其文档和分块
+func (r *KnowledgeRepository) DeleteKnowledgeBase(id string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&model.Chunk{}, "knowledge_base_id = ?", id).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&model.Knowledge{}, "knowledge_base_id = ?", id).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&model.KnowledgeBase{}, "id = ?", id).Error
+	})
+}
+
+// CountKnowledgeByBase 统计知识库下的文档数量
+func (r *KnowledgeRepository) CountKnowledgeByBase(kbID string) (int64, error) {
+	var count int64
+	err := r.db.Model(&model.Knowledge{}).Where("knowledge_base_id = ?", kbID).Count(&count).Error
+	return count, err
+}
+
+// ========== 文档 ==========
+
+// CreateKnowledge 创建文档
+func (r *KnowledgeRepository) CreateKnowledge(k *model.Knowledge) error {
+	return r.db.Create(k).Error
+}
+
+// GetKnowledgeByID 根据 ID 获取文档
+func (r *KnowledgeRepository) GetKnowledgeByID(id string) (*model.Knowledge, error) {
+	var k model.Knowledge
+	err := r.db.Where("id = ?", id).First(&k).Error
+	if err != nil {
+		return nil, err
+	}
+	return &k, nil
+}
+
+// ListKnowledgeByBase 列出知识库下的文档
+func (r *KnowledgeRepository) ListKnowledgeByBase(kbID string, offset, limit int) ([]*model.Knowledge, int64, error) {
+	var items []*model.Knowledge
+	var total int64
+
+	query := r.db.Model(&model.Knowledge{}).Where("knowledge_base_id = ?", kbID)
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	err := query.Order("created_at DESC").Offset(offset).Limit(limit).Find(&items).Error
+	return items, total, err
+}
+
+// UpdateKnowledgeStatus 更新文档处理状态
+func (r *KnowledgeRepository) UpdateKnowledgeStatus(id string, status model.ParseStatus, errMsg string, chunkCount int) error {
+	return r.db.Model(&model.Knowledge{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"parse_status":  status,
+		"error_message": errMsg,
+		"chunk_count":   chunkCount,
+	}).Error
+}
+
+// DeleteKnowledge 删除文档及其分块
+func (r *KnowledgeRepository) DeleteKnowledge(id string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&model.Chunk{}, "knowledge_id = ?", id).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&model.Knowledge{}, "id = ?", id).Error
+	})
+}
+
+// ========== 分块 ==========
+
+// ReplaceChunks 替换文档的全部分块
+func (r *KnowledgeRepository) ReplaceChunks(knowledgeID string, chunks []*model.Chunk) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&model.Chunk{}, "knowledge_id = ?", knowledgeID).Error; err != nil {
+			return err
+		}
+		if len(chunks) == 0 {
+			return nil
+		}
+		return tx.CreateInBatches(chunks, 100).Error
+	})
+}
+
+// GetChunksByIDs 根据 ID 批量获取分块
+func (r *KnowledgeRepository) GetChunksByIDs(ids []string) ([]*model.Chunk, error) {
+	var chunks []*model.Chunk
+	if len(ids) == 0 {
+		return chunks, nil
+	}
+	err := r.db.Where("id IN ?", ids).Find(&chunks).Error
+	return chunks, err
+}
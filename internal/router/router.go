@@ -44,16 +44,38 @@ func SetupRouter(h *handler.Handlers, svc *service.Services) *gin.Engine {
 		{
 			sessions.POST("", h.Chat.CreateSession)
 			sessions.GET("", h.Chat.ListSessions)
+			sessions.GET("/search", h.Chat.SearchSessions)
+			sessions.GET("/trash", h.Chat.ListTrash)
+			sessions.DELETE("/trash", h.Chat.EmptyTrash)
+			sessions.GET("/export", h.Chat.ExportSessions)
+			sessions.POST("/import", h.Chat.ImportSession)
 			sessions.GET("/:id", h.Chat.GetSession)
 			sessions.PUT("/:id", h.Chat.UpdateSession)
 			sessions.DELETE("/:id", h.Chat.DeleteSession)
+			sessions.GET("/:id/export", h.Chat.ExportSession)
+			sessions.POST("/:id/archive", h.Chat.ArchiveSession)
+			sessions.POST("/:id/unarchive", h.Chat.UnarchiveSession)
+			sessions.POST("/:id/pin", h.Chat.PinSession)
+			sessions.DELETE("/:id/pin", h.Chat.UnpinSession)
+			sessions.POST("/:id/restore", h.Chat.RestoreSession)
 			sessions.POST("/:id/messages", h.Chat.SendMessage)
 			sessions.GET("/:id/messages", h.Chat.GetMessages)
+			sessions.GET("/:id/messages/:message_id/branches", h.Chat.ListMessageBranches)
+			sessions.POST("/:id/messages/:message_id/checkout", h.Chat.SwitchBranch)
+			sessions.POST("/:id/messages/:message_id/edit", h.Chat.EditMessage)
+			sessions.POST("/:id/messages/:message_id/regenerate", h.Chat.RegenerateMessage)
 			sessions.POST("/:id/title", h.Chat.GenerateTitle)
 
 			// 会话流控制（WeKnora API 兼容）
 			sessions.POST("/:id/stop", h.Chat.StopSession)
 			sessions.GET("/continue-stream/:id", h.Chat.ContinueStream)
+
+			// plan-execute 模式的计划
+			sessions.GET("/:id/plan", h.Chat.GetSessionPlan)
+
+			// 工具调用审批（Human-in-the-loop）
+			sessions.GET("/:id/approval", h.Chat.GetPendingApproval)
+			sessions.POST("/:id/approve", h.Chat.ApproveToolCall)
 		}
 
 		// WeKnora API 兼容 - 聊天接口
@@ -76,11 +98,17 @@ func SetupRouter(h *handler.Handlers, svc *service.Services) *gin.Engine {
 			agents.GET("/builtin", h.Agent.ListBuiltinAgents)
 			agents.POST("/builtin/init", h.Agent.InitBuiltinAgents)
 			agents.GET("/placeholders", h.Agent.GetPlaceholders)
+			agents.POST("/import", h.Agent.ImportAgent)
 			agents.GET("/:id", h.Agent.GetAgent)
 			agents.GET("/:id/config", h.Agent.GetAgentConfig)
 			agents.PUT("/:id", h.Agent.UpdateAgent)
 			agents.DELETE("/:id", h.Agent.DeleteAgent)
 			agents.POST("/:id/copy", h.Agent.CopyAgent)
+			agents.GET("/:id/versions", h.Agent.ListAgentVersions)
+			agents.GET("/:id/versions/diff", h.Agent.DiffAgentVersions)
+			agents.POST("/:id/versions/:version/publish", h.Agent.PublishAgentVersion)
+			agents.POST("/:id/rollback", h.Agent.RollbackAgent)
+			agents.GET("/:id/export", h.Agent.ExportAgent)
 			agents.POST("/:id/run", h.Agent.RunAgent)
 			agents.POST("/:id/stream", h.Agent.StreamAgent)
 		}
@@ -162,6 +190,38 @@ func SetupRouter(h *handler.Handlers, svc *service.Services) *gin.Engine {
 			files.DELETE("/:id", h.File.DeleteFile)
 		}
 
+		// Knowledge 知识库
+		knowledgeBases := v1.Group("/knowledge-bases")
+		{
+			knowledgeBases.POST("", h.Knowledge.CreateKnowledgeBase)
+			knowledgeBases.GET("", h.Knowledge.ListKnowledgeBases)
+			knowledgeBases.GET("/:id", h.Knowledge.GetKnowledgeBase)
+			knowledgeBases.PUT("/:id", h.Knowledge.UpdateKnowledgeBase)
+			knowledgeBases.DELETE("/:id", h.Knowledge.DeleteKnowledgeBase)
+			knowledgeBases.POST("/:id/documents", h.Knowledge.UploadDocument)
+			knowledgeBases.GET("/:id/documents", h.Knowledge.ListDocuments)
+		}
+
+		// Documents 知识库文档
+		documents := v1.Group("/documents")
+		{
+			documents.GET("/:id", h.Knowledge.GetDocument)
+			documents.DELETE("/:id", h.Knowledge.DeleteDocument)
+		}
+
+		// FAQ 常见问题
+		faqs := v1.Group("/faqs")
+		{
+			faqs.POST("", h.FAQ.CreateFAQ)
+			faqs.GET("", h.FAQ.ListFAQs)
+			faqs.GET("/active", h.FAQ.ListActiveFAQs)
+			faqs.GET("/search", h.FAQ.SearchFAQs)
+			faqs.POST("/import", h.FAQ.ImportFAQs)
+			faqs.GET("/:id", h.FAQ.GetFAQ)
+			faqs.PUT("/:id", h.FAQ.UpdateFAQ)
+			faqs.DELETE("/:id", h.FAQ.DeleteFAQ)
+		}
+
 		// System 系统管理（WeKnora API 兼容）
 		system := v1.Group("/system")
 		{
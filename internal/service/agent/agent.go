@@ -3,14 +3,22 @@ package agent
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"log"
+	"sync"
 	"time"
 
 	"github.com/ashwinyue/next-ai/internal/config"
 	agentmodel "github.com/ashwinyue/next-ai/internal/model"
 	"github.com/ashwinyue/next-ai/internal/repository"
-	"github.com/cloudwego/eino-ext/components/model/openai"
+	"github.com/ashwinyue/next-ai/internal/service/database"
+	"github.com/ashwinyue/next-ai/internal/service/knowledge"
+	svcmcp "github.com/ashwinyue/next-ai/internal/service/mcp"
+	svcModel "github.com/ashwinyue/next-ai/internal/service/model"
+	"github.com/ashwinyue/next-ai/internal/service/session"
+	svctypes "github.com/ashwinyue/next-ai/internal/service/types"
 	"github.com/cloudwego/eino/adk"
 	"github.com/cloudwego/eino/components/model"
 	"github.com/cloudwego/eino/components/tool"
@@ -26,6 +34,14 @@ type Service struct {
 	repo     *repository.Repositories
 	cfg      *config.Config
 	allTools []tool.BaseTool
+	mcpSvc   *svcmcp.Service // 解析 Agent.Tools 中的 mcp:<service>/<tool> 引用
+	modelSvc *svcModel.Service
+
+	checkpointStore compose.CheckPointStore // 工具审批中断的检查点存储，为 nil 时不支持审批
+	stateMgr        *session.StateManager   // 会话状态（plan-execute 的计划），可为 nil
+	streams         *session.Manager        // 会话流注册（停止和续传），可为 nil
+	contextCfg      *session.Config         // 上下文窗口（token 预算和压缩）
+	summarizing     sync.Map                // 正在后台总结的会话 ID
 }
 
 // NewService 创建 Agent 服务
@@ -33,25 +49,48 @@ func NewService(
 	repo *repository.Repositories,
 	cfg *config.Config,
 	allTools []tool.BaseTool,
+	mcpSvc *svcmcp.Service,
+	modelSvc *svcModel.Service,
+	checkpointStore compose.CheckPointStore,
+	stateMgr *session.StateManager,
+	streams *session.Manager,
+	contextCfg *session.Config,
 ) *Service {
+	if contextCfg == nil {
+		contextCfg = session.DefaultConfig()
+	}
+
 	return &Service{
-		repo:     repo,
-		cfg:      cfg,
-		allTools: allTools,
+		repo:            repo,
+		cfg:             cfg,
+		allTools:        allTools,
+		mcpSvc:          mcpSvc,
+		modelSvc:        modelSvc,
+		checkpointStore: checkpointStore,
+		stateMgr:        stateMgr,
+		streams:         streams,
+		contextCfg:      contextCfg,
 	}
 }
 
 // CreateAgentRequest 创建 Agent 请求
 type CreateAgentRequest struct {
-	Name         string   `json:"name" binding:"required"`
-	Description  string   `json:"description"`
-	Avatar       string   `json:"avatar,omitempty"`
-	AgentMode    string   `json:"agent_mode,omitempty"` // smart-reasoning（默认）
-	SystemPrompt string   `json:"system_prompt"`
-	Tools        []string `json:"tools"`
-	MaxIter      int      `json:"max_iterations"`
-	Temperature  float64  `json:"temperature,omitempty"`
-	Model        string   `json:"model"`
+	Name           string   `json:"name" binding:"required"`
+	Description    string   `json:"description"`
+	Avatar         string   `json:"avatar,omitempty"`
+	AgentMode      string   `json:"agent_mode,omitempty"` // smart-reasoning（默认）、supervisor、plan-execute
+	SystemPrompt   string   `json:"system_prompt"`
+	Tools          []string `json:"tools"`
+	KnowledgeBases []string `json:"knowledge_bases"` // 绑定的知识库 ID
+	ApprovalTools  []string `json:"approval_tools"`  // 调用前需要人工审批的工具名称
+	SubAgents      []string `json:"sub_agents"`      // supervisor 模式下的子 Agent ID
+	FallbackModels []string `json:"fallback_models"` // 主模型失败时按顺序尝试的备用模型 ID
+	MaxIter        int      `json:"max_iterations"`
+	Temperature    float64  `json:"temperature,omitempty"`
+	Model          string   `json:"model"`
+	ModelID        string   `json:"model_id,omitempty"`     // models 表中的对话模型 ID
+	VersionNote    string   `json:"version_note,omitempty"` // 本次修改生成的版本说明
+	Publish        bool     `json:"publish,omitempty"`      // 更新时立即发布新版本（默认只保存为最新版本）
 }
 
 // CreateAgent 创建 Agent
@@ -66,9 +105,9 @@ func (s *Service) CreateAgent(ctx context.Context, req *CreateAgentRequest) (*ag
 		agentMode = agentmodel.AgentModeSmartReasoning
 	}
 
-	// 验证模式（仅支持 smart-reasoning）
-	if agentMode != agentmodel.AgentModeSmartReasoning {
-		return nil, fmt.Errorf("invalid agent_mode: %s, only 'smart-reasoning' is supported", agentMode)
+	// 验证模式及子 Agent 配置
+	if err := s.validateAgentMode(agentMode, req.SubAgents, ""); err != nil {
+		return nil, err
 	}
 
 	// 构建 Tools JSON
@@ -77,6 +116,33 @@ func (s *Service) CreateAgent(ctx context.Context, req *CreateAgentRequest) (*ag
 		toolsJSON, _ = json.Marshal(req.Tools)
 	}
 
+	// 构建 KnowledgeBases JSON
+	var kbJSON datatypes.JSON
+	if len(req.KnowledgeBases) > 0 {
+		kbJSON, _ = json.Marshal(req.KnowledgeBases)
+	}
+
+	// 构建 ApprovalTools JSON
+	var approvalJSON datatypes.JSON
+	if len(req.ApprovalTools) > 0 {
+		approvalJSON, _ = json.Marshal(req.ApprovalTools)
+	}
+
+	// 构建 SubAgents JSON
+	var subAgentsJSON datatypes.JSON
+	if len(req.SubAgents) > 0 {
+		subAgentsJSON, _ = json.Marshal(req.SubAgents)
+	}
+
+	// 构建 FallbackModels JSON
+	if err := s.validateFallbackModels(ctx, req.FallbackModels); err != nil {
+		return nil, err
+	}
+	var fallbackJSON datatypes.JSON
+	if len(req.FallbackModels) > 0 {
+		fallbackJSON, _ = json.Marshal(req.FallbackModels)
+	}
+
 	// 构建 ModelConfig
 	modelConfig := agentmodel.ModelConfig{
 		Provider: s.cfg.AI.Provider,
@@ -85,25 +151,37 @@ func (s *Service) CreateAgent(ctx context.Context, req *CreateAgentRequest) (*ag
 	if modelConfig.Model == "" {
 		modelConfig.Model = s.cfg.AI.OpenAI.Model
 	}
+	if req.ModelID != "" {
+		if err := s.applyModelID(ctx, &modelConfig, req.ModelID); err != nil {
+			return nil, err
+		}
+	}
 
 	agent := &agentmodel.Agent{
-		ID:           uuid.New().String(),
-		Name:         req.Name,
-		Description:  req.Description,
-		Avatar:       req.Avatar,
-		IsBuiltin:    false,
-		AgentMode:    agentMode,
-		SystemPrompt: req.SystemPrompt,
-		ModelConfig:  modelConfig,
-		Tools:        toolsJSON,
-		MaxIter:      req.MaxIter,
-		Temperature:  req.Temperature,
-		IsActive:     true,
-		CreatedAt:    time.Now(),
-		UpdatedAt:    time.Now(),
-	}
-
-	if err := s.repo.Agent.Create(agent); err != nil {
+		ID:             uuid.New().String(),
+		Name:           req.Name,
+		Description:    req.Description,
+		Avatar:         req.Avatar,
+		IsBuiltin:      false,
+		AgentMode:      agentMode,
+		SystemPrompt:   req.SystemPrompt,
+		ModelConfig:    modelConfig,
+		Tools:          toolsJSON,
+		KnowledgeBases: kbJSON,
+		ApprovalTools:  approvalJSON,
+		SubAgents:      subAgentsJSON,
+		FallbackModels: fallbackJSON,
+		MaxIter:        req.MaxIter,
+		Temperature:    req.Temperature,
+		IsActive:       true,
+		CreatedAt:      time.Now(),
+		UpdatedAt:      time.Now(),
+	}
+
+	// 首个版本直接发布
+	version := newVersion(agent, initialVersionNote)
+	agent.PublishedVersion = version.Version
+	if err := s.repo.Agent.CreateWithVersion(agent, version); err != nil {
 		return nil, fmt.Errorf("failed to create agent: %w", err)
 	}
 
@@ -151,6 +229,15 @@ func (s *Service) UpdateAgent(ctx context.Context, id string, req *CreateAgentRe
 		return nil, fmt.Errorf("builtin agent cannot be updated")
 	}
 
+	// 未版本化的 Agent 先将当前配置记录为已发布的首个版本，保证运行中的会话不受本次修改影响
+	var versions []*agentmodel.AgentVersion
+	if agentModel.LatestVersion == 0 {
+		base := newVersion(agentModel, initialVersionNote)
+		agentModel.PublishedVersion = base.Version
+		versions = append(versions, base)
+	}
+	previous := agentModel.Config()
+
 	agentModel.Name = req.Name
 	agentModel.Description = req.Description
 	agentModel.Avatar = req.Avatar
@@ -159,13 +246,18 @@ func (s *Service) UpdateAgent(ctx context.Context, id string, req *CreateAgentRe
 	agentModel.Temperature = req.Temperature
 	agentModel.UpdatedAt = time.Now()
 
-	// 更新 AgentMode（仅支持 smart-reasoning）
+	// 更新 AgentMode 及子 Agent
 	if req.AgentMode != "" {
-		if req.AgentMode != agentmodel.AgentModeSmartReasoning {
-			return nil, fmt.Errorf("invalid agent_mode: %s, only 'smart-reasoning' is supported", req.AgentMode)
-		}
 		agentModel.AgentMode = req.AgentMode
 	}
+	if err := s.validateAgentMode(agentModel.AgentMode, req.SubAgents, agentModel.ID); err != nil {
+		return nil, err
+	}
+	var subAgentsJSON datatypes.JSON
+	if len(req.SubAgents) > 0 {
+		subAgentsJSON, _ = json.Marshal(req.SubAgents)
+	}
+	agentModel.SubAgents = subAgentsJSON
 
 	// 更新 Tools
 	var toolsJSON datatypes.JSON
@@ -174,12 +266,53 @@ func (s *Service) UpdateAgent(ctx context.Context, id string, req *CreateAgentRe
 	}
 	agentModel.Tools = toolsJSON
 
+	// 更新 KnowledgeBases
+	var kbJSON datatypes.JSON
+	if len(req.KnowledgeBases) > 0 {
+		kbJSON, _ = json.Marshal(req.KnowledgeBases)
+	}
+	agentModel.KnowledgeBases = kbJSON
+
+	// 更新 ApprovalTools
+	var approvalJSON datatypes.JSON
+	if len(req.ApprovalTools) > 0 {
+		approvalJSON, _ = json.Marshal(req.ApprovalTools)
+	}
+	agentModel.ApprovalTools = approvalJSON
+
+	// 更新 FallbackModels
+	if err := s.validateFallbackModels(ctx, req.FallbackModels); err != nil {
+		return nil, err
+	}
+	var fallbackJSON datatypes.JSON
+	if len(req.FallbackModels) > 0 {
+		fallbackJSON, _ = json.Marshal(req.FallbackModels)
+	}
+	agentModel.FallbackModels = fallbackJSON
+
 	// 更新 ModelConfig
 	if req.Model != "" {
 		agentModel.ModelConfig.Model = req.Model
 	}
+	if req.ModelID != "" {
+		if err := s.applyModelID(ctx, &agentModel.ModelConfig, req.ModelID); err != nil {
+			return nil, err
+		}
+	}
+
+	// 配置有变化时生成新版本，发布后新会话才会使用
+	changes, err := diffConfigs(previous, agentModel.Config())
+	if err != nil {
+		return nil, err
+	}
+	if len(changes) > 0 {
+		versions = append(versions, newVersion(agentModel, req.VersionNote))
+	}
+	if req.Publish {
+		agentModel.PublishedVersion = agentModel.LatestVersion
+	}
 
-	if err := s.repo.Agent.Update(agentModel); err != nil {
+	if err := s.repo.Agent.UpdateWithVersions(agentModel, versions...); err != nil {
 		return nil, fmt.Errorf("failed to update agent: %w", err)
 	}
 
@@ -217,23 +350,29 @@ func (s *Service) CopyAgent(ctx context.Context, id string) (*agentmodel.Agent,
 
 	// 复制配置，生成新 ID
 	newAgent := &agentmodel.Agent{
-		ID:           uuid.New().String(),
-		Name:         sourceAgent.Name + " (副本)",
-		Description:  sourceAgent.Description,
-		Avatar:       sourceAgent.Avatar,
-		IsBuiltin:    false, // 复制的 Agent 不是内置的
-		AgentMode:    sourceAgent.AgentMode,
-		SystemPrompt: sourceAgent.SystemPrompt,
-		ModelConfig:  sourceAgent.ModelConfig,
-		Tools:        sourceAgent.Tools,
-		MaxIter:      sourceAgent.MaxIter,
-		Temperature:  sourceAgent.Temperature,
-		IsActive:     true,
-		CreatedAt:    time.Now(),
-		UpdatedAt:    time.Now(),
-	}
-
-	if err := s.repo.Agent.Create(newAgent); err != nil {
+		ID:             uuid.New().String(),
+		Name:           sourceAgent.Name + " (副本)",
+		Description:    sourceAgent.Description,
+		Avatar:         sourceAgent.Avatar,
+		IsBuiltin:      false, // 复制的 Agent 不是内置的
+		AgentMode:      sourceAgent.AgentMode,
+		SystemPrompt:   sourceAgent.SystemPrompt,
+		ModelConfig:    sourceAgent.ModelConfig,
+		Tools:          sourceAgent.Tools,
+		KnowledgeBases: sourceAgent.KnowledgeBases,
+		ApprovalTools:  sourceAgent.ApprovalTools,
+		SubAgents:      sourceAgent.SubAgents,
+		FallbackModels: sourceAgent.FallbackModels,
+		MaxIter:        sourceAgent.MaxIter,
+		Temperature:    sourceAgent.Temperature,
+		IsActive:       true,
+		CreatedAt:      time.Now(),
+		UpdatedAt:      time.Now(),
+	}
+
+	version := newVersion(newAgent, fmt.Sprintf("复制自 %s", sourceAgent.Name))
+	newAgent.PublishedVersion = version.Version
+	if err := s.repo.Agent.CreateWithVersion(newAgent, version); err != nil {
 		return nil, fmt.Errorf("failed to create copied agent: %w", err)
 	}
 
@@ -244,107 +383,138 @@ func (s *Service) CopyAgent(ctx context.Context, id string) (*agentmodel.Agent,
 type RunRequest struct {
 	Query     string `json:"query" binding:"required"`
 	SessionID string `json:"session_id"`
+	TenantID  string `json:"-"` // 由 handler 从认证上下文填充
+	UserID    string `json:"-"`
+
+	branch *branchPoint // 编辑或重新生成时的分支位置，nil 表示接在会话当前叶子之后
+}
+
+// owner 请求方，用于校验会话归属
+func (r *RunRequest) owner() agentmodel.Owner {
+	return agentmodel.Owner{TenantID: r.TenantID, UserID: r.UserID}
 }
 
 // RunResponse 运行响应
 type RunResponse struct {
 	Answer string `json:"answer"`
+	Model  string `json:"model,omitempty"` // 实际应答的模型
 }
 
-// StreamEvent 流式事件
-type StreamEvent struct {
-	Type     string `json:"type"` // start, message, tool_call, error, end
-	Data     string `json:"data"`
-	ToolName string `json:"tool_name,omitempty"`
+// StreamEvent 流式事件（与 chat 共用的事件协议）
+type StreamEvent = svctypes.StreamEvent
+
+// applyModelID 校验并绑定 models 表中的对话模型
+func (s *Service) applyModelID(ctx context.Context, modelConfig *agentmodel.ModelConfig, modelID string) error {
+	m, err := s.modelSvc.GetModelByID(ctx, modelID)
+	if err != nil {
+		return fmt.Errorf("model not found: %w", err)
+	}
+	if m.Type != agentmodel.ModelTypeChatModel {
+		return fmt.Errorf("model %s is not a chat model", m.Name)
+	}
+
+	modelConfig.ModelID = m.ID
+	modelConfig.Provider = string(m.Source)
+	modelConfig.Model = m.Name
+	return nil
 }
 
-// newToolCallingChatModel 创建支持工具调用的 ChatModel
-func (s *Service) newToolCallingChatModel(ctx context.Context, modelConfig agentmodel.ModelConfig) (model.ToolCallingChatModel, error) {
-	var apiKey, baseURL, modelName string
+// newToolCallingChatModel 创建 Agent 使用的 ChatModel
+// 主模型之后按顺序挂载 FallbackModels，调用失败时重试并回退
+func (s *Service) newToolCallingChatModel(ctx context.Context, agentModel *agentmodel.Agent) (model.ToolCallingChatModel, error) {
+	temperature := float32(0.7)
+	if agentModel.Temperature > 0 {
+		temperature = float32(agentModel.Temperature)
+	}
+	if temp, ok := agentModel.ModelConfig.Parameters["temperature"].(float64); ok {
+		temperature = float32(temp)
+	}
 
-	// 从 modelConfig 获取配置
-	if modelConfig.APIKey != "" {
-		apiKey = modelConfig.APIKey
+	chatCfg, err := s.resolveChatModelConfig(ctx, agentModel.ModelConfig)
+	if err != nil {
+		return nil, err
 	}
-	if modelConfig.BaseURL != "" {
-		baseURL = modelConfig.BaseURL
+	chatCfg.Temperature = &temperature
+	primary, err := svcModel.NewChatModel(ctx, chatCfg)
+	if err != nil {
+		return nil, err
 	}
-	if modelConfig.Model != "" {
-		modelName = modelConfig.Model
+	candidates := []modelCandidate{{name: chatCfg.Model, model: primary}}
+
+	for _, id := range getToolNames(agentModel.FallbackModels) {
+		fallbackCfg, err := s.modelSvc.ChatModelConfigFor(ctx, id)
+		if err != nil {
+			log.Printf("Warning: skip fallback model %s: %v", id, err)
+			continue
+		}
+		fallbackCfg.Temperature = &temperature
+		fallback, err := svcModel.NewChatModel(ctx, fallbackCfg)
+		if err != nil {
+			log.Printf("Warning: skip fallback model %s: %v", id, err)
+			continue
+		}
+		candidates = append(candidates, modelCandidate{name: fallbackCfg.Model, model: fallback})
 	}
 
-	// 如果没有提供，使用全局配置
-	if apiKey == "" || modelName == "" {
-		aiCfg := s.cfg.AI
-		switch aiCfg.Provider {
-		case "openai":
-			if apiKey == "" {
-				apiKey = aiCfg.OpenAI.APIKey
-			}
-			if baseURL == "" {
-				baseURL = aiCfg.OpenAI.BaseURL
-			}
-			if modelName == "" {
-				modelName = aiCfg.OpenAI.Model
-			}
-		case "alibaba", "qwen", "dashscope":
-			if apiKey == "" {
-				apiKey = aiCfg.Alibaba.AccessKeySecret
-			}
-			if baseURL == "" {
-				baseURL = "https://dashscope.aliyuncs.com/compatible-mode/v1"
-			}
-			if modelName == "" {
-				modelName = aiCfg.Alibaba.Model
-			}
-		case "deepseek":
-			if apiKey == "" {
-				apiKey = aiCfg.DeepSeek.APIKey
-			}
-			if baseURL == "" {
-				baseURL = aiCfg.DeepSeek.BaseURL
-			}
-			if modelName == "" {
-				modelName = aiCfg.DeepSeek.Model
-			}
-		default:
-			if apiKey == "" {
-				apiKey = aiCfg.OpenAI.APIKey
-			}
-			if baseURL == "" {
-				baseURL = aiCfg.OpenAI.BaseURL
-			}
-			if modelName == "" {
-				modelName = aiCfg.OpenAI.Model
+	return newFallbackChatModel(candidates), nil
+}
+
+// resolveChatModelConfig 解析主模型的连接参数
+// 优先级：ModelConfig.ModelID 指定的模型 > ModelConfig 内联的连接参数 >
+// models 表中的默认对话模型 > 全局 AI 配置
+func (s *Service) resolveChatModelConfig(ctx context.Context, modelConfig agentmodel.ModelConfig) (*svcModel.ChatModelConfig, error) {
+	var chatCfg *svcModel.ChatModelConfig
+	var err error
+	switch {
+	case modelConfig.ModelID != "":
+		chatCfg, err = s.modelSvc.ChatModelConfigFor(ctx, modelConfig.ModelID)
+	case modelConfig.APIKey != "":
+		chatCfg = &svcModel.ChatModelConfig{
+			BaseURL: modelConfig.BaseURL,
+			APIKey:  modelConfig.APIKey,
+			Model:   modelConfig.Model,
+		}
+	default:
+		chatCfg, err = s.modelSvc.ChatModelConfigFor(ctx, "")
+		if errors.Is(err, svcModel.ErrNoDefaultChatModel) {
+			chatCfg, err = svcModel.ChatModelConfigFromAIConfig(s.cfg.AI)
+			if err == nil && modelConfig.Model != "" {
+				chatCfg.Model = modelConfig.Model
 			}
 		}
 	}
-
-	if apiKey == "" {
-		return nil, fmt.Errorf("api_key is required")
+	if err != nil {
+		return nil, err
+	}
+	if chatCfg.Model == "" {
+		chatCfg.Model = modelConfig.Model
 	}
+	return chatCfg, nil
+}
 
-	if modelName == "" {
-		modelName = "gpt-4o-mini"
+// createAgent 创建 eino Agent
+// smart-reasoning 模式直接使用 ChatModelAgent，supervisor 模式额外挂载子 Agent，
+// plan-execute 模式使用 planner/executor/replanner 循环
+func (s *Service) createAgent(ctx context.Context, agentModel *agentmodel.Agent, selectedTools []tool.BaseTool, tenantID string) (adk.Agent, error) {
+	if agentModel.AgentMode == agentmodel.AgentModePlanExecute {
+		return s.newPlanExecuteAgent(ctx, agentModel, selectedTools)
 	}
 
-	temperature := float32(0.7)
-	if temp, ok := modelConfig.Parameters["temperature"].(float64); ok {
-		temperature = float32(temp)
+	chatModelAgent, err := s.newChatModelAgent(ctx, agentModel, selectedTools)
+	if err != nil {
+		return nil, err
 	}
 
-	return openai.NewChatModel(ctx, &openai.ChatModelConfig{
-		APIKey:      apiKey,
-		BaseURL:     baseURL,
-		Model:       modelName,
-		Temperature: &temperature,
-	})
+	if agentModel.AgentMode == agentmodel.AgentModeSupervisor {
+		return s.newSupervisorAgent(ctx, agentModel, chatModelAgent, tenantID)
+	}
+	return chatModelAgent, nil
 }
 
-// createAgent 创建 eino Agent（smart-reasoning 模式）
+// newChatModelAgent 创建 ChatModelAgent（ReAct 模式）
 // 参考 eino-examples，使用 adk.NewChatModelAgent
-func (s *Service) createAgent(ctx context.Context, agentModel *agentmodel.Agent, selectedTools []tool.BaseTool) (*adk.ChatModelAgent, error) {
-	chatModel, err := s.newToolCallingChatModel(ctx, agentModel.ModelConfig)
+func (s *Service) newChatModelAgent(ctx context.Context, agentModel *agentmodel.Agent, selectedTools []tool.BaseTool) (*adk.ChatModelAgent, error) {
+	chatModel, err := s.newToolCallingChatModel(ctx, agentModel)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create chat model: %w", err)
 	}
@@ -367,6 +537,13 @@ func (s *Service) createAgent(ctx context.Context, agentModel *agentmodel.Agent,
 		Instruction:   systemPrompt,
 		Model:         chatModel,
 		MaxIterations: maxIter,
+		GenModelInput: genModelInput,
+	}
+
+	// 需要审批的工具在执行前中断
+	selectedTools, err = wrapApprovalTools(ctx, selectedTools, getToolNames(agentModel.ApprovalTools))
+	if err != nil {
+		return nil, err
 	}
 
 	// 添加工具
@@ -395,31 +572,117 @@ func getToolNames(tools datatypes.JSON) []string {
 	return names
 }
 
+// selectTools 根据 Agent.Tools 选择本次运行使用的工具
+// 内置工具按名称从 allTools 中选取（未找到时回退到全部内置工具），
+// database_query 按调用方租户每次运行创建，
+// mcp:<service>/<tool> 引用在运行时从已启用的 MCP 服务解析
+func (s *Service) selectTools(ctx context.Context, agentModel *agentmodel.Agent, tenantID string) ([]tool.BaseTool, error) {
+	var builtinNames, mcpRefs []string
+	useDatabase := false
+	for _, name := range getToolNames(agentModel.Tools) {
+		switch {
+		case name == database.ToolDatabaseQuery:
+			useDatabase = true
+		case svcmcp.IsToolRef(name):
+			mcpRefs = append(mcpRefs, name)
+		default:
+			builtinNames = append(builtinNames, name)
+		}
+	}
+
+	var selectedTools []tool.BaseTool
+	// 仅配置了 MCP 或数据库工具时不附加内置工具
+	if len(builtinNames) > 0 || (len(mcpRefs) == 0 && !useDatabase) {
+		builtinTools, err := GetToolsByName(ctx, builtinNames, s.allTools)
+		if err != nil {
+			// 如果获取工具失败，使用所有工具
+			builtinTools = s.allTools
+		}
+		selectedTools = append(selectedTools, builtinTools...)
+	}
+
+	if useDatabase {
+		queryTool, err := s.newQueryTool(tenantID)
+		if err != nil {
+			return nil, err
+		}
+		selectedTools = append(selectedTools, queryTool)
+	}
+
+	if len(mcpRefs) > 0 {
+		if s.mcpSvc == nil {
+			return nil, fmt.Errorf("MCP tools configured but MCP service is not available")
+		}
+		mcpTools, err := s.mcpSvc.ResolveTools(ctx, mcpRefs)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve MCP tools: %w", err)
+		}
+		selectedTools = append(selectedTools, mcpTools...)
+	}
+
+	return selectedTools, nil
+}
+
+// newQueryTool 为租户创建数据库查询工具，表白名单取自 Tenant.AgentConfig
+func (s *Service) newQueryTool(tenantID string) (tool.BaseTool, error) {
+	if tenantID == "" {
+		return nil, fmt.Errorf("%s tool requires a tenant", database.ToolDatabaseQuery)
+	}
+
+	tenant, err := s.repo.Tenant.GetByID(tenantID)
+	if err != nil {
+		return nil, fmt.Errorf("tenant not found: %w", err)
+	}
+
+	var allowedTables []string
+	if tenant.AgentConfig != nil {
+		allowedTables = tenant.AgentConfig.AllowedTables
+	}
+	return database.NewQueryTool(s.repo.DB, tenantID, allowedTables), nil
+}
+
+// withKnowledgeScope 将 Agent 绑定的知识库写入 context，供 knowledge_search 工具使用
+func withKnowledgeScope(ctx context.Context, agentModel *agentmodel.Agent, tenantID string) context.Context {
+	return knowledge.WithSearchScope(ctx, &knowledge.SearchScope{
+		TenantID:         tenantID,
+		KnowledgeBaseIDs: getToolNames(agentModel.KnowledgeBases),
+	})
+}
+
 // Run 运行 Agent（同步）
 func (s *Service) Run(ctx context.Context, agentID string, req *RunRequest) (*RunResponse, error) {
-	agentModel, err := s.repo.Agent.GetByID(agentID)
+	if err := s.checkSessionOwner(req.owner(), req.SessionID); err != nil {
+		return nil, err
+	}
+
+	agentModel, err := s.loadRunAgent(agentID, req.SessionID)
 	if err != nil {
-		return nil, fmt.Errorf("agent not found: %w", err)
+		return nil, err
 	}
 
-	// 获取指定工具
-	toolNames := getToolNames(agentModel.Tools)
-	selectedTools, err := GetToolsByName(ctx, toolNames, s.allTools)
+	// 获取指定工具（内置工具 + MCP 工具）
+	selectedTools, err := s.selectTools(ctx, agentModel, req.TenantID)
 	if err != nil {
-		// 如果获取工具失败，使用所有工具
-		selectedTools = s.allTools
+		return nil, err
 	}
 
 	// 创建 eino Agent
-	einoAgent, err := s.createAgent(ctx, agentModel, selectedTools)
+	einoAgent, err := s.createAgent(ctx, agentModel, selectedTools, req.TenantID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create agent: %w", err)
 	}
 
-	// 加载历史消息
+	// 注入知识库检索范围、上一轮计划和模型记录器
+	ctx = withKnowledgeScope(ctx, agentModel, req.TenantID)
+	ctx = s.withSavedPlan(ctx, agentModel, req.SessionID)
+	ctx, recorder := withModelRecorder(ctx)
+
+	// 加载当前分支上下文窗口内的历史消息
 	var history []*schema.Message
+	var branch branchPoint
 	if req.SessionID != "" {
-		history = s.loadHistory(ctx, req.SessionID)
+		branch = s.resolveBranch(req.SessionID, req.branch)
+		history = s.buildContext(ctx, agentModel, req.SessionID, req.TenantID, branch.ParentID)
 	}
 
 	// 构建输入消息
@@ -433,6 +696,7 @@ func (s *Service) Run(ctx context.Context, agentID string, req *RunRequest) (*Ru
 
 	// 收集结果
 	var result string
+	var transcript []*schema.Message
 	for {
 		event, ok := iter.Next()
 		if !ok {
@@ -445,205 +709,295 @@ func (s *Service) Run(ctx context.Context, agentID string, req *RunRequest) (*Ru
 			}
 			return nil, fmt.Errorf("agent event error: %w", event.Err)
 		}
+		if event.Action != nil && event.Action.Interrupted != nil {
+			return nil, errApprovalRequired
+		}
 
 		if event.Output != nil && event.Output.MessageOutput != nil {
 			msg, err := event.Output.MessageOutput.GetMessage()
 			if err != nil {
 				continue
 			}
+			if msg.Role == schema.Assistant || msg.Role == schema.Tool {
+				transcript = append(transcript, msg)
+			}
 			if msg.Role == schema.Assistant {
-				result = msg.Content
+				result += msg.Content
 			}
 		}
 	}
 
 	// 保存消息到会话
 	if req.SessionID != "" {
-		s.saveMessage(ctx, req.SessionID, "user", req.Query)
-		s.saveMessage(ctx, req.SessionID, "assistant", result)
+		s.saveTranscript(ctx, req.SessionID, "", branch, req.Query, transcript, result)
 	}
 
-	return &RunResponse{Answer: result}, nil
+	return &RunResponse{Answer: result, Model: recorder.Model()}, nil
 }
 
 // Stream 运行 Agent（流式）
 func (s *Service) Stream(ctx context.Context, agentID string, req *RunRequest) (<-chan StreamEvent, error) {
-	agentModel, err := s.repo.Agent.GetByID(agentID)
+	if err := s.checkSessionOwner(req.owner(), req.SessionID); err != nil {
+		return nil, err
+	}
+
+	agentModel, err := s.loadRunAgent(agentID, req.SessionID)
 	if err != nil {
-		return nil, fmt.Errorf("agent not found: %w", err)
+		return nil, err
 	}
 
-	// 获取指定工具
-	toolNames := getToolNames(agentModel.Tools)
-	selectedTools, err := GetToolsByName(ctx, toolNames, s.allTools)
+	// 获取指定工具（内置工具 + MCP 工具）
+	selectedTools, err := s.selectTools(ctx, agentModel, req.TenantID)
 	if err != nil {
-		selectedTools = s.allTools
+		return nil, err
 	}
 
 	// 创建 eino Agent
-	einoAgent, err := s.createAgent(ctx, agentModel, selectedTools)
+	einoAgent, err := s.createAgent(ctx, agentModel, selectedTools, req.TenantID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create agent: %w", err)
 	}
 
-	// 加载历史消息
+	// 注入知识库检索范围、上一轮计划和模型记录器
+	ctx = withKnowledgeScope(ctx, agentModel, req.TenantID)
+	ctx = s.withSavedPlan(ctx, agentModel, req.SessionID)
+	ctx, recorder := withModelRecorder(ctx)
+
+	// 加载当前分支上下文窗口内的历史消息
 	var history []*schema.Message
+	var branch branchPoint
 	if req.SessionID != "" {
-		history = s.loadHistory(ctx, req.SessionID)
+		branch = s.resolveBranch(req.SessionID, req.branch)
+		history = s.buildContext(ctx, agentModel, req.SessionID, req.TenantID, branch.ParentID)
 	}
 
 	// 构建输入消息
 	messages := buildMessages(history, req.Query)
 
-	// 流式运行 Agent
-	iter := einoAgent.Run(ctx, &adk.AgentInput{
-		Messages:        messages,
-		EnableStreaming: true,
-	})
+	// 流式运行 Agent（配置了审批工具时启用检查点）
+	runner, runOpts, err := s.newRunner(ctx, einoAgent, agentModel, req.SessionID)
+	if err != nil {
+		return nil, err
+	}
+	run := &streamRun{
+		AgentID:   agentID,
+		SessionID: req.SessionID,
+		MessageID: uuid.New().String(),
+		TenantID:  req.TenantID,
+		Query:     req.Query,
+		Branch:    branch,
+		models:    recorder,
+	}
+	ctx = s.startStream(ctx, run)
+	iter := runner.Run(ctx, messages, runOpts...)
+
+	return s.relayEvents(ctx, iter, run), nil
+}
+
+// streamRun 一次流式运行的上下文，用于保存消息和恢复审批
+type streamRun struct {
+	AgentID   string
+	SessionID string
+	MessageID string // 本次回复的消息 ID
+	TenantID  string
+	Query     string
+	Branch    branchPoint       // 本轮在消息树中的位置
+	Answer    string            // 已生成的回答（各助手消息内容按输出顺序拼接）
+	Messages  []*schema.Message // 已生成的助手和工具消息，结束时保存
+
+	started bool // 是否已输出 start 事件，每次运行只输出一次
+
+	models *modelRecorder        // 记录实际应答的模型，可为 nil
+	stream *session.ActiveStream // 注册的会话流，无会话时为 nil
+	cancel context.CancelFunc    // 停止运行
+}
 
-	outCh := make(chan StreamEvent, 10)
+// endEvent 运行结束事件，附带实际应答的模型
+func (r *streamRun) endEvent() StreamEvent {
+	return StreamEvent{Type: svctypes.EventEnd, Model: r.models.Model()}
+}
 
-	go func() {
-		defer close(outCh)
+// forwardEvents 将 Agent 事件转换为 StreamEvent 输出，结束时保存消息
+// 遇到审批中断时保存待审批记录并结束输出，消息在审批恢复完成后保存
+func (s *Service) forwardEvents(ctx context.Context, iter *adk.AsyncIterator[*adk.AgentEvent], run *streamRun, outCh chan<- StreamEvent) {
+	defer close(outCh)
+
+	for {
+		event, ok := iter.Next()
+		if !ok {
+			outCh <- run.endEvent()
+			break
+		}
 
-		var fullAnswer string
-		for {
-			event, ok := iter.Next()
-			if !ok {
-				outCh <- StreamEvent{Type: "end"}
+		if event.Err != nil {
+			if event.Err == io.EOF {
+				outCh <- run.endEvent()
 				break
 			}
+			outCh <- StreamEvent{Type: svctypes.EventError, Data: event.Err.Error(), AgentName: event.AgentName}
+			continue
+		}
 
-			if event.Err != nil {
-				if event.Err == io.EOF {
-					outCh <- StreamEvent{Type: "end"}
-					break
-				}
-				outCh <- StreamEvent{Type: "error", Data: event.Err.Error()}
-				continue
+		// 计划更新（plan-execute 模式）
+		if event.Output != nil {
+			if update, ok := event.Output.CustomizedOutput.(*PlanUpdate); ok {
+				s.savePlan(ctx, run.SessionID, update)
+				data, _ := json.Marshal(update)
+				outCh <- StreamEvent{Type: svctypes.EventPlanUpdate, Data: string(data), AgentName: event.AgentName}
 			}
+		}
 
-			// 处理不同类型的事件
-			if event.Output != nil && event.Output.MessageOutput != nil {
-				msgVar := event.Output.MessageOutput
-
-				// 流式消息
-				if msgVar.IsStreaming && msgVar.MessageStream != nil {
-					outCh <- StreamEvent{Type: "start"}
-
-					for {
-						chunk, err := msgVar.MessageStream.Recv()
-						if err == io.EOF {
-							break
-						}
-						if err != nil {
-							outCh <- StreamEvent{Type: "error", Data: err.Error()}
-							break
-						}
-
-						outCh <- StreamEvent{
-							Type: "message",
-							Data: chunk.Content,
-						}
-
-						// 收集完整答案
-						fullAnswer += chunk.Content
-					}
-				} else if msgVar.Message != nil {
-					// 非流式消息
-					if msgVar.Role == schema.Assistant {
-						outCh <- StreamEvent{
-							Type: "message",
-							Data: msgVar.Message.Content,
-						}
-						fullAnswer = msgVar.Message.Content
-					} else if msgVar.Role == schema.Tool {
-						outCh <- StreamEvent{
-							Type:     "tool_call",
-							ToolName: msgVar.ToolName,
-							Data:     msgVar.Message.Content,
-						}
-					}
-				}
+		// 处理不同类型的事件
+		if event.Output != nil && event.Output.MessageOutput != nil {
+			msgVar := event.Output.MessageOutput
+			if msgVar.Role == schema.Tool {
+				forwardToolResult(msgVar, event.AgentName, run, outCh)
+			} else {
+				forwardAssistantMessage(msgVar, event.AgentName, run, outCh)
 			}
+		}
 
-			// 处理 Action
-			if event.Action != nil {
-				if event.Action.Exit {
-					outCh <- StreamEvent{Type: "end"}
-					// 结束时保存
-					if req.SessionID != "" {
-						s.saveMessage(ctx, req.SessionID, "user", req.Query)
-						s.saveMessage(ctx, req.SessionID, "assistant", fullAnswer)
-					}
-					return
-				}
-				if event.Action.TransferToAgent != nil {
-					outCh <- StreamEvent{
-						Type:     "transfer",
-						ToolName: event.Action.TransferToAgent.DestAgentName,
-					}
+		// 处理 Action
+		if event.Action != nil {
+			if event.Action.Interrupted != nil {
+				s.suspendForApproval(ctx, run, event.Action.Interrupted, outCh)
+				return
+			}
+			if event.Action.Exit {
+				outCh <- run.endEvent()
+				break
+			}
+			if event.Action.TransferToAgent != nil {
+				// Data 为转交目标，AgentName 为发起转交的 Agent
+				outCh <- StreamEvent{
+					Type:      svctypes.EventTransfer,
+					ToolName:  event.Action.TransferToAgent.DestAgentName,
+					Data:      event.Action.TransferToAgent.DestAgentName,
+					AgentName: event.AgentName,
 				}
 			}
 		}
+	}
+
+	// 结束时保存
+	if run.SessionID != "" {
+		s.saveTranscript(ctx, run.SessionID, run.MessageID, run.Branch, run.Query, run.Messages, run.Answer)
+	}
+}
 
-		// 结束时保存
-		if req.SessionID != "" {
-			s.saveMessage(ctx, req.SessionID, "user", req.Query)
-			s.saveMessage(ctx, req.SessionID, "assistant", fullAnswer)
+// forwardAssistantMessage 输出助手消息：内容和思考过程按增量输出，
+// 工具调用和 token 用量在消息完整后输出。一次运行的多条助手消息属于同一条回复，
+// start 事件只在第一条消息前输出
+func forwardAssistantMessage(msgVar *adk.MessageVariant, agentName string, run *streamRun, outCh chan<- StreamEvent) {
+	messageID := run.MessageID
+	if !run.started {
+		run.started = true
+		outCh <- StreamEvent{Type: svctypes.EventStart, MessageID: messageID, AgentName: agentName}
+	}
+
+	// 非流式消息
+	if !msgVar.IsStreaming || msgVar.MessageStream == nil {
+		if msgVar.Message == nil {
+			return
 		}
-	}()
+		emitMessageDelta(msgVar.Message, messageID, agentName, outCh)
+		run.Answer += msgVar.Message.Content
+		run.Messages = append(run.Messages, msgVar.Message)
+		emitMessageTail(msgVar.Message, messageID, agentName, outCh)
+		return
+	}
 
-	return outCh, nil
-}
+	// 流式消息
+	var chunks []*schema.Message
+	for {
+		chunk, err := msgVar.MessageStream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			outCh <- StreamEvent{Type: svctypes.EventError, MessageID: messageID, Data: err.Error(), AgentName: agentName}
+			break
+		}
+
+		chunks = append(chunks, chunk)
+		emitMessageDelta(chunk, messageID, agentName, outCh)
 
-// loadHistory 从数据库加载历史消息
-func (s *Service) loadHistory(ctx context.Context, sessionID string) []*schema.Message {
-	messages, err := s.repo.Chat.GetMessagesBySessionID(sessionID)
+		// 收集完整答案
+		run.Answer += chunk.Content
+	}
+
+	if len(chunks) == 0 {
+		return
+	}
+	msg, err := schema.ConcatMessages(chunks)
 	if err != nil {
-		return nil
+		outCh <- StreamEvent{Type: svctypes.EventError, MessageID: messageID, Data: err.Error(), AgentName: agentName}
+		return
 	}
+	run.Messages = append(run.Messages, msg)
+	emitMessageTail(msg, messageID, agentName, outCh)
+}
 
-	result := make([]*schema.Message, 0, len(messages))
-	for _, msg := range messages {
-		var role schema.RoleType
-		switch msg.Role {
-		case "user":
-			role = schema.User
-		case "assistant":
-			role = schema.Assistant
-		case "system":
-			role = schema.System
-		default:
-			role = schema.User
+// emitMessageDelta 输出消息（增量）中的思考过程和内容
+func emitMessageDelta(msg *schema.Message, messageID, agentName string, outCh chan<- StreamEvent) {
+	if msg.ReasoningContent != "" {
+		outCh <- StreamEvent{Type: svctypes.EventReasoning, MessageID: messageID, Data: msg.ReasoningContent, AgentName: agentName}
+	}
+	if msg.Content != "" {
+		outCh <- StreamEvent{Type: svctypes.EventMessage, MessageID: messageID, Data: msg.Content, AgentName: agentName}
+	}
+}
+
+// emitMessageTail 输出完整消息中的工具调用和 token 用量
+func emitMessageTail(msg *schema.Message, messageID, agentName string, outCh chan<- StreamEvent) {
+	for _, call := range msg.ToolCalls {
+		outCh <- StreamEvent{
+			Type:       svctypes.EventToolCallStart,
+			MessageID:  messageID,
+			ToolCallID: call.ID,
+			ToolName:   call.Function.Name,
+			Arguments:  call.Function.Arguments,
+			AgentName:  agentName,
+		}
+	}
+
+	if msg.ResponseMeta != nil && msg.ResponseMeta.Usage != nil {
+		usage := msg.ResponseMeta.Usage
+		outCh <- StreamEvent{
+			Type:      svctypes.EventUsage,
+			MessageID: messageID,
+			AgentName: agentName,
+			Usage: &svctypes.TokenUsage{
+				PromptTokens:     usage.PromptTokens,
+				CompletionTokens: usage.CompletionTokens,
+				TotalTokens:      usage.TotalTokens,
+			},
 		}
-		result = append(result, &schema.Message{
-			Role:    role,
-			Content: msg.Content,
-		})
 	}
-	return result
 }
 
-// saveMessage 保存消息到数据库
-func (s *Service) saveMessage(ctx context.Context, sessionID, role, content string) {
-	_ = s.repo.Chat.CreateMessage(&agentmodel.ChatMessage{
-		ID:        uuid.New().String(),
-		SessionID: sessionID,
-		Role:      role,
-		Content:   content,
-	})
+// forwardToolResult 输出工具执行结果
+func forwardToolResult(msgVar *adk.MessageVariant, agentName string, run *streamRun, outCh chan<- StreamEvent) {
+	msg, err := msgVar.GetMessage()
+	if err != nil {
+		outCh <- StreamEvent{Type: svctypes.EventError, ToolName: msgVar.ToolName, Data: err.Error(), AgentName: agentName}
+		return
+	}
+	run.Messages = append(run.Messages, msg)
+
+	outCh <- StreamEvent{
+		Type:       svctypes.EventToolResult,
+		ToolCallID: msg.ToolCallID,
+		ToolName:   msgVar.ToolName,
+		Data:       msg.Content,
+		AgentName:  agentName,
+	}
 }
 
 // buildMessages 构建消息列表
 func buildMessages(history []*schema.Message, query string) []adk.Message {
 	result := make([]adk.Message, 0, len(history)+1)
-	for _, msg := range history {
-		result = append(result, &schema.Message{
-			Role:    msg.Role,
-			Content: msg.Content,
-		})
-	}
+	result = append(result, history...)
 	result = append(result, &schema.Message{
 		Role:    schema.User,
 		Content: query,
@@ -651,28 +1005,30 @@ func buildMessages(history []*schema.Message, query string) []adk.Message {
 	return result
 }
 
-// RunAgent 运行 Agent（内部方法）
-func (s *Service) RunAgent(ctx context.Context, agentID string, query string, history []*schema.Message) (string, error) {
-	agentModel, err := s.repo.Agent.GetByID(agentID)
+// RunAgent 运行 Agent（内部方法），tenantID 为调用方租户，用于限定工具和知识库范围
+func (s *Service) RunAgent(ctx context.Context, agentID, tenantID string, query string, history []*schema.Message) (string, error) {
+	agentModel, err := s.loadPublishedAgent(agentID)
 	if err != nil {
-		return "", fmt.Errorf("agent not found: %w", err)
+		return "", err
 	}
 
-	// 获取指定工具
-	toolNames := getToolNames(agentModel.Tools)
-	selectedTools, err := GetToolsByName(ctx, toolNames, s.allTools)
+	// 获取指定工具（内置工具 + MCP 工具）
+	selectedTools, err := s.selectTools(ctx, agentModel, tenantID)
 	if err != nil {
-		selectedTools = s.allTools
+		return "", err
 	}
 
 	// 创建 eino Agent
-	einoAgent, err := s.createAgent(ctx, agentModel, selectedTools)
+	einoAgent, err := s.createAgent(ctx, agentModel, selectedTools, tenantID)
 	if err != nil {
 		return "", fmt.Errorf("failed to create agent: %w", err)
 	}
 
-	// 构建输入消息
-	messages := buildMessages(history, query)
+	// 注入知识库检索范围
+	ctx = withKnowledgeScope(ctx, agentModel, tenantID)
+
+	// 构建输入消息（历史裁剪到上下文窗口内）
+	messages := buildMessages(s.fitHistory(agentModel, history), query)
 
 	// 运行 Agent
 	iter := einoAgent.Run(ctx, &adk.AgentInput{
@@ -694,6 +1050,9 @@ func (s *Service) RunAgent(ctx context.Context, agentID string, query string, hi
 			}
 			return "", fmt.Errorf("agent event error: %w", event.Err)
 		}
+		if event.Action != nil && event.Action.Interrupted != nil {
+			return "", errApprovalRequired
+		}
 
 		if event.Output != nil && event.Output.MessageOutput != nil {
 			msg, err := event.Output.MessageOutput.GetMessage()
@@ -701,7 +1060,7 @@ func (s *Service) RunAgent(ctx context.Context, agentID string, query string, hi
 				continue
 			}
 			if msg.Role == schema.Assistant {
-				result = msg.Content
+				result += msg.Content
 			}
 		}
 	}
@@ -885,8 +1244,8 @@ func (s *Service) ListBuiltinAgents(ctx context.Context) ([]*agentmodel.Agent, e
 // ========== 适配器方法（实现外部接口）==========
 
 // StreamWithContextForChat 用于 chat 包调用的适配方法
-// 实现 chat.AgentService 接口，使用 interface{} 类型避免循环依赖
-func (s *Service) StreamWithContextForChat(ctx context.Context, agentID string, req interface{}) (<-chan interface{}, error) {
+// 实现 chat.AgentService 接口，请求使用 interface{} 类型避免循环依赖
+func (s *Service) StreamWithContextForChat(ctx context.Context, agentID string, req interface{}) (<-chan StreamEvent, error) {
 	// 将 interface{} 转换为 RunRequest
 	var runReq *RunRequest
 
@@ -897,29 +1256,47 @@ func (s *Service) StreamWithContextForChat(ctx context.Context, agentID string,
 		// 从 map 构建请求
 		query, _ := r["query"].(string)
 		sessionID, _ := r["session_id"].(string)
+		tenantID, _ := r["tenant_id"].(string)
+		userID, _ := r["user_id"].(string)
 
 		runReq = &RunRequest{
 			Query:     query,
 			SessionID: sessionID,
+			TenantID:  tenantID,
+			UserID:    userID,
 		}
 	default:
 		return nil, fmt.Errorf("invalid request type")
 	}
 
-	// 调用实际的流式方法
-	rawCh, err := s.Stream(ctx, agentID, runReq)
-	if err != nil {
-		return nil, err
+	// 调用实际的流式方法（事件协议与 chat 共用，直接返回）
+	return s.Stream(ctx, agentID, runReq)
+}
+
+// checkSessionOwner 校验会话属于请求方，sessionID 为空时不校验
+func (s *Service) checkSessionOwner(owner agentmodel.Owner, sessionID string) error {
+	if sessionID == "" {
+		return nil
+	}
+	if _, err := s.repo.Chat.ForOwner(owner).GetSessionMeta(sessionID); err != nil {
+		return fmt.Errorf("session not found: %w", err)
 	}
+	return nil
+}
 
-	// 转换为 interface{} channel
-	outCh := make(chan interface{}, 10)
-	go func() {
-		defer close(outCh)
-		for evt := range rawCh {
-			outCh <- evt
+// ReleaseSession 释放会话的运行时数据：停止流，删除会话状态、检查点和待审批记录
+func (s *Service) ReleaseSession(ctx context.Context, sessionID string) {
+	if s.streams != nil {
+		s.streams.ReleaseSession(ctx, sessionID)
+	}
+	if s.stateMgr != nil {
+		_ = s.stateMgr.DeleteState(ctx, sessionID)
+	}
+	if s.checkpointStore != nil {
+		for _, key := range []string{checkPointKey(sessionID), approvalKey(sessionID)} {
+			if err := s.checkpointStore.Set(ctx, key, nil); err != nil {
+				log.Printf("Warning: failed to delete %s: %v", key, err)
+			}
 		}
-	}()
-
-	return outCh, nil
+	}
 }
@@ -0,0 +1,408 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	agentmodel "github.com/ashwinyue/next-ai/internal/model"
+	svctypes "github.com/ashwinyue/next-ai/internal/service/types"
+	"github.com/cloudwego/eino/adk"
+	"github.com/cloudwego/eino/components/tool"
+	"github.com/cloudwego/eino/compose"
+	"github.com/cloudwego/eino/schema"
+	"github.com/google/uuid"
+)
+
+// ========== 工具调用人工审批（Human-in-the-loop）==========
+//
+// Agent.ApprovalTools 中的工具在执行前通过 eino 中断暂停：
+// 流式输出 approval_required 事件，运行状态以检查点保存在 CheckPointStore（Redis）中，
+// 调用 Approve 后从检查点恢复，批准则执行工具，拒绝则将拒绝结果返回给模型
+
+// ErrNoPendingApproval 会话没有待审批的工具调用
+var ErrNoPendingApproval = errors.New("no pending tool approval")
+
+// errApprovalRequired 非流式运行遇到需要审批的工具调用
+var errApprovalRequired = errors.New("tool call requires approval, use the streaming API with a session")
+
+func init() {
+	// 中断信息和恢复数据会随检查点序列化
+	schema.RegisterName[*ApprovalInfo]("next_ai_approval_info")
+	schema.RegisterName[*ApprovalResult]("next_ai_approval_result")
+}
+
+// ApprovalInfo 待审批的工具调用（中断信息）
+type ApprovalInfo struct {
+	ToolName        string `json:"tool_name"`
+	ArgumentsInJSON string `json:"arguments"`
+}
+
+// ApprovalResult 审批结果（恢复数据）
+type ApprovalResult struct {
+	Approved bool
+	Reason   string
+}
+
+// PendingToolCall 等待审批的单个工具调用
+type PendingToolCall struct {
+	InterruptID string `json:"interrupt_id"`
+	ToolName    string `json:"tool_name"`
+	Arguments   string `json:"arguments"`
+}
+
+// PendingApproval 会话中等待审批的运行
+type PendingApproval struct {
+	SessionID string            `json:"session_id"`
+	AgentID   string            `json:"agent_id"`
+	TenantID  string            `json:"tenant_id"`
+	Query     string            `json:"query"`
+	Branch    branchPoint       `json:"branch"`             // 本轮在消息树中的位置
+	Answer    string            `json:"answer"`             // 中断前已生成的回答
+	Messages  []*schema.Message `json:"messages,omitempty"` // 中断前已生成的助手和工具消息
+	Calls     []PendingToolCall `json:"calls"`
+	CreatedAt time.Time         `json:"created_at"`
+}
+
+// ApproveRequest 工具调用审批请求
+type ApproveRequest struct {
+	Approved bool   `json:"approved"`
+	Reason   string `json:"reason,omitempty"` // 拒绝原因，会返回给模型
+	TenantID string `json:"-"`
+	UserID   string `json:"-"`
+}
+
+// approvalTool 执行前需要审批的工具
+type approvalTool struct {
+	tool.InvokableTool
+}
+
+// InvokableRun 首次调用时中断等待审批，恢复后根据审批结果执行或拒绝
+func (t *approvalTool) InvokableRun(ctx context.Context, argumentsInJSON string, opts ...tool.Option) (string, error) {
+	info, err := t.Info(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	wasInterrupted, _, storedArguments := compose.GetInterruptState[string](ctx)
+	if !wasInterrupted {
+		return "", compose.StatefulInterrupt(ctx, &ApprovalInfo{
+			ToolName:        info.Name,
+			ArgumentsInJSON: argumentsInJSON,
+		}, argumentsInJSON)
+	}
+
+	isTarget, hasData, result := compose.GetResumeContext[*ApprovalResult](ctx)
+	if !isTarget {
+		// 本次恢复未针对该调用，继续等待审批
+		return "", compose.StatefulInterrupt(ctx, &ApprovalInfo{
+			ToolName:        info.Name,
+			ArgumentsInJSON: storedArguments,
+		}, storedArguments)
+	}
+	if !hasData || result == nil {
+		return "", fmt.Errorf("tool '%s' resumed without approval result", info.Name)
+	}
+
+	if !result.Approved {
+		if result.Reason != "" {
+			return fmt.Sprintf("用户拒绝了工具 '%s' 的调用，原因: %s", info.Name, result.Reason), nil
+		}
+		return fmt.Sprintf("用户拒绝了工具 '%s' 的调用", info.Name), nil
+	}
+
+	return t.InvokableTool.InvokableRun(ctx, storedArguments, opts...)
+}
+
+// wrapApprovalTools 为需要审批的工具（按工具名称匹配）包装审批逻辑
+func wrapApprovalTools(ctx context.Context, tools []tool.BaseTool, approvalNames []string) ([]tool.BaseTool, error) {
+	if len(approvalNames) == 0 {
+		return tools, nil
+	}
+
+	needApproval := make(map[string]bool, len(approvalNames))
+	for _, name := range approvalNames {
+		needApproval[name] = true
+	}
+
+	result := make([]tool.BaseTool, 0, len(tools))
+	for _, t := range tools {
+		info, err := t.Info(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get tool info: %w", err)
+		}
+		if !needApproval[info.Name] {
+			result = append(result, t)
+			continue
+		}
+
+		invokable, ok := t.(tool.InvokableTool)
+		if !ok {
+			return nil, fmt.Errorf("tool %s does not support approval", info.Name)
+		}
+		result = append(result, &approvalTool{InvokableTool: invokable})
+	}
+
+	return result, nil
+}
+
+// requiresApproval 判断 Agent（含 supervisor 的子 Agent）是否配置了需要审批的工具
+func (s *Service) requiresApproval(agentModel *agentmodel.Agent) bool {
+	if len(getToolNames(agentModel.ApprovalTools)) > 0 {
+		return true
+	}
+	if agentModel.AgentMode != agentmodel.AgentModeSupervisor {
+		return false
+	}
+
+	subAgents, err := s.loadSubAgents(agentModel)
+	if err != nil {
+		return false
+	}
+	for _, sub := range subAgents {
+		if len(getToolNames(sub.ApprovalTools)) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// newRunner 创建流式 Runner
+// 配置了审批工具时启用检查点（以会话为检查点 ID），以便中断后恢复
+func (s *Service) newRunner(ctx context.Context, einoAgent adk.Agent, agentModel *agentmodel.Agent, sessionID string) (*adk.Runner, []adk.AgentRunOption, error) {
+	cfg := adk.RunnerConfig{
+		Agent:           einoAgent,
+		EnableStreaming: true,
+	}
+	if !s.requiresApproval(agentModel) {
+		return adk.NewRunner(ctx, cfg), nil, nil
+	}
+
+	if sessionID == "" {
+		return nil, nil, fmt.Errorf("tool approval requires a session")
+	}
+	if s.checkpointStore == nil {
+		return nil, nil, fmt.Errorf("tool approval requires a checkpoint store")
+	}
+
+	cfg.CheckPointStore = s.checkpointStore
+	return adk.NewRunner(ctx, cfg), []adk.AgentRunOption{adk.WithCheckPointID(checkPointKey(sessionID))}, nil
+}
+
+// suspendForApproval 保存待审批记录并输出 approval_required 事件
+func (s *Service) suspendForApproval(ctx context.Context, run *streamRun, interrupted *adk.InterruptInfo, outCh chan<- StreamEvent) {
+	pending := &PendingApproval{
+		SessionID: run.SessionID,
+		AgentID:   run.AgentID,
+		TenantID:  run.TenantID,
+		Query:     run.Query,
+		Branch:    run.Branch,
+		Answer:    run.Answer,
+		Messages:  run.Messages,
+		CreatedAt: time.Now(),
+	}
+	for _, ic := range interrupted.InterruptContexts {
+		if !ic.IsRootCause {
+			continue
+		}
+		call := PendingToolCall{InterruptID: ic.ID}
+		if info, ok := ic.Info.(*ApprovalInfo); ok {
+			call.ToolName = info.ToolName
+			call.Arguments = info.ArgumentsInJSON
+		}
+		pending.Calls = append(pending.Calls, call)
+	}
+	if len(pending.Calls) == 0 {
+		outCh <- StreamEvent{Type: svctypes.EventError, Data: "agent interrupted without pending tool calls"}
+		return
+	}
+
+	if err := s.savePendingApproval(ctx, pending); err != nil {
+		outCh <- StreamEvent{Type: svctypes.EventError, Data: err.Error()}
+		return
+	}
+
+	data, _ := json.Marshal(pending.Calls)
+	outCh <- StreamEvent{
+		Type:     svctypes.EventApprovalRequired,
+		Data:     string(data),
+		ToolName: pending.Calls[0].ToolName,
+	}
+}
+
+// GetPendingApproval 获取会话中待审批的工具调用
+func (s *Service) GetPendingApproval(ctx context.Context, owner agentmodel.Owner, sessionID string) (*PendingApproval, error) {
+	if err := s.checkSessionOwner(owner, sessionID); err != nil {
+		return nil, err
+	}
+	pending, err := s.loadPendingApproval(ctx, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	if pending == nil || pending.TenantID != owner.TenantID {
+		return nil, ErrNoPendingApproval
+	}
+	return pending, nil
+}
+
+// Approve 批准或拒绝会话中待审批的工具调用，并从检查点恢复流式运行
+// 待审批记录在恢复前被原子地取走，并发的审批请求只有一个能恢复运行，其余视为已处理
+func (s *Service) Approve(ctx context.Context, sessionID string, req *ApproveRequest) (_ <-chan StreamEvent, err error) {
+	if err := s.checkSessionOwner(agentmodel.Owner{TenantID: req.TenantID, UserID: req.UserID}, sessionID); err != nil {
+		return nil, err
+	}
+	pending, err := s.takePendingApproval(ctx, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	if pending == nil {
+		return nil, ErrNoPendingApproval
+	}
+	// 恢复运行之前失败时放回待审批记录，允许重新审批
+	defer func() {
+		if err != nil {
+			if saveErr := s.savePendingApproval(context.WithoutCancel(ctx), pending); saveErr != nil {
+				log.Printf("Warning: failed to restore pending approval: %v", saveErr)
+			}
+		}
+	}()
+	if pending.TenantID != req.TenantID {
+		return nil, ErrNoPendingApproval
+	}
+
+	// 使用会话固定的版本，与中断前的运行配置一致
+	agentModel, err := s.loadRunAgent(pending.AgentID, sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	selectedTools, err := s.selectTools(ctx, agentModel, pending.TenantID)
+	if err != nil {
+		return nil, err
+	}
+
+	einoAgent, err := s.createAgent(ctx, agentModel, selectedTools, pending.TenantID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create agent: %w", err)
+	}
+
+	ctx = withKnowledgeScope(ctx, agentModel, pending.TenantID)
+	ctx, recorder := withModelRecorder(ctx)
+
+	runner, _, err := s.newRunner(ctx, einoAgent, agentModel, sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ApprovalResult{Approved: req.Approved, Reason: req.Reason}
+	targets := make(map[string]any, len(pending.Calls))
+	for _, call := range pending.Calls {
+		targets[call.InterruptID] = result
+	}
+
+	run := &streamRun{
+		AgentID:   pending.AgentID,
+		SessionID: sessionID,
+		MessageID: uuid.New().String(),
+		TenantID:  pending.TenantID,
+		Query:     pending.Query,
+		Branch:    pending.Branch,
+		Answer:    pending.Answer,
+		Messages:  pending.Messages,
+		models:    recorder,
+	}
+	ctx = s.startStream(ctx, run)
+
+	iter, err := runner.ResumeWithParams(ctx, checkPointKey(sessionID), &adk.ResumeParams{Targets: targets})
+	if err != nil {
+		if run.stream != nil {
+			s.streams.UnregisterStream(sessionID, run.MessageID)
+			run.cancel()
+		}
+		return nil, fmt.Errorf("failed to resume agent: %w", err)
+	}
+
+	return s.relayEvents(ctx, iter, run), nil
+}
+
+// savePendingApproval 保存待审批记录（与检查点共用存储和过期时间）
+func (s *Service) savePendingApproval(ctx context.Context, pending *PendingApproval) error {
+	data, err := json.Marshal(pending)
+	if err != nil {
+		return fmt.Errorf("failed to marshal pending approval: %w", err)
+	}
+	if err := s.checkpointStore.Set(ctx, approvalKey(pending.SessionID), data); err != nil {
+		return fmt.Errorf("failed to save pending approval: %w", err)
+	}
+	return nil
+}
+
+// loadPendingApproval 读取待审批记录，不存在时返回 nil
+func (s *Service) loadPendingApproval(ctx context.Context, sessionID string) (*PendingApproval, error) {
+	if s.checkpointStore == nil {
+		return nil, nil
+	}
+
+	data, ok, err := s.checkpointStore.Get(ctx, approvalKey(sessionID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load pending approval: %w", err)
+	}
+	if !ok {
+		return nil, nil
+	}
+
+	var pending PendingApproval
+	if err := json.Unmarshal(data, &pending); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal pending approval: %w", err)
+	}
+	return &pending, nil
+}
+
+// takePendingApproval 读取并删除待审批记录，不存在（或已被其他请求取走）时返回 nil
+// 存储支持原子取出时（Redis GETDEL）保证只有一个请求能取到
+func (s *Service) takePendingApproval(ctx context.Context, sessionID string) (*PendingApproval, error) {
+	if s.checkpointStore == nil {
+		return nil, nil
+	}
+
+	var data []byte
+	var ok bool
+	var err error
+	if taker, isTaker := s.checkpointStore.(checkpointTaker); isTaker {
+		data, ok, err = taker.Take(ctx, approvalKey(sessionID))
+	} else {
+		if data, ok, err = s.checkpointStore.Get(ctx, approvalKey(sessionID)); err == nil && ok {
+			err = s.checkpointStore.Set(ctx, approvalKey(sessionID), nil)
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to take pending approval: %w", err)
+	}
+	if !ok {
+		return nil, nil
+	}
+
+	var pending PendingApproval
+	if err := json.Unmarshal(data, &pending); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal pending approval: %w", err)
+	}
+	return &pending, nil
+}
+
+// checkpointTaker 支持原子读取并删除的检查点存储
+type checkpointTaker interface {
+	Take(ctx context.Context, key string) ([]byte, bool, error)
+}
+
+// checkPointKey 会话的检查点 ID
+func checkPointKey(sessionID string) string {
+	return fmt.Sprintf("agent:checkpoint:%s", sessionID)
+}
+
+// approvalKey 会话的待审批记录 key
+func approvalKey(sessionID string) string {
+	return fmt.Sprintf("agent:approval:%s", sessionID)
+}
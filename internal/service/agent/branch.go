@@ -0,0 +1,101 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+
+	agentmodel "github.com/ashwinyue/next-ai/internal/model"
+	"github.com/cloudwego/eino/schema"
+)
+
+// ========== 编辑与重新生成 ==========
+//
+// 编辑用户消息或重新生成回复都不修改已有消息：新的一轮挂在原位置成为兄弟分支，
+// 运行结束后成为会话的当前分支，原分支仍可通过分支列表切换回去
+
+// EditMessageRequest 编辑消息请求
+type EditMessageRequest struct {
+	Content  string `json:"content" binding:"required"`
+	AgentID  string `json:"agent_id"` // 为空时使用会话的 Agent
+	TenantID string `json:"-"`        // 由 handler 从认证上下文填充
+	UserID   string `json:"-"`
+}
+
+// RegenerateRequest 重新生成请求
+type RegenerateRequest struct {
+	AgentID  string `json:"agent_id"` // 为空时使用会话的 Agent
+	TenantID string `json:"-"`
+	UserID   string `json:"-"`
+}
+
+// EditMessage 以新内容替换用户消息并重新运行：新消息与原消息互为分支
+func (s *Service) EditMessage(ctx context.Context, sessionID, messageID string, req *EditMessageRequest) (<-chan StreamEvent, error) {
+	owner := agentmodel.Owner{TenantID: req.TenantID, UserID: req.UserID}
+	agentID, message, err := s.loadBranchTarget(owner, sessionID, messageID, req.AgentID)
+	if err != nil {
+		return nil, err
+	}
+	if message.Role != string(schema.User) {
+		return nil, fmt.Errorf("only user messages can be edited")
+	}
+
+	return s.Stream(ctx, agentID, &RunRequest{
+		Query:     req.Content,
+		SessionID: sessionID,
+		TenantID:  req.TenantID,
+		UserID:    req.UserID,
+		branch:    &branchPoint{ParentID: message.ParentID},
+	})
+}
+
+// RegenerateMessage 重新生成回复：messageID 为用户消息或其回复中的任一消息，
+// 以同一用户消息重新运行，新回复与原回复互为分支
+func (s *Service) RegenerateMessage(ctx context.Context, sessionID, messageID string, req *RegenerateRequest) (<-chan StreamEvent, error) {
+	owner := agentmodel.Owner{TenantID: req.TenantID, UserID: req.UserID}
+	agentID, message, err := s.loadBranchTarget(owner, sessionID, messageID, req.AgentID)
+	if err != nil {
+		return nil, err
+	}
+
+	// 向上找到本轮的用户消息
+	for message.Role != string(schema.User) {
+		if message.ParentID == "" {
+			return nil, fmt.Errorf("no user message before message %s", messageID)
+		}
+		if message, err = s.repo.Chat.GetMessageByID(message.ParentID); err != nil {
+			return nil, fmt.Errorf("message not found: %w", err)
+		}
+	}
+
+	return s.Stream(ctx, agentID, &RunRequest{
+		Query:     message.Content,
+		SessionID: sessionID,
+		TenantID:  req.TenantID,
+		UserID:    req.UserID,
+		branch:    &branchPoint{ParentID: message.ParentID, UserMessageID: message.ID},
+	})
+}
+
+// loadBranchTarget 校验会话属于请求方、消息属于会话，返回运行的 Agent（未指定时使用会话的 Agent）和该消息
+func (s *Service) loadBranchTarget(owner agentmodel.Owner, sessionID, messageID, agentID string) (string, *agentmodel.ChatMessage, error) {
+	chatRepo := s.repo.Chat.ForOwner(owner)
+	session, err := chatRepo.GetSessionMeta(sessionID)
+	if err != nil {
+		return "", nil, fmt.Errorf("session not found: %w", err)
+	}
+	if agentID == "" {
+		agentID = session.AgentID
+	}
+	if agentID == "" {
+		return "", nil, fmt.Errorf("agent_id is required for sessions without an agent")
+	}
+
+	message, err := chatRepo.GetMessageByID(messageID)
+	if err != nil {
+		return "", nil, fmt.Errorf("message not found: %w", err)
+	}
+	if message.SessionID != sessionID {
+		return "", nil, fmt.Errorf("message does not belong to this session")
+	}
+	return agentID, message, nil
+}
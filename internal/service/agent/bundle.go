@@ -0,0 +1,410 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	agentmodel "github.com/ashwinyue/next-ai/internal/model"
+	"github.com/ashwinyue/next-ai/internal/service/database"
+	svcmcp "github.com/ashwinyue/next-ai/internal/service/mcp"
+	"gopkg.in/yaml.v3"
+)
+
+// ========== Agent 导入导出 ==========
+//
+// Agent 导出为可移植的配置包（JSON 或 YAML）：依赖的模型、MCP 服务、知识库和子 Agent
+// 均按名称引用，导入到其他环境时按名称重新解析，缺失的依赖在导入结果中列出；
+// 子 Agent 额外校验模式和已发布配置的摘要，避免绑定到同名但不同的 Agent
+
+// 配置包格式
+const (
+	BundleKind    = "next-ai/agent"
+	BundleVersion = 1 // 格式版本，不兼容修改时递增
+)
+
+// AgentBundle Agent 配置包
+type AgentBundle struct {
+	Kind          string           `json:"kind" yaml:"kind"`
+	Version       int              `json:"version" yaml:"version"`
+	ExportedAt    time.Time        `json:"exported_at" yaml:"exported_at"`
+	SourceVersion int              `json:"source_version,omitempty" yaml:"source_version,omitempty"` // 导出的 Agent 版本，0 表示未版本化
+	Agent         BundleAgent      `json:"agent" yaml:"agent"`
+	Dependencies  BundleDependency `json:"dependencies" yaml:"dependencies"`
+}
+
+// BundleAgent 配置包中的 Agent 配置
+type BundleAgent struct {
+	Name          string      `json:"name" yaml:"name"`
+	Description   string      `json:"description,omitempty" yaml:"description,omitempty"`
+	Avatar        string      `json:"avatar,omitempty" yaml:"avatar,omitempty"`
+	AgentMode     string      `json:"agent_mode" yaml:"agent_mode"`
+	SystemPrompt  string      `json:"system_prompt" yaml:"system_prompt"`
+	Model         BundleModel `json:"model" yaml:"model"`
+	Tools         []string    `json:"tools,omitempty" yaml:"tools,omitempty"` // MCP 工具引用为 mcp:<服务名称>/<工具>
+	ApprovalTools []string    `json:"approval_tools,omitempty" yaml:"approval_tools,omitempty"`
+	MaxIter       int         `json:"max_iterations" yaml:"max_iterations"`
+	Temperature   float64     `json:"temperature" yaml:"temperature"`
+}
+
+// BundleModel 模型引用
+type BundleModel struct {
+	Name           string   `json:"name,omitempty" yaml:"name,omitempty"`   // models 表中的对话模型名称，为空时使用默认模型
+	Model          string   `json:"model,omitempty" yaml:"model,omitempty"` // 模型标识（如 gpt-4o）
+	FallbackModels []string `json:"fallback_models,omitempty" yaml:"fallback_models,omitempty"`
+}
+
+// BundleDependency 配置包的外部依赖（均按名称引用）
+type BundleDependency struct {
+	MCPServices    []BundleMCPService `json:"mcp_services,omitempty" yaml:"mcp_services,omitempty"`
+	KnowledgeBases []string           `json:"knowledge_bases,omitempty" yaml:"knowledge_bases,omitempty"`
+	SubAgents      []BundleSubAgent   `json:"sub_agents,omitempty" yaml:"sub_agents,omitempty"`
+}
+
+// BundleSubAgent 子 Agent 依赖
+type BundleSubAgent struct {
+	Name      string `json:"name" yaml:"name"`
+	AgentMode string `json:"agent_mode" yaml:"agent_mode"`
+	Version   int    `json:"version,omitempty" yaml:"version,omitempty"` // 导出时的已发布版本号，不同环境间不可比较，仅供参考
+	Digest    string `json:"digest" yaml:"digest"`                       // 已发布配置的摘要，导入时要求一致
+}
+
+// BundleMCPService MCP 服务依赖（不含认证信息）
+type BundleMCPService struct {
+	Name          string `json:"name" yaml:"name"`
+	Description   string `json:"description,omitempty" yaml:"description,omitempty"`
+	TransportType string `json:"transport_type" yaml:"transport_type"`
+	URL           string `json:"url,omitempty" yaml:"url,omitempty"`
+}
+
+// ExportAgent 导出 Agent 配置包，version 为 0 时导出已发布版本
+func (s *Service) ExportAgent(ctx context.Context, agentID string, version int, tenantID string) (*AgentBundle, error) {
+	agentModel, err := s.repo.Agent.GetByID(agentID)
+	if err != nil {
+		return nil, fmt.Errorf("agent not found: %w", err)
+	}
+	if version == 0 {
+		version = agentModel.PublishedVersion
+	}
+	if agentModel, err = s.applyVersion(agentModel, version); err != nil {
+		return nil, err
+	}
+
+	bundle := &AgentBundle{
+		Kind:          BundleKind,
+		Version:       BundleVersion,
+		ExportedAt:    time.Now(),
+		SourceVersion: version,
+		Agent: BundleAgent{
+			Name:          agentModel.Name,
+			Description:   agentModel.Description,
+			Avatar:        agentModel.Avatar,
+			AgentMode:     agentModel.AgentMode,
+			SystemPrompt:  agentModel.SystemPrompt,
+			Model:         BundleModel{Model: agentModel.ModelConfig.Model},
+			ApprovalTools: getToolNames(agentModel.ApprovalTools),
+			MaxIter:       agentModel.MaxIter,
+			Temperature:   agentModel.Temperature,
+		},
+	}
+
+	// 模型按名称引用
+	if agentModel.ModelConfig.ModelID != "" {
+		m, err := s.modelSvc.GetModelByID(ctx, agentModel.ModelConfig.ModelID)
+		if err != nil {
+			return nil, fmt.Errorf("model %s not found: %w", agentModel.ModelConfig.ModelID, err)
+		}
+		bundle.Agent.Model.Name = m.Name
+	}
+	for _, id := range getToolNames(agentModel.FallbackModels) {
+		m, err := s.modelSvc.GetModelByID(ctx, id)
+		if err != nil {
+			return nil, fmt.Errorf("fallback model %s not found: %w", id, err)
+		}
+		bundle.Agent.Model.FallbackModels = append(bundle.Agent.Model.FallbackModels, m.Name)
+	}
+
+	// MCP 工具引用改写为服务名称，并记录服务依赖
+	seenServices := make(map[string]bool)
+	for _, name := range getToolNames(agentModel.Tools) {
+		if !svcmcp.IsToolRef(name) {
+			bundle.Agent.Tools = append(bundle.Agent.Tools, name)
+			continue
+		}
+		serviceKey, toolName, err := svcmcp.ParseToolRef(name)
+		if err != nil {
+			return nil, err
+		}
+		svc, err := s.findMCPService(serviceKey)
+		if err != nil {
+			return nil, err
+		}
+		bundle.Agent.Tools = append(bundle.Agent.Tools, svcmcp.ToolRefPrefix+svc.Name+"/"+toolName)
+		if !seenServices[svc.Name] {
+			seenServices[svc.Name] = true
+			dep := BundleMCPService{
+				Name:          svc.Name,
+				Description:   svc.Description,
+				TransportType: string(svc.TransportType),
+			}
+			if svc.URL != nil {
+				dep.URL = *svc.URL
+			}
+			bundle.Dependencies.MCPServices = append(bundle.Dependencies.MCPServices, dep)
+		}
+	}
+
+	// 知识库和子 Agent 按名称引用
+	for _, id := range getToolNames(agentModel.KnowledgeBases) {
+		kb, err := s.repo.Knowledge.GetKnowledgeBaseByID(id)
+		if err != nil {
+			return nil, fmt.Errorf("knowledge base %s not found: %w", id, err)
+		}
+		if tenantID != "" && kb.TenantID != tenantID {
+			return nil, fmt.Errorf("knowledge base %s belongs to another tenant", id)
+		}
+		bundle.Dependencies.KnowledgeBases = append(bundle.Dependencies.KnowledgeBases, kb.Name)
+	}
+	for _, id := range getToolNames(agentModel.SubAgents) {
+		sub, err := s.loadPublishedAgent(id)
+		if err != nil {
+			return nil, fmt.Errorf("sub agent %s: %w", id, err)
+		}
+		bundle.Dependencies.SubAgents = append(bundle.Dependencies.SubAgents, newBundleSubAgent(sub))
+	}
+
+	return bundle, nil
+}
+
+// newBundleSubAgent 由子 Agent 的已发布配置生成依赖项
+func newBundleSubAgent(sub *agentmodel.Agent) BundleSubAgent {
+	return BundleSubAgent{
+		Name:      sub.Name,
+		AgentMode: sub.AgentMode,
+		Version:   sub.PublishedVersion,
+		Digest:    subAgentDigest(sub),
+	}
+}
+
+// subAgentDigest 计算子 Agent 配置的摘要
+// 只包含与环境无关的字段，模型、工具和知识库在不同环境中 ID 不同，不参与计算
+func subAgentDigest(sub *agentmodel.Agent) string {
+	data, _ := json.Marshal(struct {
+		AgentMode    string  `json:"agent_mode"`
+		SystemPrompt string  `json:"system_prompt"`
+		MaxIter      int     `json:"max_iterations"`
+		Temperature  float64 `json:"temperature"`
+	}{sub.AgentMode, sub.SystemPrompt, sub.MaxIter, sub.Temperature})
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// ImportAgentRequest 导入请求
+type ImportAgentRequest struct {
+	Bundle            *AgentBundle
+	Name              string // 覆盖配置包中的 Agent 名称（目标环境已有同名 Agent 时使用）
+	DryRun            bool   // 只校验依赖，不创建 Agent
+	AllowDefaultModel bool   // 主模型缺失时改用默认模型，否则不导入
+	TenantID          string // 按名称解析知识库的租户
+}
+
+// ImportResult 导入结果
+type ImportResult struct {
+	Imported bool                `json:"imported"`
+	Agent    *agentmodel.Agent   `json:"agent,omitempty"`
+	Missing  MissingDependencies `json:"missing"`
+}
+
+// MissingDependencies 目标环境中缺失的依赖
+// 工具、MCP 服务和子 Agent 缺失或不一致时不导入；主模型缺失时除非允许使用默认模型，否则不导入；
+// 备用模型和知识库缺失时跳过该项
+type MissingDependencies struct {
+	Tools                 []string `json:"tools,omitempty"`
+	MCPServices           []string `json:"mcp_services,omitempty"`
+	SubAgents             []string `json:"sub_agents,omitempty"`
+	IncompatibleSubAgents []string `json:"incompatible_sub_agents,omitempty"` // 同名 Agent 的模式或已发布配置与配置包不一致
+	Model                 string   `json:"model,omitempty"`
+	FallbackModels        []string `json:"fallback_models,omitempty"`
+	KnowledgeBases        []string `json:"knowledge_bases,omitempty"`
+}
+
+// blocking 是否存在阻止导入的缺失依赖
+func (m *MissingDependencies) blocking(allowDefaultModel bool) bool {
+	return len(m.Tools) > 0 || len(m.MCPServices) > 0 || len(m.SubAgents) > 0 ||
+		len(m.IncompatibleSubAgents) > 0 || (m.Model != "" && !allowDefaultModel)
+}
+
+// ImportAgent 导入 Agent 配置包：按名称解析依赖，依赖齐全时创建 Agent（首个版本直接发布）
+func (s *Service) ImportAgent(ctx context.Context, req *ImportAgentRequest) (*ImportResult, error) {
+	bundle := req.Bundle
+	if bundle.Kind != BundleKind {
+		return nil, fmt.Errorf("unsupported bundle kind: %q", bundle.Kind)
+	}
+	if bundle.Version < 1 || bundle.Version > BundleVersion {
+		return nil, fmt.Errorf("unsupported bundle version: %d", bundle.Version)
+	}
+
+	createReq := &CreateAgentRequest{
+		Name:          bundle.Agent.Name,
+		Description:   bundle.Agent.Description,
+		Avatar:        bundle.Agent.Avatar,
+		AgentMode:     bundle.Agent.AgentMode,
+		SystemPrompt:  bundle.Agent.SystemPrompt,
+		Tools:         bundle.Agent.Tools,
+		ApprovalTools: bundle.Agent.ApprovalTools,
+		MaxIter:       bundle.Agent.MaxIter,
+		Temperature:   bundle.Agent.Temperature,
+		Model:         bundle.Agent.Model.Model,
+	}
+	if req.Name != "" {
+		createReq.Name = req.Name
+	}
+	if createReq.Name == "" {
+		return nil, fmt.Errorf("agent name is required")
+	}
+
+	result := &ImportResult{}
+	missing := &result.Missing
+	s.checkBundleTools(ctx, bundle.Agent.Tools, missing)
+
+	// 模型
+	chatModels, err := s.chatModelsByName(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if name := bundle.Agent.Model.Name; name != "" {
+		if m, ok := chatModels[name]; ok {
+			createReq.ModelID = m.ID
+		} else {
+			missing.Model = name
+		}
+	}
+	for _, name := range bundle.Agent.Model.FallbackModels {
+		if m, ok := chatModels[name]; ok {
+			createReq.FallbackModels = append(createReq.FallbackModels, m.ID)
+		} else {
+			missing.FallbackModels = append(missing.FallbackModels, name)
+		}
+	}
+
+	// 知识库
+	for _, name := range bundle.Dependencies.KnowledgeBases {
+		kb, err := s.repo.Knowledge.GetKnowledgeBaseByName(req.TenantID, name)
+		if err != nil {
+			missing.KnowledgeBases = append(missing.KnowledgeBases, name)
+			continue
+		}
+		createReq.KnowledgeBases = append(createReq.KnowledgeBases, kb.ID)
+	}
+
+	// 子 Agent
+	for _, dep := range bundle.Dependencies.SubAgents {
+		sub, err := s.repo.Agent.GetByName(dep.Name)
+		if err != nil {
+			missing.SubAgents = append(missing.SubAgents, dep.Name)
+			continue
+		}
+		if sub, err = s.applyVersion(sub, sub.PublishedVersion); err != nil {
+			return nil, err
+		}
+		if sub.AgentMode != dep.AgentMode || subAgentDigest(sub) != dep.Digest {
+			missing.IncompatibleSubAgents = append(missing.IncompatibleSubAgents, dep.Name)
+			continue
+		}
+		createReq.SubAgents = append(createReq.SubAgents, sub.ID)
+	}
+
+	if req.DryRun || missing.blocking(req.AllowDefaultModel) {
+		return result, nil
+	}
+
+	agentModel, err := s.CreateAgent(ctx, createReq)
+	if err != nil {
+		return nil, err
+	}
+	result.Imported = true
+	result.Agent = agentModel
+	return result, nil
+}
+
+// checkBundleTools 校验配置包引用的工具在当前环境中存在
+// 内置工具通过 GetToolsByName 校验，MCP 工具只校验服务存在（工具列表在运行时解析）
+func (s *Service) checkBundleTools(ctx context.Context, names []string, missing *MissingDependencies) {
+	seenServices := make(map[string]bool)
+	for _, name := range names {
+		switch {
+		case name == database.ToolDatabaseQuery:
+			// 按租户在运行时创建
+		case svcmcp.IsToolRef(name):
+			serviceKey, _, err := svcmcp.ParseToolRef(name)
+			if err != nil {
+				missing.Tools = append(missing.Tools, name)
+				continue
+			}
+			if seenServices[serviceKey] {
+				continue
+			}
+			seenServices[serviceKey] = true
+			if _, err := s.repo.MCP.GetByName(serviceKey); err != nil {
+				missing.MCPServices = append(missing.MCPServices, serviceKey)
+			}
+		default:
+			if _, err := GetToolsByName(ctx, []string{name}, s.allTools); err != nil {
+				missing.Tools = append(missing.Tools, name)
+			}
+		}
+	}
+}
+
+// chatModelsByName 按名称索引 models 表中的对话模型
+func (s *Service) chatModelsByName(ctx context.Context) (map[string]*agentmodel.Model, error) {
+	modelType := agentmodel.ModelTypeChatModel
+	models, err := s.modelSvc.ListModels(ctx, &modelType, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list models: %w", err)
+	}
+	byName := make(map[string]*agentmodel.Model, len(models))
+	for _, m := range models {
+		byName[m.Name] = m
+	}
+	return byName, nil
+}
+
+// findMCPService 按 ID 或名称查找 MCP 服务（与 ResolveTools 的引用规则一致）
+func (s *Service) findMCPService(key string) (*agentmodel.MCPService, error) {
+	if svc, err := s.repo.MCP.GetByID(key); err == nil {
+		return svc, nil
+	}
+	svc, err := s.repo.MCP.GetByName(key)
+	if err != nil {
+		return nil, fmt.Errorf("MCP service %s not found: %w", key, err)
+	}
+	return svc, nil
+}
+
+// MarshalBundle 按格式（json 或 yaml）编码配置包
+func MarshalBundle(bundle *AgentBundle, format string) ([]byte, error) {
+	if format == "yaml" || format == "yml" {
+		return yaml.Marshal(bundle)
+	}
+	return json.MarshalIndent(bundle, "", "  ")
+}
+
+// UnmarshalBundle 解码配置包，以 { 开头时按 JSON 解析，否则按 YAML 解析
+func UnmarshalBundle(data []byte) (*AgentBundle, error) {
+	var bundle AgentBundle
+	var err error
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+		err = json.Unmarshal(trimmed, &bundle)
+	} else {
+		err = yaml.Unmarshal(data, &bundle)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid agent bundle: %w", err)
+	}
+	return &bundle, nil
+}
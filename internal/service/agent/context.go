@@ -0,0 +1,327 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+	"unicode"
+
+	agentmodel "github.com/ashwinyue/next-ai/internal/model"
+	"github.com/ashwinyue/next-ai/internal/service/session"
+	"github.com/cloudwego/eino/adk"
+	"github.com/cloudwego/eino/components/prompt"
+	"github.com/cloudwego/eino/schema"
+)
+
+// ========== 上下文窗口 ==========
+//
+// 会话历史按 token 预算构建：保留预算内最近的若干轮（不超过租户 ContextConfig.MaxRounds），
+// 开启上下文压缩时，窗口之外未总结的消息超过阈值后在后台合并进会话的滚动摘要，
+// 摘要合并进 Agent 的系统提示词
+
+// messageTokenOverhead 每条消息的格式开销（角色、分隔符）
+const messageTokenOverhead = 4
+
+// tokenRatio 估算 token 数的比例：每个 CJK 字符和每个其他字符对应的 token 数
+type tokenRatio struct {
+	cjk   float64
+	other float64
+}
+
+// modelTokenRatios 各模型系列的分词比例（按模型名称前缀匹配），国产模型的中文分词更紧凑
+var modelTokenRatios = []struct {
+	prefix string
+	ratio  tokenRatio
+}{
+	{"gpt-4o", tokenRatio{cjk: 0.8, other: 0.25}},
+	{"gpt-4.1", tokenRatio{cjk: 0.8, other: 0.25}},
+	{"o1", tokenRatio{cjk: 0.8, other: 0.25}},
+	{"o3", tokenRatio{cjk: 0.8, other: 0.25}},
+	{"o4", tokenRatio{cjk: 0.8, other: 0.25}},
+	{"gpt-", tokenRatio{cjk: 1.2, other: 0.25}},
+	{"qwen", tokenRatio{cjk: 0.7, other: 0.25}},
+	{"deepseek", tokenRatio{cjk: 0.6, other: 0.3}},
+	{"glm", tokenRatio{cjk: 0.7, other: 0.3}},
+}
+
+// defaultTokenRatio 未知模型的保守估算
+var defaultTokenRatio = tokenRatio{cjk: 1.0, other: 0.3}
+
+// tokenRatioFor 返回模型的分词比例
+func tokenRatioFor(modelName string) tokenRatio {
+	name := strings.ToLower(modelName)
+	for _, m := range modelTokenRatios {
+		if strings.HasPrefix(name, m.prefix) {
+			return m.ratio
+		}
+	}
+	return defaultTokenRatio
+}
+
+// count 估算文本的 token 数
+func (r tokenRatio) count(text string) int {
+	var cjk, other int
+	for _, ch := range text {
+		if unicode.In(ch, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul) {
+			cjk++
+		} else {
+			other++
+		}
+	}
+	return int(float64(cjk)*r.cjk + float64(other)*r.other + 0.5)
+}
+
+// messageTokens 估算一条消息的 token 数
+func (r tokenRatio) messageTokens(msg *schema.Message) int {
+	tokens := messageTokenOverhead + r.count(msg.Content) + r.count(msg.ReasoningContent)
+	for _, call := range msg.ToolCalls {
+		tokens += r.count(call.Function.Name) + r.count(call.Function.Arguments)
+	}
+	return tokens
+}
+
+// contextWindow 上下文窗口参数
+type contextWindow struct {
+	maxTokens int        // 历史消息（含摘要）的 token 预算
+	maxRounds int        // 最多保留的对话轮数，0 表示不限
+	compress  bool       // 是否将窗口之外的消息合并进滚动摘要
+	threshold int        // 窗口之外未总结的消息数达到该值时触发总结
+	ratio     tokenRatio // 当前模型的分词比例
+}
+
+// contextWindowFor 按会话配置、租户配置和 Agent 模型确定上下文窗口
+func (s *Service) contextWindowFor(agentModel *agentmodel.Agent, tenantID string) contextWindow {
+	w := contextWindow{
+		maxTokens: s.contextCfg.MaxContextTokens,
+		compress:  s.contextCfg.EnableContextCompression,
+		threshold: s.contextCfg.CompressionThreshold,
+		ratio:     tokenRatioFor(agentModel.ModelConfig.Model),
+	}
+	// 未设置阈值时使用默认值，避免每次请求都触发总结
+	if w.threshold <= 0 {
+		w.threshold = session.DefaultConfig().CompressionThreshold
+	}
+	if tenantID != "" {
+		if tenant, err := s.repo.Tenant.GetByID(tenantID); err == nil && tenant.ContextConfig != nil {
+			w.maxRounds = tenant.ContextConfig.MaxRounds
+		}
+	}
+	return w
+}
+
+// historyRound 一轮对话（用户消息及其后的助手、工具消息）
+type historyRound struct {
+	messages []*schema.Message
+	records  []*agentmodel.ChatMessage // 对应的数据库记录，RunAgent 传入的历史为 nil
+	tokens   int
+}
+
+// splitRounds 按用户消息切分对话轮次
+func (w contextWindow) splitRounds(messages []*schema.Message, records []*agentmodel.ChatMessage) []*historyRound {
+	var rounds []*historyRound
+	for i, msg := range messages {
+		if msg.Role == schema.User || len(rounds) == 0 {
+			rounds = append(rounds, &historyRound{})
+		}
+		round := rounds[len(rounds)-1]
+		round.messages = append(round.messages, msg)
+		tokens := w.ratio.messageTokens(msg)
+		if records != nil {
+			round.records = append(round.records, records[i])
+			// 优先使用模型返回的实际用量
+			if records[i].CompletionTokens > 0 {
+				tokens = messageTokenOverhead + records[i].CompletionTokens
+			}
+		}
+		round.tokens += tokens
+	}
+	return rounds
+}
+
+// fit 返回窗口保留的起始轮次：不超过 maxRounds，且在 token 预算内（最近一轮始终保留）
+func (w contextWindow) fit(rounds []*historyRound, reserved int) int {
+	start := 0
+	if w.maxRounds > 0 && len(rounds) > w.maxRounds {
+		start = len(rounds) - w.maxRounds
+	}
+	if w.maxTokens <= 0 {
+		return start
+	}
+
+	used := reserved
+	for i := len(rounds) - 1; i >= start; i-- {
+		if used+rounds[i].tokens > w.maxTokens && i < len(rounds)-1 {
+			return i + 1
+		}
+		used += rounds[i].tokens
+	}
+	return start
+}
+
+// buildContext 构建到 leafID 为止的会话历史：滚动摘要 + 窗口内最近的若干轮
+func (s *Service) buildContext(ctx context.Context, agentModel *agentmodel.Agent, sessionID, tenantID, leafID string) []*schema.Message {
+	session, err := s.repo.Chat.GetSessionSummary(sessionID)
+	if err != nil {
+		return nil
+	}
+	records, err := s.repo.Chat.GetMessagePath(sessionID, leafID)
+	if err != nil {
+		return nil
+	}
+
+	// 摘要只在其覆盖的最后一条消息位于当前路径上时有效（其他分支的摘要不适用）
+	summary := ""
+	if session.SummaryUntil != nil {
+		for i, record := range records {
+			if record.CreatedAt.Equal(*session.SummaryUntil) {
+				summary = session.Summary
+				records = records[i+1:]
+				break
+			}
+		}
+	}
+
+	messages := make([]*schema.Message, 0, len(records))
+	for _, record := range records {
+		messages = append(messages, recordToMessage(record))
+	}
+
+	w := s.contextWindowFor(agentModel, tenantID)
+	rounds := w.splitRounds(messages, records)
+	start := w.fit(rounds, w.ratio.count(summary))
+
+	// 窗口之外未总结的消息达到阈值时在后台合并进摘要，本次请求使用已有摘要，
+	// 总结不阻塞请求，新摘要从下一轮开始生效
+	if w.compress && start > 0 {
+		var dropped []*schema.Message
+		for _, round := range rounds[:start] {
+			dropped = append(dropped, round.messages...)
+		}
+		if len(dropped) >= w.threshold {
+			lastRound := rounds[start-1]
+			until := lastRound.records[len(lastRound.records)-1].CreatedAt
+			s.summarizeAsync(context.WithoutCancel(ctx), agentModel, sessionID, summary, dropped, until)
+		}
+	}
+
+	var result []*schema.Message
+	if summary != "" {
+		result = append(result, schema.SystemMessage("以下是之前对话的摘要：\n"+summary))
+	}
+	for _, round := range rounds[start:] {
+		result = append(result, round.messages...)
+	}
+	return pairToolCalls(result)
+}
+
+// fitHistory 将调用方传入的历史裁剪到上下文窗口内（不做总结）
+func (s *Service) fitHistory(agentModel *agentmodel.Agent, history []*schema.Message) []*schema.Message {
+	if len(history) == 0 {
+		return history
+	}
+
+	w := s.contextWindowFor(agentModel, "")
+	rounds := w.splitRounds(history, nil)
+	start := w.fit(rounds, 0)
+
+	var result []*schema.Message
+	for _, round := range rounds[start:] {
+		result = append(result, round.messages...)
+	}
+	return result
+}
+
+// summarizeAsync 在后台更新会话摘要，同一会话同时只运行一个总结
+func (s *Service) summarizeAsync(ctx context.Context, agentModel *agentmodel.Agent, sessionID, previous string, messages []*schema.Message, until time.Time) {
+	if _, running := s.summarizing.LoadOrStore(sessionID, struct{}{}); running {
+		return
+	}
+
+	go func() {
+		defer s.summarizing.Delete(sessionID)
+
+		updated, err := s.summarize(ctx, agentModel, previous, messages)
+		if err != nil {
+			log.Printf("Warning: failed to summarize session %s: %v", sessionID, err)
+			return
+		}
+		if err := s.repo.Chat.UpdateSessionSummary(sessionID, updated, until); err != nil {
+			log.Printf("Warning: failed to save session summary: %v", err)
+		}
+	}()
+}
+
+// genModelInput 生成 ChatModelAgent 的模型输入：历史开头的系统消息（会话摘要）
+// 合并进 Agent 的系统提示词，不在对话中插入额外的系统消息
+func genModelInput(ctx context.Context, instruction string, input *adk.AgentInput) ([]adk.Message, error) {
+	if instruction != "" {
+		// 与默认实现一致，用会话变量填充系统提示词中的占位符
+		if values := adk.GetSessionValues(ctx); len(values) > 0 {
+			msgs, err := prompt.FromMessages(schema.FString, schema.SystemMessage(instruction)).Format(ctx, values)
+			if err != nil {
+				return nil, err
+			}
+			instruction = msgs[0].Content
+		}
+	}
+
+	system, history := mergeLeadingSystem(instruction, input.Messages)
+	msgs := make([]adk.Message, 0, len(history)+1)
+	if system != "" {
+		msgs = append(msgs, schema.SystemMessage(system))
+	}
+	return append(msgs, history...), nil
+}
+
+// mergeLeadingSystem 将 messages 开头的系统消息追加到 system 之后，返回合并后的系统提示词和其余消息
+func mergeLeadingSystem(system string, messages []adk.Message) (string, []adk.Message) {
+	parts := []string{system}
+	for len(messages) > 0 && messages[0].Role == schema.System {
+		parts = append(parts, messages[0].Content)
+		messages = messages[1:]
+	}
+	return strings.TrimSpace(strings.Join(parts, "\n\n")), messages
+}
+
+// summarize 将新移出窗口的消息合并进滚动摘要
+func (s *Service) summarize(ctx context.Context, agentModel *agentmodel.Agent, previous string, messages []*schema.Message) (string, error) {
+	chatModel, err := s.newToolCallingChatModel(ctx, agentModel)
+	if err != nil {
+		return "", fmt.Errorf("failed to create chat model: %w", err)
+	}
+
+	var transcript strings.Builder
+	for _, msg := range messages {
+		switch {
+		case msg.Role == schema.Tool:
+			fmt.Fprintf(&transcript, "[工具 %s 结果] %s\n", msg.ToolName, msg.Content)
+		case len(msg.ToolCalls) > 0:
+			for _, call := range msg.ToolCalls {
+				fmt.Fprintf(&transcript, "[调用工具 %s] %s\n", call.Function.Name, call.Function.Arguments)
+			}
+			if msg.Content != "" {
+				fmt.Fprintf(&transcript, "%s: %s\n", msg.Role, msg.Content)
+			}
+		default:
+			fmt.Fprintf(&transcript, "%s: %s\n", msg.Role, msg.Content)
+		}
+	}
+
+	resp, err := chatModel.Generate(ctx, []*schema.Message{
+		schema.SystemMessage(summaryPrompt),
+		schema.UserMessage(fmt.Sprintf("已有摘要：\n%s\n\n新的对话内容：\n%s", previous, transcript.String())),
+	})
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(resp.Content), nil
+}
+
+// summaryPrompt 滚动摘要的生成要求
+const summaryPrompt = `你负责维护对话的滚动摘要。请将已有摘要与新的对话内容合并为一份新的摘要：
+- 保留用户的目标、偏好、已确认的事实和结论，以及工具调用得到的关键数据
+- 省略寒暄和重复内容
+- 使用与对话相同的语言，不超过 300 字
+- 只输出摘要本身`
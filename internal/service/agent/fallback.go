@@ -0,0 +1,216 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+	"syscall"
+	"time"
+
+	agentmodel "github.com/ashwinyue/next-ai/internal/model"
+	"github.com/cloudwego/eino/components/model"
+	"github.com/cloudwego/eino/schema"
+	ollamaapi "github.com/eino-contrib/ollama/api"
+	openai "github.com/meguminnnnnnnnn/go-openai"
+)
+
+// ========== 模型回退链 ==========
+//
+// Agent 的主模型之后可配置按顺序尝试的备用模型（Agent.FallbackModels）。
+// 每个模型遇到可重试错误（限流、超时、连接中断、5xx）时按指数退避重试，
+// 重试耗尽或遇到不可重试错误时切换到下一个模型
+
+const (
+	maxModelAttempts    = 3                      // 单个模型的最大尝试次数
+	modelRetryBaseDelay = 500 * time.Millisecond // 首次重试等待时间，之后逐次翻倍
+)
+
+// modelCandidate 回退链中的一个模型
+type modelCandidate struct {
+	name  string
+	model model.ToolCallingChatModel
+}
+
+// fallbackChatModel 按顺序尝试多个模型的 ChatModel
+// 流式调用只在建立流时回退，流开始输出后的错误直接返回
+type fallbackChatModel struct {
+	candidates []modelCandidate
+}
+
+func newFallbackChatModel(candidates []modelCandidate) *fallbackChatModel {
+	return &fallbackChatModel{candidates: candidates}
+}
+
+// Generate 依次尝试各模型生成回复
+func (m *fallbackChatModel) Generate(ctx context.Context, input []*schema.Message, opts ...model.Option) (*schema.Message, error) {
+	return tryCandidates(ctx, m.candidates, func(c modelCandidate) (*schema.Message, error) {
+		return c.model.Generate(ctx, input, opts...)
+	})
+}
+
+// Stream 依次尝试各模型建立流式输出
+func (m *fallbackChatModel) Stream(ctx context.Context, input []*schema.Message, opts ...model.Option) (*schema.StreamReader[*schema.Message], error) {
+	return tryCandidates(ctx, m.candidates, func(c modelCandidate) (*schema.StreamReader[*schema.Message], error) {
+		return c.model.Stream(ctx, input, opts...)
+	})
+}
+
+// WithTools 为回退链中的每个模型绑定工具
+func (m *fallbackChatModel) WithTools(tools []*schema.ToolInfo) (model.ToolCallingChatModel, error) {
+	candidates := make([]modelCandidate, 0, len(m.candidates))
+	for _, c := range m.candidates {
+		withTools, err := c.model.WithTools(tools)
+		if err != nil {
+			return nil, fmt.Errorf("failed to bind tools to model %s: %w", c.name, err)
+		}
+		candidates = append(candidates, modelCandidate{name: c.name, model: withTools})
+	}
+	return newFallbackChatModel(candidates), nil
+}
+
+// IsCallbacksEnabled 回调由实际调用的模型触发，避免重复记录
+func (m *fallbackChatModel) IsCallbacksEnabled() bool {
+	return true
+}
+
+// tryCandidates 按回退链顺序调用，成功时记录实际应答的模型
+func tryCandidates[T any](ctx context.Context, candidates []modelCandidate, call func(modelCandidate) (T, error)) (T, error) {
+	var zero T
+	var lastErr error
+	for _, c := range candidates {
+		result, err := callWithRetry(ctx, c, call)
+		if err == nil {
+			recordModel(ctx, c.name)
+			return result, nil
+		}
+		if ctx.Err() != nil {
+			return zero, err
+		}
+		log.Printf("Warning: model %s failed, trying next fallback: %v", c.name, err)
+		lastErr = err
+	}
+	if lastErr == nil {
+		return zero, fmt.Errorf("no chat model available")
+	}
+	return zero, fmt.Errorf("all models failed: %w", lastErr)
+}
+
+// callWithRetry 对单个模型按指数退避重试可重试错误
+func callWithRetry[T any](ctx context.Context, c modelCandidate, call func(modelCandidate) (T, error)) (T, error) {
+	var zero T
+	delay := modelRetryBaseDelay
+	for attempt := 1; ; attempt++ {
+		result, err := call(c)
+		if err == nil {
+			return result, nil
+		}
+		if attempt >= maxModelAttempts || !isRetryableError(ctx, err) {
+			return zero, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return zero, ctx.Err()
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+// isRetryableError 判断模型调用错误是否值得重试：超时、连接中断，
+// 以及提供商返回的限流（429）、请求超时（408）和服务端错误（5xx）
+func isRetryableError(ctx context.Context, err error) bool {
+	if ctx.Err() != nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	if errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ECONNRESET) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+
+	switch code := providerStatusCode(err); {
+	case code == http.StatusTooManyRequests, code == http.StatusRequestTimeout:
+		return true
+	case code >= http.StatusInternalServerError:
+		return true
+	}
+	return false
+}
+
+// providerStatusCode 返回模型提供商错误中的 HTTP 状态码，非 HTTP 错误时返回 0
+func providerStatusCode(err error) int {
+	var apiErr *openai.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.HTTPStatusCode
+	}
+	var reqErr *openai.RequestError
+	if errors.As(err, &reqErr) {
+		return reqErr.HTTPStatusCode
+	}
+	var statusErr ollamaapi.StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode
+	}
+	return 0
+}
+
+// modelRecorder 记录一次运行中实际应答的模型
+type modelRecorder struct {
+	mu    sync.Mutex
+	model string
+}
+
+type modelRecorderKey struct{}
+
+// withModelRecorder 在 context 中注入模型记录器
+func withModelRecorder(ctx context.Context) (context.Context, *modelRecorder) {
+	recorder := &modelRecorder{}
+	return context.WithValue(ctx, modelRecorderKey{}, recorder), recorder
+}
+
+// recordModel 记录实际应答的模型（最后一次成功调用）
+func recordModel(ctx context.Context, name string) {
+	recorder, ok := ctx.Value(modelRecorderKey{}).(*modelRecorder)
+	if !ok {
+		return
+	}
+	recorder.mu.Lock()
+	recorder.model = name
+	recorder.mu.Unlock()
+}
+
+// Model 返回实际应答的模型，未记录时为空
+func (r *modelRecorder) Model() string {
+	if r == nil {
+		return ""
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.model
+}
+
+// validateFallbackModels 校验备用模型均为 models 表中的对话模型
+func (s *Service) validateFallbackModels(ctx context.Context, modelIDs []string) error {
+	for _, id := range modelIDs {
+		m, err := s.modelSvc.GetModelByID(ctx, id)
+		if err != nil {
+			return fmt.Errorf("fallback model %s not found: %w", id, err)
+		}
+		if m.Type != agentmodel.ModelTypeChatModel {
+			return fmt.Errorf("fallback model %s is not a chat model", m.Name)
+		}
+	}
+	return nil
+}
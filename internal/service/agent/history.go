@@ -0,0 +1,179 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+
+	agentmodel "github.com/ashwinyue/next-ai/internal/model"
+	"github.com/cloudwego/eino/schema"
+	"github.com/google/uuid"
+)
+
+// ========== 会话消息持久化 ==========
+//
+// 一轮对话保存为完整记录：用户消息、助手消息（含工具调用、思考过程和 token 用量）
+// 以及工具结果，下一轮加载时还原为 schema.Message，模型能看到之前的工具上下文。
+// 消息通过 ParentID 组成树：编辑用户消息或重新生成回复时新的一轮挂在原位置形成兄弟分支，
+// 会话的当前叶子决定加载哪条路径
+
+// branchPoint 一轮对话在消息树中的位置
+type branchPoint struct {
+	ParentID      string `json:"parent_id,omitempty"`       // 新一轮挂在该消息之后，为空表示根消息
+	UserMessageID string `json:"user_message_id,omitempty"` // 重新生成时复用的用户消息（不再保存新的用户消息）
+}
+
+// resolveBranch 确定本轮的位置：未指定时接在会话当前叶子之后
+func (s *Service) resolveBranch(sessionID string, branch *branchPoint) branchPoint {
+	if branch != nil {
+		return *branch
+	}
+	leafID, err := s.repo.Chat.ResolveActiveLeaf(sessionID)
+	if err != nil {
+		log.Printf("Warning: failed to resolve active leaf for session %s: %v", sessionID, err)
+	}
+	return branchPoint{ParentID: leafID}
+}
+
+// saveTranscript 保存一轮对话并将其设为会话的当前分支
+// messages 为运行中产生的助手和工具消息，为空时保存 answer 作为助手回复；
+// 最后一条助手消息使用 replyID（流式运行公布的 message_id），为空时生成
+func (s *Service) saveTranscript(ctx context.Context, sessionID, replyID string, branch branchPoint, query string, messages []*schema.Message, answer string) {
+	if len(messages) == 0 {
+		messages = []*schema.Message{schema.AssistantMessage(answer, nil)}
+	}
+
+	lastAssistant := -1
+	for i, msg := range messages {
+		if msg.Role == schema.Assistant {
+			lastAssistant = i
+		}
+	}
+
+	// 同一轮的消息按顺序递增创建时间，保证加载顺序稳定
+	createdAt := time.Now()
+	records := make([]*agentmodel.ChatMessage, 0, len(messages)+1)
+	parentID := branch.UserMessageID
+	if parentID == "" {
+		user := &agentmodel.ChatMessage{
+			ID:        uuid.New().String(),
+			SessionID: sessionID,
+			ParentID:  branch.ParentID,
+			Role:      string(schema.User),
+			Content:   query,
+			CreatedAt: createdAt,
+		}
+		records = append(records, user)
+		parentID = user.ID
+	}
+	for i, msg := range messages {
+		record := messageToRecord(sessionID, msg)
+		if i == lastAssistant && replyID != "" {
+			record.ID = replyID
+		}
+		record.ParentID = parentID
+		record.CreatedAt = createdAt.Add(time.Duration(i+1) * time.Microsecond)
+		records = append(records, record)
+		parentID = record.ID
+	}
+
+	if err := s.repo.Chat.AppendMessages(sessionID, records); err != nil {
+		log.Printf("Warning: failed to save messages for session %s: %v", sessionID, err)
+	}
+}
+
+// messageToRecord 将 schema.Message 转换为数据库记录
+func messageToRecord(sessionID string, msg *schema.Message) *agentmodel.ChatMessage {
+	record := &agentmodel.ChatMessage{
+		ID:               uuid.New().String(),
+		SessionID:        sessionID,
+		Role:             string(msg.Role),
+		Content:          msg.Content,
+		ReasoningContent: msg.ReasoningContent,
+		ToolCallID:       msg.ToolCallID,
+		ToolName:         msg.ToolName,
+	}
+	if len(msg.ToolCalls) > 0 {
+		record.ToolCalls, _ = json.Marshal(msg.ToolCalls)
+	}
+	if msg.ResponseMeta != nil && msg.ResponseMeta.Usage != nil {
+		usage := msg.ResponseMeta.Usage
+		record.PromptTokens = usage.PromptTokens
+		record.CompletionTokens = usage.CompletionTokens
+		record.TokenUsed = usage.TotalTokens
+	}
+	return record
+}
+
+// recordToMessage 将数据库记录还原为 schema.Message
+func recordToMessage(record *agentmodel.ChatMessage) *schema.Message {
+	msg := &schema.Message{
+		Content:          record.Content,
+		ReasoningContent: record.ReasoningContent,
+	}
+
+	switch record.Role {
+	case "assistant":
+		msg.Role = schema.Assistant
+		if len(record.ToolCalls) > 0 {
+			if err := json.Unmarshal(record.ToolCalls, &msg.ToolCalls); err != nil {
+				log.Printf("Warning: invalid tool calls in message %s: %v", record.ID, err)
+			}
+		}
+	case "tool":
+		msg.Role = schema.Tool
+		msg.ToolCallID = record.ToolCallID
+		msg.ToolName = record.ToolName
+	case "system":
+		msg.Role = schema.System
+	default:
+		msg.Role = schema.User
+	}
+	return msg
+}
+
+// pairToolCalls 去掉没有对应结果的工具调用和没有对应调用的工具结果
+// （运行被停止或中断时可能只保存了一半），否则模型接口会拒绝该历史
+func pairToolCalls(messages []*schema.Message) []*schema.Message {
+	called := make(map[string]bool)
+	answered := make(map[string]bool)
+	for _, msg := range messages {
+		switch msg.Role {
+		case schema.Assistant:
+			for _, call := range msg.ToolCalls {
+				called[call.ID] = true
+			}
+		case schema.Tool:
+			answered[msg.ToolCallID] = true
+		}
+	}
+
+	result := make([]*schema.Message, 0, len(messages))
+	for _, msg := range messages {
+		switch msg.Role {
+		case schema.Assistant:
+			if len(msg.ToolCalls) > 0 {
+				calls := make([]schema.ToolCall, 0, len(msg.ToolCalls))
+				for _, call := range msg.ToolCalls {
+					if answered[call.ID] {
+						calls = append(calls, call)
+					}
+				}
+				if len(calls) == 0 {
+					calls = nil
+					if msg.Content == "" {
+						continue
+					}
+				}
+				msg.ToolCalls = calls
+			}
+		case schema.Tool:
+			if !called[msg.ToolCallID] {
+				continue
+			}
+		}
+		result = append(result, msg)
+	}
+	return result
+}
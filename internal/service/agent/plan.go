@@ -0,0 +1,266 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+
+	agentmodel "github.com/ashwinyue/next-ai/internal/model"
+	"github.com/cloudwego/eino/adk"
+	"github.com/cloudwego/eino/adk/prebuilt/planexecute"
+	"github.com/cloudwego/eino/components/tool"
+	"github.com/cloudwego/eino/compose"
+	"github.com/cloudwego/eino/schema"
+)
+
+// ========== Plan-Execute 模式 ==========
+//
+// planner 生成计划，executor 逐步执行，replanner 根据执行结果更新计划或给出最终回答。
+// 每次计划生成或更新后输出 plan_update 事件，并将计划保存到会话状态（State.Metadata），
+// 同一会话的下一轮运行将保存的计划提供给 planner，延续之前的进度
+
+// planMetadataKey 计划在会话状态 Metadata 中的 key
+const planMetadataKey = "plan"
+
+// PlanStep 已执行的计划步骤
+type PlanStep struct {
+	Step   string `json:"step"`
+	Result string `json:"result"`
+}
+
+// PlanUpdate 计划状态
+type PlanUpdate struct {
+	Steps     []string   `json:"steps"`     // 待执行的步骤
+	Completed []PlanStep `json:"completed"` // 已执行的步骤及结果
+}
+
+// newPlanExecuteAgent 创建 plan-execute Agent，三个阶段共用 Agent 配置的模型
+func (s *Service) newPlanExecuteAgent(ctx context.Context, agentModel *agentmodel.Agent, selectedTools []tool.BaseTool) (adk.Agent, error) {
+	chatModel, err := s.newToolCallingChatModel(ctx, agentModel)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create chat model: %w", err)
+	}
+
+	maxIter := agentModel.MaxIter
+	if maxIter <= 0 {
+		maxIter = 10
+	}
+
+	planner, err := planexecute.NewPlanner(ctx, &planexecute.PlannerConfig{
+		ToolCallingChatModel: chatModel,
+		GenInputFn:           genPlannerInput,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create planner: %w", err)
+	}
+
+	// 需要审批的工具在执行前中断
+	selectedTools, err = wrapApprovalTools(ctx, selectedTools, getToolNames(agentModel.ApprovalTools))
+	if err != nil {
+		return nil, err
+	}
+
+	executor, err := planexecute.NewExecutor(ctx, &planexecute.ExecutorConfig{
+		Model: chatModel,
+		ToolsConfig: adk.ToolsConfig{
+			ToolsNodeConfig: compose.ToolsNodeConfig{
+				Tools:               selectedTools,
+				ToolCallMiddlewares: DefaultMiddlewares(),
+			},
+		},
+		MaxIterations: maxIter,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create executor: %w", err)
+	}
+
+	replanner, err := planexecute.NewReplanner(ctx, &planexecute.ReplannerConfig{
+		ChatModel: chatModel,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create replanner: %w", err)
+	}
+
+	return planexecute.New(ctx, &planexecute.Config{
+		Planner:       &planReporter{Agent: planner},
+		Executor:      executor,
+		Replanner:     &planReporter{Agent: replanner},
+		MaxIterations: maxIter,
+	})
+}
+
+// planReporter 在 planner/replanner 运行结束后追加一个携带当前计划的事件
+type planReporter struct {
+	adk.Agent
+}
+
+// Run 转发内部 Agent 的事件，结束后输出 PlanUpdate
+func (p *planReporter) Run(ctx context.Context, input *adk.AgentInput, opts ...adk.AgentRunOption) *adk.AsyncIterator[*adk.AgentEvent] {
+	iter := p.Agent.Run(ctx, input, opts...)
+	outIter, gen := adk.NewAsyncIteratorPair[*adk.AgentEvent]()
+
+	go func() {
+		defer gen.Close()
+
+		for {
+			event, ok := iter.Next()
+			if !ok {
+				break
+			}
+			gen.Send(event)
+		}
+
+		if update := currentPlan(ctx); update != nil {
+			gen.Send(&adk.AgentEvent{
+				AgentName: p.Name(ctx),
+				Output:    &adk.AgentOutput{CustomizedOutput: update},
+			})
+		}
+	}()
+
+	return outIter
+}
+
+// currentPlan 从运行会话中读取当前计划和已执行步骤
+func currentPlan(ctx context.Context) *PlanUpdate {
+	value, ok := adk.GetSessionValue(ctx, planexecute.PlanSessionKey)
+	if !ok {
+		return nil
+	}
+	plan, ok := value.(planexecute.Plan)
+	if !ok {
+		return nil
+	}
+
+	data, err := json.Marshal(plan)
+	if err != nil {
+		return nil
+	}
+	update := &PlanUpdate{}
+	if err := json.Unmarshal(data, update); err != nil {
+		return nil
+	}
+
+	if value, ok := adk.GetSessionValue(ctx, planexecute.ExecutedStepsSessionKey); ok {
+		if steps, ok := value.([]planexecute.ExecutedStep); ok {
+			for _, step := range steps {
+				update.Completed = append(update.Completed, PlanStep{Step: step.Step, Result: step.Result})
+			}
+		}
+	}
+
+	return update
+}
+
+// previousPlanKey context 中上一轮计划的 key
+type previousPlanKey struct{}
+
+// withSavedPlan 将会话保存的计划写入 context，供下一轮 planner 参考
+// 仅 plan-execute 模式且会话存在计划时生效
+func (s *Service) withSavedPlan(ctx context.Context, agentModel *agentmodel.Agent, sessionID string) context.Context {
+	if agentModel.AgentMode != agentmodel.AgentModePlanExecute || sessionID == "" {
+		return ctx
+	}
+	plan, err := s.loadPlan(ctx, sessionID)
+	if err != nil {
+		log.Printf("Warning: session %s: %v", sessionID, err)
+		return ctx
+	}
+	if plan == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, previousPlanKey{}, plan)
+}
+
+// genPlannerInput 生成 planner 输入：历史开头的系统消息（会话摘要）和上一轮计划
+// 合并进 planner 的系统提示词
+func genPlannerInput(ctx context.Context, userInput []adk.Message) ([]adk.Message, error) {
+	var extra []adk.Message
+	for len(userInput) > 0 && userInput[0].Role == schema.System {
+		extra = append(extra, userInput[0])
+		userInput = userInput[1:]
+	}
+	if plan, ok := ctx.Value(previousPlanKey{}).(*PlanUpdate); ok {
+		extra = append(extra, schema.SystemMessage(formatPlan(plan)))
+	}
+
+	msgs, err := planexecute.PlannerPrompt.Format(ctx, map[string]any{
+		"input": userInput,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(extra) == 0 || len(msgs) == 0 || msgs[0].Role != schema.System {
+		return msgs, nil
+	}
+
+	system, _ := mergeLeadingSystem(msgs[0].Content, extra)
+	msgs[0] = schema.SystemMessage(system)
+	return msgs, nil
+}
+
+// formatPlan 将上一轮计划格式化为提示词
+func formatPlan(plan *PlanUpdate) string {
+	var b strings.Builder
+	b.WriteString("## PREVIOUS PLAN\n")
+	b.WriteString("上一轮对话的计划如下。如果本次目标是其延续，请跳过已完成的步骤，在剩余步骤基础上制定计划；否则忽略。\n")
+	if len(plan.Completed) > 0 {
+		b.WriteString("已完成的步骤：\n")
+		for i, step := range plan.Completed {
+			fmt.Fprintf(&b, "%d. %s\n   结果：%s\n", i+1, step.Step, step.Result)
+		}
+	}
+	if len(plan.Steps) > 0 {
+		b.WriteString("未完成的步骤：\n")
+		for i, step := range plan.Steps {
+			fmt.Fprintf(&b, "%d. %s\n", i+1, step)
+		}
+	}
+	return b.String()
+}
+
+// savePlan 将计划保存到会话状态
+func (s *Service) savePlan(ctx context.Context, sessionID string, update *PlanUpdate) {
+	if s.stateMgr == nil || sessionID == "" {
+		return
+	}
+	if err := s.stateMgr.SetMetadata(ctx, sessionID, planMetadataKey, update); err != nil {
+		log.Printf("Warning: failed to save plan of session %s: %v", sessionID, err)
+	}
+}
+
+// GetPlan 获取会话最近一次运行的计划，不存在时返回 nil
+func (s *Service) GetPlan(ctx context.Context, owner agentmodel.Owner, sessionID string) (*PlanUpdate, error) {
+	if err := s.checkSessionOwner(owner, sessionID); err != nil {
+		return nil, err
+	}
+	return s.loadPlan(ctx, sessionID)
+}
+
+// loadPlan 从会话状态读取计划，不存在时返回 nil
+func (s *Service) loadPlan(ctx context.Context, sessionID string) (*PlanUpdate, error) {
+	if s.stateMgr == nil {
+		return nil, nil
+	}
+
+	value, ok, err := s.stateMgr.GetMetadata(ctx, sessionID, planMetadataKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load plan: %w", err)
+	}
+	if !ok {
+		return nil, nil
+	}
+
+	// Metadata 经过 JSON 序列化，需重新解码为 PlanUpdate
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode plan: %w", err)
+	}
+	var plan PlanUpdate
+	if err := json.Unmarshal(data, &plan); err != nil {
+		return nil, fmt.Errorf("failed to decode plan: %w", err)
+	}
+	return &plan, nil
+}
@@ -0,0 +1,71 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+
+	svctypes "github.com/ashwinyue/next-ai/internal/service/types"
+	"github.com/cloudwego/eino/adk"
+)
+
+// ========== 可停止、可续传的会话流 ==========
+//
+// 带会话的流式运行注册到 session.Manager：运行与请求解耦（客户端断开后继续运行），
+// 事件按序号记录，可通过 message_id 停止，或从指定序号重放续传
+
+// startStream 注册会话流，返回可被停止的运行 context
+// 无会话或未配置流管理器时直接使用请求 context
+func (s *Service) startStream(ctx context.Context, run *streamRun) context.Context {
+	if run.SessionID == "" || s.streams == nil {
+		return ctx
+	}
+
+	ctx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	run.stream = s.streams.RegisterStream(run.SessionID, run.MessageID, cancel)
+	run.cancel = cancel
+	return ctx
+}
+
+// relayEvents 转发 Agent 事件：首个事件公布 message_id，
+// 每个事件分配序号（SSE id）并记录到会话流，结束时标记流完成
+func (s *Service) relayEvents(ctx context.Context, iter *adk.AsyncIterator[*adk.AgentEvent], run *streamRun) <-chan StreamEvent {
+	events := make(chan StreamEvent, 10)
+	go s.forwardEvents(ctx, iter, run, events)
+
+	outCh := make(chan StreamEvent, 10)
+	go func() {
+		defer close(outCh)
+
+		// 停止后 ctx 已取消，记录和收尾使用独立 context
+		recordCtx := context.WithoutCancel(ctx)
+		seq := 0
+		emit := func(evt StreamEvent) {
+			evt.Seq = seq
+			seq++
+			if evt.MessageID == "" {
+				evt.MessageID = run.MessageID
+			}
+			if run.stream != nil {
+				if data, err := json.Marshal(evt); err == nil {
+					run.stream.AppendEvent(recordCtx, data)
+				}
+				if evt.Type == svctypes.EventMessage {
+					run.stream.AppendChunk(evt.Data)
+				}
+			}
+			outCh <- evt
+		}
+
+		emit(StreamEvent{Type: svctypes.EventStreamStart})
+		for evt := range events {
+			emit(evt)
+		}
+
+		if run.stream != nil {
+			s.streams.FinishStream(recordCtx, run.SessionID, run.MessageID)
+			run.cancel()
+		}
+	}()
+
+	return outCh
+}
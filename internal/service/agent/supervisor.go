@@ -0,0 +1,109 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+
+	agentmodel "github.com/ashwinyue/next-ai/internal/model"
+	"github.com/cloudwego/eino/adk"
+	"github.com/cloudwego/eino/adk/prebuilt/supervisor"
+)
+
+// ========== Supervisor 多 Agent 模式 ==========
+//
+// supervisor 模式的 Agent 作为分诊者，通过 ADK 的 transfer_to_agent 将任务转交给
+// Agent.SubAgents 中的专家 Agent，子 Agent 完成后控制权回到 supervisor
+
+// validateAgentMode 验证 Agent 模式及 supervisor 的子 Agent 配置
+// selfID 为正在更新的 Agent ID（创建时为空），不允许将自身作为子 Agent
+func (s *Service) validateAgentMode(mode string, subAgentIDs []string, selfID string) error {
+	switch mode {
+	case agentmodel.AgentModeSmartReasoning, agentmodel.AgentModePlanExecute:
+		if len(subAgentIDs) > 0 {
+			return fmt.Errorf("sub_agents is only supported in '%s' mode", agentmodel.AgentModeSupervisor)
+		}
+		return nil
+	case agentmodel.AgentModeSupervisor:
+	default:
+		return fmt.Errorf("invalid agent_mode: %s, only '%s', '%s' and '%s' are supported", mode,
+			agentmodel.AgentModeSmartReasoning, agentmodel.AgentModeSupervisor, agentmodel.AgentModePlanExecute)
+	}
+
+	if len(subAgentIDs) == 0 {
+		return fmt.Errorf("supervisor agent requires at least one sub agent")
+	}
+
+	seen := make(map[string]bool, len(subAgentIDs))
+	for _, id := range subAgentIDs {
+		if id == selfID {
+			return fmt.Errorf("agent cannot be its own sub agent")
+		}
+		if seen[id] {
+			return fmt.Errorf("duplicate sub agent: %s", id)
+		}
+		seen[id] = true
+
+		sub, err := s.repo.Agent.GetByID(id)
+		if err != nil {
+			return fmt.Errorf("sub agent %s not found: %w", id, err)
+		}
+		if sub.AgentMode == agentmodel.AgentModeSupervisor {
+			return fmt.Errorf("sub agent %s is a supervisor, nested supervisors are not supported", sub.Name)
+		}
+	}
+
+	return nil
+}
+
+// loadSubAgents 加载 supervisor 配置的子 Agent（各自的已发布版本）
+func (s *Service) loadSubAgents(agentModel *agentmodel.Agent) ([]*agentmodel.Agent, error) {
+	ids := getToolNames(agentModel.SubAgents)
+	subAgents := make([]*agentmodel.Agent, 0, len(ids))
+	for _, id := range ids {
+		sub, err := s.loadPublishedAgent(id)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load sub agent %s: %w", id, err)
+		}
+		subAgents = append(subAgents, sub)
+	}
+	return subAgents, nil
+}
+
+// newSupervisorAgent 为 supervisor 挂载子 Agent，每个子 Agent 使用自己的工具和模型配置
+func (s *Service) newSupervisorAgent(ctx context.Context, agentModel *agentmodel.Agent, supervisorAgent *adk.ChatModelAgent, tenantID string) (adk.Agent, error) {
+	subModels, err := s.loadSubAgents(agentModel)
+	if err != nil {
+		return nil, err
+	}
+	if len(subModels) == 0 {
+		return nil, fmt.Errorf("supervisor agent %s has no sub agents", agentModel.Name)
+	}
+
+	subAgents := make([]adk.Agent, 0, len(subModels))
+	for _, sub := range subModels {
+		if sub.AgentMode == agentmodel.AgentModeSupervisor {
+			return nil, fmt.Errorf("sub agent %s is a supervisor, nested supervisors are not supported", sub.Name)
+		}
+
+		subTools, err := s.selectTools(ctx, sub, tenantID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to select tools for sub agent %s: %w", sub.Name, err)
+		}
+
+		// 转交工具依赖子 Agent 的描述选择目标
+		if sub.Description == "" {
+			sub.Description = sub.Name
+		}
+
+		subAgent, err := s.newChatModelAgent(ctx, sub, subTools)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create sub agent %s: %w", sub.Name, err)
+		}
+		subAgents = append(subAgents, subAgent)
+	}
+
+	return supervisor.New(ctx, &supervisor.Config{
+		Supervisor: supervisorAgent,
+		SubAgents:  subAgents,
+	})
+}
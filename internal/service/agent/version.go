@@ -0,0 +1,214 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	agentmodel "github.com/ashwinyue/next-ai/internal/model"
+	"github.com/google/uuid"
+)
+
+// ========== Agent 版本 ==========
+//
+// 创建和更新 Agent 时生成不可变的配置版本。Agent 记录保存最新（编辑中）的配置，
+// 运行使用已发布版本；带会话的运行在首次运行时固定版本，之后一直使用该版本，
+// 因此发布或回滚只影响新会话。未版本化的 Agent（内置 Agent、升级前创建且未修改过的 Agent）直接使用当前配置
+
+// initialVersionNote 首个版本的说明
+const initialVersionNote = "初始版本"
+
+// newVersion 将 Agent 当前配置记录为下一个版本
+func newVersion(agentModel *agentmodel.Agent, note string) *agentmodel.AgentVersion {
+	agentModel.LatestVersion++
+	return &agentmodel.AgentVersion{
+		ID:        uuid.New().String(),
+		AgentID:   agentModel.ID,
+		Version:   agentModel.LatestVersion,
+		Config:    agentModel.Config(),
+		Note:      note,
+		CreatedAt: time.Now(),
+	}
+}
+
+// applyVersion 用指定版本的配置覆盖 Agent，version 为 0 时保持当前配置
+func (s *Service) applyVersion(agentModel *agentmodel.Agent, version int) (*agentmodel.Agent, error) {
+	if version == 0 {
+		return agentModel, nil
+	}
+	v, err := s.repo.Agent.GetVersion(agentModel.ID, version)
+	if err != nil {
+		return nil, fmt.Errorf("agent %s version %d not found: %w", agentModel.Name, version, err)
+	}
+	agentModel.ApplyConfig(v.Config)
+	return agentModel, nil
+}
+
+// loadPublishedAgent 加载 Agent 的已发布配置（无会话的运行和子 Agent）
+func (s *Service) loadPublishedAgent(agentID string) (*agentmodel.Agent, error) {
+	agentModel, err := s.repo.Agent.GetByID(agentID)
+	if err != nil {
+		return nil, fmt.Errorf("agent not found: %w", err)
+	}
+	return s.applyVersion(agentModel, agentModel.PublishedVersion)
+}
+
+// loadRunAgent 加载本次运行使用的 Agent 配置：会话首次运行时固定当前发布版本，之后沿用固定的版本
+func (s *Service) loadRunAgent(agentID, sessionID string) (*agentmodel.Agent, error) {
+	agentModel, err := s.repo.Agent.GetByID(agentID)
+	if err != nil {
+		return nil, fmt.Errorf("agent not found: %w", err)
+	}
+	if sessionID == "" || agentModel.PublishedVersion == 0 {
+		return s.applyVersion(agentModel, agentModel.PublishedVersion)
+	}
+
+	version, err := s.repo.Chat.PinSessionAgentVersion(sessionID, agentID, agentModel.PublishedVersion)
+	if err != nil {
+		log.Printf("Warning: failed to pin agent version for session %s: %v", sessionID, err)
+	}
+	if version == 0 {
+		version = agentModel.PublishedVersion
+	}
+	return s.applyVersion(agentModel, version)
+}
+
+// ListVersions 列出 Agent 的版本（新版本在前）
+func (s *Service) ListVersions(ctx context.Context, agentID string) ([]*agentmodel.AgentVersion, error) {
+	if _, err := s.repo.Agent.GetByID(agentID); err != nil {
+		return nil, fmt.Errorf("agent not found: %w", err)
+	}
+	return s.repo.Agent.ListVersions(agentID)
+}
+
+// PublishVersion 发布指定版本，之后的新会话使用该版本
+func (s *Service) PublishVersion(ctx context.Context, agentID string, version int) (*agentmodel.Agent, error) {
+	agentModel, err := s.repo.Agent.GetByID(agentID)
+	if err != nil {
+		return nil, fmt.Errorf("agent not found: %w", err)
+	}
+	if _, err := s.repo.Agent.GetVersion(agentID, version); err != nil {
+		return nil, fmt.Errorf("version %d not found: %w", version, err)
+	}
+
+	if err := s.repo.Agent.UpdatePublishedVersion(agentID, version); err != nil {
+		return nil, fmt.Errorf("failed to publish version: %w", err)
+	}
+	agentModel.PublishedVersion = version
+	return agentModel, nil
+}
+
+// RollbackRequest 回滚请求
+type RollbackRequest struct {
+	Version int    `json:"version" binding:"required"`
+	Note    string `json:"note,omitempty"`
+}
+
+// Rollback 回滚到指定版本：以该版本的配置生成新版本并发布，编辑中的配置同时恢复
+func (s *Service) Rollback(ctx context.Context, agentID string, req *RollbackRequest) (*agentmodel.AgentVersion, error) {
+	agentModel, err := s.repo.Agent.GetByID(agentID)
+	if err != nil {
+		return nil, fmt.Errorf("agent not found: %w", err)
+	}
+	target, err := s.repo.Agent.GetVersion(agentID, req.Version)
+	if err != nil {
+		return nil, fmt.Errorf("version %d not found: %w", req.Version, err)
+	}
+
+	note := req.Note
+	if note == "" {
+		note = fmt.Sprintf("回滚到版本 %d", req.Version)
+	}
+	agentModel.ApplyConfig(target.Config)
+	agentModel.UpdatedAt = time.Now()
+	version := newVersion(agentModel, note)
+	agentModel.PublishedVersion = version.Version
+
+	if err := s.repo.Agent.UpdateWithVersions(agentModel, version); err != nil {
+		return nil, fmt.Errorf("failed to rollback agent: %w", err)
+	}
+	return version, nil
+}
+
+// VersionDiff 两个版本之间的配置差异
+type VersionDiff struct {
+	From    int           `json:"from"`
+	To      int           `json:"to"`
+	Changes []FieldChange `json:"changes"`
+}
+
+// FieldChange 单个配置字段的变化
+type FieldChange struct {
+	Field string          `json:"field"`
+	From  json.RawMessage `json:"from"`
+	To    json.RawMessage `json:"to"`
+}
+
+// DiffVersions 比较两个版本的配置，to 为 0 时与最新版本比较
+func (s *Service) DiffVersions(ctx context.Context, agentID string, from, to int) (*VersionDiff, error) {
+	agentModel, err := s.repo.Agent.GetByID(agentID)
+	if err != nil {
+		return nil, fmt.Errorf("agent not found: %w", err)
+	}
+	if to == 0 {
+		to = agentModel.LatestVersion
+	}
+
+	fromVersion, err := s.repo.Agent.GetVersion(agentID, from)
+	if err != nil {
+		return nil, fmt.Errorf("version %d not found: %w", from, err)
+	}
+	toVersion, err := s.repo.Agent.GetVersion(agentID, to)
+	if err != nil {
+		return nil, fmt.Errorf("version %d not found: %w", to, err)
+	}
+
+	changes, err := diffConfigs(fromVersion.Config, toVersion.Config)
+	if err != nil {
+		return nil, err
+	}
+	return &VersionDiff{From: from, To: to, Changes: changes}, nil
+}
+
+// diffConfigs 按 JSON 字段比较两份配置
+func diffConfigs(from, to agentmodel.AgentVersionConfig) ([]FieldChange, error) {
+	fromFields, err := configFields(from)
+	if err != nil {
+		return nil, err
+	}
+	toFields, err := configFields(to)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := make([]string, 0, len(toFields))
+	for field := range toFields {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	changes := make([]FieldChange, 0)
+	for _, field := range fields {
+		if !bytes.Equal(fromFields[field], toFields[field]) {
+			changes = append(changes, FieldChange{Field: field, From: fromFields[field], To: toFields[field]})
+		}
+	}
+	return changes, nil
+}
+
+// configFields 将配置展开为字段名到 JSON 值的映射
+func configFields(c agentmodel.AgentVersionConfig) (map[string]json.RawMessage, error) {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal agent config: %w", err)
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal agent config: %w", err)
+	}
+	return fields, nil
+}
@@ -2,11 +2,17 @@ package chat
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"log"
 	"strings"
+	"time"
 
 	"github.com/ashwinyue/next-ai/internal/model"
 	"github.com/ashwinyue/next-ai/internal/repository"
+	"github.com/ashwinyue/next-ai/internal/service/faq"
+	"github.com/ashwinyue/next-ai/internal/service/session"
+	svctypes "github.com/ashwinyue/next-ai/internal/service/types"
 	ecomodel "github.com/cloudwego/eino/components/model"
 	"github.com/cloudwego/eino/schema"
 	"github.com/google/uuid"
@@ -15,11 +21,11 @@ import (
 // Service 聊天服务
 type Service struct {
 	repo      *repository.Repositories
-	chatModel ecomodel.ChatModel
+	chatModel ecomodel.BaseChatModel
 }
 
 // NewService 创建聊天服务
-func NewService(repo *repository.Repositories, chatModel ecomodel.ChatModel) *Service {
+func NewService(repo *repository.Repositories, chatModel ecomodel.BaseChatModel) *Service {
 	return &Service{
 		repo:      repo,
 		chatModel: chatModel,
@@ -29,21 +35,19 @@ func NewService(repo *repository.Repositories, chatModel ecomodel.ChatModel) *Se
 // CreateSessionRequest 创建会话请求
 type CreateSessionRequest struct {
 	Title   string `json:"title"`
-	UserID  string `json:"user_id"`
 	AgentID string `json:"agent_id"`
 }
 
-// CreateSession 创建会话
-func (s *Service) CreateSession(ctx context.Context, req *CreateSessionRequest) (*model.ChatSession, error) {
+// CreateSession 创建会话，会话归属于调用方
+func (s *Service) CreateSession(ctx context.Context, owner model.Owner, req *CreateSessionRequest) (*model.ChatSession, error) {
 	session := &model.ChatSession{
 		ID:      uuid.New().String(),
-		UserID:  req.UserID,
 		AgentID: req.AgentID,
 		Title:   req.Title,
-		Status:  "active",
+		Status:  model.SessionStatusActive,
 	}
 
-	if err := s.repo.Chat.CreateSession(session); err != nil {
+	if err := s.repo.Chat.ForOwner(owner).CreateSession(session); err != nil {
 		return nil, fmt.Errorf("failed to create session: %w", err)
 	}
 
@@ -51,19 +55,28 @@ func (s *Service) CreateSession(ctx context.Context, req *CreateSessionRequest)
 }
 
 // GetSession 获取会话
-func (s *Service) GetSession(ctx context.Context, id string) (*model.ChatSession, error) {
-	return s.repo.Chat.GetSessionByID(id)
+func (s *Service) GetSession(ctx context.Context, owner model.Owner, id string) (*model.ChatSession, error) {
+	return s.repo.Chat.ForOwner(owner).GetSessionByID(id)
+}
+
+// CheckSession 校验会话存在且属于调用方
+func (s *Service) CheckSession(ctx context.Context, owner model.Owner, id string) error {
+	if _, err := s.repo.Chat.ForOwner(owner).GetSessionMeta(id); err != nil {
+		return fmt.Errorf("session not found: %w", err)
+	}
+	return nil
 }
 
 // ListSessionsRequest 列出会话请求
 type ListSessionsRequest struct {
-	UserID string `json:"user_id"`
-	Page   int    `json:"page"`
-	Size   int    `json:"size"`
+	Status  string `json:"status"`  // 为空时不限状态
+	Deleted bool   `json:"deleted"` // 列出回收站中的会话
+	Page    int    `json:"page"`
+	Size    int    `json:"size"`
 }
 
 // ListSessions 列出会话
-func (s *Service) ListSessions(ctx context.Context, req *ListSessionsRequest) ([]*model.ChatSession, int64, error) {
+func (s *Service) ListSessions(ctx context.Context, owner model.Owner, req *ListSessionsRequest) ([]*model.ChatSession, int64, error) {
 	if req.Page <= 0 {
 		req.Page = 1
 	}
@@ -73,18 +86,21 @@ func (s *Service) ListSessions(ctx context.Context, req *ListSessionsRequest) ([
 
 	offset := (req.Page - 1) * req.Size
 
-	sessions, err := s.repo.Chat.ListSessions(req.UserID, offset, req.Size)
+	sessions, total, err := s.repo.Chat.ForOwner(owner).ListSessions(&repository.SessionListFilter{
+		Status:  req.Status,
+		Deleted: req.Deleted,
+	}, offset, req.Size)
 	if err != nil {
 		return nil, 0, fmt.Errorf("failed to list sessions: %w", err)
 	}
 
-	total := int64(len(sessions))
 	return sessions, total, nil
 }
 
 // UpdateSession 更新会话
-func (s *Service) UpdateSession(ctx context.Context, id string, req *CreateSessionRequest) (*model.ChatSession, error) {
-	session, err := s.repo.Chat.GetSessionByID(id)
+func (s *Service) UpdateSession(ctx context.Context, owner model.Owner, id string, req *CreateSessionRequest) (*model.ChatSession, error) {
+	chatRepo := s.repo.Chat.ForOwner(owner)
+	session, err := chatRepo.GetSessionByID(id)
 	if err != nil {
 		return nil, fmt.Errorf("session not found: %w", err)
 	}
@@ -92,34 +108,29 @@ func (s *Service) UpdateSession(ctx context.Context, id string, req *CreateSessi
 	if req.Title != "" {
 		session.Title = req.Title
 	}
-	if req.AgentID != "" {
+	if req.AgentID != "" && req.AgentID != session.AgentID {
+		// 更换 Agent 后在下次运行时重新固定版本
 		session.AgentID = req.AgentID
+		session.AgentVersion = 0
 	}
 
-	if err := s.repo.Chat.UpdateSession(session); err != nil {
+	if err := chatRepo.UpdateSession(session); err != nil {
 		return nil, fmt.Errorf("failed to update session: %w", err)
 	}
 
 	return session, nil
 }
 
-// DeleteSession 删除会话
-func (s *Service) DeleteSession(ctx context.Context, id string) error {
-	if err := s.repo.Chat.DeleteSession(id); err != nil {
-		return fmt.Errorf("failed to delete session: %w", err)
-	}
-	return nil
-}
-
 // SendMessageRequest 发送消息请求
 type SendMessageRequest struct {
 	Role    string `json:"role" binding:"required"`
 	Content string `json:"content" binding:"required"`
 }
 
-// SendMessage 发送消息
-func (s *Service) SendMessage(ctx context.Context, sessionID string, req *SendMessageRequest) (*model.ChatMessage, error) {
-	_, err := s.repo.Chat.GetSessionByID(sessionID)
+// SendMessage 发送消息（追加到当前分支）
+func (s *Service) SendMessage(ctx context.Context, owner model.Owner, sessionID string, req *SendMessageRequest) (*model.ChatMessage, error) {
+	chatRepo := s.repo.Chat.ForOwner(owner)
+	leafID, err := chatRepo.ResolveActiveLeaf(sessionID)
 	if err != nil {
 		return nil, fmt.Errorf("session not found: %w", err)
 	}
@@ -127,20 +138,93 @@ func (s *Service) SendMessage(ctx context.Context, sessionID string, req *SendMe
 	message := &model.ChatMessage{
 		ID:        uuid.New().String(),
 		SessionID: sessionID,
+		ParentID:  leafID,
 		Role:      req.Role,
 		Content:   req.Content,
 	}
 
-	if err := s.repo.Chat.CreateMessage(message); err != nil {
+	if err := chatRepo.AppendMessages(sessionID, []*model.ChatMessage{message}); err != nil {
 		return nil, fmt.Errorf("failed to create message: %w", err)
 	}
 
 	return message, nil
 }
 
-// GetMessages 获取会话消息
-func (s *Service) GetMessages(ctx context.Context, sessionID string) ([]*model.ChatMessage, error) {
-	return s.repo.Chat.GetMessagesBySessionID(sessionID)
+// GetMessages 获取会话当前分支的消息
+func (s *Service) GetMessages(ctx context.Context, owner model.Owner, sessionID string) ([]*model.ChatMessage, error) {
+	chatRepo := s.repo.Chat.ForOwner(owner)
+	leafID, err := chatRepo.ResolveActiveLeaf(sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("session not found: %w", err)
+	}
+	return chatRepo.GetMessagePath(sessionID, leafID)
+}
+
+// MessageBranches 同一位置的分支（互为兄弟的消息）
+type MessageBranches struct {
+	ParentID string               `json:"parent_id"`
+	ActiveID string               `json:"active_id,omitempty"` // 位于当前分支上的消息
+	Messages []*model.ChatMessage `json:"messages"`
+}
+
+// ListBranches 列出与指定消息处于同一位置的所有分支
+func (s *Service) ListBranches(ctx context.Context, owner model.Owner, sessionID, messageID string) (*MessageBranches, error) {
+	message, err := s.getSessionMessage(owner, sessionID, messageID)
+	if err != nil {
+		return nil, err
+	}
+
+	siblings, err := s.repo.Chat.ForOwner(owner).ListChildMessages(sessionID, message.ParentID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list branches: %w", err)
+	}
+
+	path, err := s.GetMessages(ctx, owner, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	onPath := make(map[string]bool, len(path))
+	for _, msg := range path {
+		onPath[msg.ID] = true
+	}
+
+	branches := &MessageBranches{ParentID: message.ParentID, Messages: siblings}
+	for _, sibling := range siblings {
+		if onPath[sibling.ID] {
+			branches.ActiveID = sibling.ID
+			break
+		}
+	}
+	return branches, nil
+}
+
+// SwitchBranch 切换到指定消息所在的分支（沿最新的后续消息到达叶子），返回新的当前分支
+func (s *Service) SwitchBranch(ctx context.Context, owner model.Owner, sessionID, messageID string) ([]*model.ChatMessage, error) {
+	if _, err := s.getSessionMessage(owner, sessionID, messageID); err != nil {
+		return nil, err
+	}
+
+	chatRepo := s.repo.Chat.ForOwner(owner)
+	leafID, err := chatRepo.GetLatestLeaf(sessionID, messageID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find branch leaf: %w", err)
+	}
+	if err := chatRepo.UpdateActiveLeaf(sessionID, leafID); err != nil {
+		return nil, fmt.Errorf("failed to switch branch: %w", err)
+	}
+	return chatRepo.GetMessagePath(sessionID, leafID)
+}
+
+// getSessionMessage 获取会话中的消息
+func (s *Service) getSessionMessage(owner model.Owner, sessionID, messageID string) (*model.ChatMessage, error) {
+	message, err := s.repo.Chat.ForOwner(owner).GetMessageByID(messageID)
+	if err != nil {
+		return nil, fmt.Errorf("message not found: %w", err)
+	}
+	if message.SessionID != sessionID {
+		return nil, fmt.Errorf("message does not belong to this session")
+	}
+	return message, nil
 }
 
 // LoadMessagesRequest 加载消息请求
@@ -149,14 +233,8 @@ type LoadMessagesRequest struct {
 	BeforeTime string `json:"before_time"` // RFC3339Nano 格式
 }
 
-// LoadMessages 加载消息历史（支持分页和时间筛选）
-func (s *Service) LoadMessages(ctx context.Context, sessionID string, req *LoadMessagesRequest) ([]*model.ChatMessage, error) {
-	// 验证会话是否存在
-	_, err := s.repo.Chat.GetSessionByID(sessionID)
-	if err != nil {
-		return nil, fmt.Errorf("session not found: %w", err)
-	}
-
+// LoadMessages 加载当前分支的消息历史（支持分页和时间筛选，新消息在前）
+func (s *Service) LoadMessages(ctx context.Context, owner model.Owner, sessionID string, req *LoadMessagesRequest) ([]*model.ChatMessage, error) {
 	// 设置默认 limit
 	if req.Limit <= 0 {
 		req.Limit = 20
@@ -165,26 +243,34 @@ func (s *Service) LoadMessages(ctx context.Context, sessionID string, req *LoadM
 		req.Limit = 100
 	}
 
-	var messages []*model.ChatMessage
-
-	// 如果没有指定 beforeTime，获取最近的 N 条消息
-	if req.BeforeTime == "" {
-		messages, err = s.repo.Chat.GetRecentMessagesBySession(sessionID, req.Limit)
-	} else {
-		// 获取指定时间之前的消息
-		messages, err = s.repo.Chat.GetMessagesBySessionBeforeTime(sessionID, req.BeforeTime, req.Limit)
+	var before time.Time
+	if req.BeforeTime != "" {
+		t, err := time.Parse(time.RFC3339Nano, req.BeforeTime)
+		if err != nil {
+			return nil, fmt.Errorf("invalid before_time: %w", err)
+		}
+		before = t
 	}
 
+	path, err := s.GetMessages(ctx, owner, sessionID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to load messages: %w", err)
+		return nil, err
+	}
+
+	messages := make([]*model.ChatMessage, 0, req.Limit)
+	for i := len(path) - 1; i >= 0 && len(messages) < req.Limit; i-- {
+		if !before.IsZero() && !path[i].CreatedAt.Before(before) {
+			continue
+		}
+		messages = append(messages, path[i])
 	}
 
 	return messages, nil
 }
 
 // GetMessage 获取单条消息
-func (s *Service) GetMessage(ctx context.Context, messageID string) (*model.ChatMessage, error) {
-	message, err := s.repo.Chat.GetMessageByID(messageID)
+func (s *Service) GetMessage(ctx context.Context, owner model.Owner, messageID string) (*model.ChatMessage, error) {
+	message, err := s.repo.Chat.ForOwner(owner).GetMessageByID(messageID)
 	if err != nil {
 		return nil, fmt.Errorf("message not found: %w", err)
 	}
@@ -192,18 +278,13 @@ func (s *Service) GetMessage(ctx context.Context, messageID string) (*model.Chat
 }
 
 // DeleteMessage 删除消息
-func (s *Service) DeleteMessage(ctx context.Context, sessionID, messageID string) error {
+func (s *Service) DeleteMessage(ctx context.Context, owner model.Owner, sessionID, messageID string) error {
 	// 验证消息是否属于该会话
-	message, err := s.repo.Chat.GetMessageByID(messageID)
-	if err != nil {
-		return fmt.Errorf("message not found: %w", err)
+	if _, err := s.getSessionMessage(owner, sessionID, messageID); err != nil {
+		return err
 	}
 
-	if message.SessionID != sessionID {
-		return fmt.Errorf("message does not belong to this session")
-	}
-
-	if err := s.repo.Chat.DeleteMessage(messageID); err != nil {
+	if err := s.repo.Chat.ForOwner(owner).DeleteMessage(messageID); err != nil {
 		return fmt.Errorf("failed to delete message: %w", err)
 	}
 
@@ -219,9 +300,10 @@ type GenerateTitleRequest struct {
 
 // GenerateTitle 生成会话标题
 // 根据首条用户消息内容，使用 LLM 自动生成简短的会话标题
-func (s *Service) GenerateTitle(ctx context.Context, sessionID string, req *GenerateTitleRequest) (string, error) {
+func (s *Service) GenerateTitle(ctx context.Context, owner model.Owner, sessionID string, req *GenerateTitleRequest) (string, error) {
 	// 检查会话是否存在
-	session, err := s.repo.Chat.GetSessionByID(sessionID)
+	chatRepo := s.repo.Chat.ForOwner(owner)
+	session, err := chatRepo.GetSessionByID(sessionID)
 	if err != nil {
 		return "", fmt.Errorf("session not found: %w", err)
 	}
@@ -235,7 +317,7 @@ func (s *Service) GenerateTitle(ctx context.Context, sessionID string, req *Gene
 	if s.chatModel == nil {
 		defaultTitle := generateDefaultTitle(req.FirstMessage)
 		session.Title = defaultTitle
-		if err := s.repo.Chat.UpdateSession(session); err != nil {
+		if err := chatRepo.UpdateSession(session); err != nil {
 			return "", fmt.Errorf("failed to update session title: %w", err)
 		}
 		return defaultTitle, nil
@@ -254,7 +336,7 @@ func (s *Service) GenerateTitle(ctx context.Context, sessionID string, req *Gene
 		// 降级到默认标题
 		defaultTitle := generateDefaultTitle(req.FirstMessage)
 		session.Title = defaultTitle
-		if updateErr := s.repo.Chat.UpdateSession(session); updateErr != nil {
+		if updateErr := chatRepo.UpdateSession(session); updateErr != nil {
 			return "", fmt.Errorf("failed to update session title: %w", updateErr)
 		}
 		return defaultTitle, nil
@@ -279,7 +361,7 @@ func (s *Service) GenerateTitle(ctx context.Context, sessionID string, req *Gene
 
 	// 更新会话标题
 	session.Title = title
-	if err := s.repo.Chat.UpdateSession(session); err != nil {
+	if err := chatRepo.UpdateSession(session); err != nil {
 		return "", fmt.Errorf("failed to update session title: %w", err)
 	}
 
@@ -323,9 +405,10 @@ func truncateMessage(s string, maxLen int) string {
 // ========== Agent 聊天集成 ==========
 
 // AgentService Agent 服务接口
-// 使用 any 类型避免循环依赖
+// 请求使用 any 类型避免循环依赖，事件使用 types 包中的共享协议
 type AgentService interface {
-	StreamWithContext(ctx context.Context, agentID string, req interface{}) (<-chan interface{}, error)
+	StreamWithContext(ctx context.Context, agentID string, req interface{}) (<-chan svctypes.StreamEvent, error)
+	ReleaseSession(ctx context.Context, sessionID string)
 }
 
 // ServiceWithAgent 带 Agent 集成的聊天服务
@@ -333,35 +416,42 @@ type AgentService interface {
 type ServiceWithAgent struct {
 	*Service
 	agentSvc AgentService
+	faqSvc   *faq.Service     // 可选，租户开启 EnableFAQ 时在 Agent 之前匹配
+	streams  *session.Manager // 可选，记录 FAQ 回复的会话流
 }
 
 // NewServiceWithAgent 创建带 Agent 集成的聊天服务
-func NewServiceWithAgent(chatSvc *Service, agentSvc AgentService) *ServiceWithAgent {
+func NewServiceWithAgent(chatSvc *Service, agentSvc AgentService, faqSvc *faq.Service, streams *session.Manager) *ServiceWithAgent {
 	return &ServiceWithAgent{
 		Service:  chatSvc,
 		agentSvc: agentSvc,
+		faqSvc:   faqSvc,
+		streams:  streams,
 	}
 }
 
-// StreamEvent 流式事件
-type StreamEvent struct {
-	Type     string `json:"type"` // start, message, tool_call, error, end
-	Data     string `json:"data"`
-	ToolName string `json:"tool_name,omitempty"`
-}
+// StreamEvent 流式事件（与 agent 共用的事件协议）
+type StreamEvent = svctypes.StreamEvent
 
 // AgentChatRequest Agent 聊天请求
 type AgentChatRequest struct {
 	SessionID string `json:"session_id"`
 	AgentID   string `json:"agent_id"`
 	Query     string `json:"query"`
+	TenantID  string `json:"-"`
+	UserID    string `json:"-"`
+}
+
+// owner 请求方的会话归属
+func (r *AgentChatRequest) owner() model.Owner {
+	return model.Owner{TenantID: r.TenantID, UserID: r.UserID}
 }
 
 // AgentChat 调用 Agent 进行聊天（流式）
 // 兼容 WeKnora API: POST /api/v1/agent-chat/:session_id
 func (s *ServiceWithAgent) AgentChat(ctx context.Context, req *AgentChatRequest) (<-chan StreamEvent, error) {
 	// 验证会话是否存在
-	session, err := s.Service.GetSession(ctx, req.SessionID)
+	session, err := s.repo.Chat.ForOwner(req.owner()).GetSessionMeta(req.SessionID)
 	if err != nil {
 		return nil, fmt.Errorf("session not found: %w", err)
 	}
@@ -372,38 +462,93 @@ func (s *ServiceWithAgent) AgentChat(ctx context.Context, req *AgentChatRequest)
 		agentID = session.AgentID
 	}
 
+	// FAQ 高置信度命中时直接回答，不调用 Agent
+	if hit := s.matchFAQ(ctx, req); hit != nil {
+		return s.answerFromFAQ(ctx, req, hit), nil
+	}
+
 	// 构建运行时请求
 	runReq := map[string]interface{}{
 		"query":      req.Query,
 		"session_id": req.SessionID,
+		"tenant_id":  req.TenantID,
+		"user_id":    req.UserID,
 	}
 
 	// 调用 Agent 流式执行
-	rawCh, err := s.agentSvc.StreamWithContext(ctx, agentID, runReq)
+	eventCh, err := s.agentSvc.StreamWithContext(ctx, agentID, runReq)
 	if err != nil {
 		return nil, fmt.Errorf("failed to stream agent: %w", err)
 	}
 
-	// 转换事件格式
-	outCh := make(chan StreamEvent, 10)
-	go func() {
-		defer close(outCh)
-		for evt := range rawCh {
-			switch v := evt.(type) {
-			case map[string]interface{}:
-				evtType, _ := v["type"].(string)
-				data, _ := v["data"].(string)
-				toolName, _ := v["tool_name"].(string)
-				outCh <- StreamEvent{
-					Type:     evtType,
-					Data:     data,
-					ToolName: toolName,
-				}
-			case StreamEvent:
-				outCh <- v
+	return eventCh, nil
+}
+
+// matchFAQ 按租户配置匹配 FAQ，未开启或未命中时返回 nil
+func (s *ServiceWithAgent) matchFAQ(ctx context.Context, req *AgentChatRequest) *faq.SearchResult {
+	if s.faqSvc == nil || req.TenantID == "" {
+		return nil
+	}
+
+	tenant, err := s.repo.Tenant.GetByID(req.TenantID)
+	if err != nil || tenant.ConversationConfig == nil || !tenant.ConversationConfig.EnableFAQ {
+		return nil
+	}
+
+	hit, err := s.faqSvc.Match(ctx, req.TenantID, req.Query, tenant.ConversationConfig.FAQThreshold)
+	if err != nil {
+		log.Printf("Warning: faq match failed: %v", err)
+		return nil
+	}
+	return hit
+}
+
+// answerFromFAQ 使用 FAQ 答案直接回复并保存消息（追加到当前分支）
+func (s *ServiceWithAgent) answerFromFAQ(ctx context.Context, req *AgentChatRequest, hit *faq.SearchResult) <-chan StreamEvent {
+	chatRepo := s.repo.Chat.ForOwner(req.owner())
+	leafID, err := chatRepo.ResolveActiveLeaf(req.SessionID)
+	if err != nil {
+		log.Printf("Warning: failed to resolve active leaf: %v", err)
+	}
+	now := time.Now()
+	user := &model.ChatMessage{ID: uuid.New().String(), SessionID: req.SessionID, ParentID: leafID, Role: "user", Content: req.Query, CreatedAt: now}
+	reply := &model.ChatMessage{ID: uuid.New().String(), SessionID: req.SessionID, ParentID: user.ID, Role: "assistant", Content: hit.FAQ.Answer, CreatedAt: now.Add(time.Microsecond)}
+	if err := chatRepo.AppendMessages(req.SessionID, []*model.ChatMessage{user, reply}); err != nil {
+		log.Printf("Warning: failed to save faq message: %v", err)
+	}
+
+	// 与 Agent 回复一样注册会话流，使 FAQ 回复同样可以按 message_id 停止和续传
+	var stream *session.ActiveStream
+	if s.streams != nil {
+		stream = s.streams.RegisterStream(req.SessionID, reply.ID, nil)
+	}
+
+	events := []StreamEvent{
+		{Type: svctypes.EventStreamStart},
+		{Type: svctypes.EventFAQ, Data: hit.FAQ.ID},
+		{Type: svctypes.EventStart},
+		{Type: svctypes.EventMessage, Data: hit.FAQ.Answer},
+		{Type: svctypes.EventEnd},
+	}
+	outCh := make(chan StreamEvent, len(events))
+	for seq, evt := range events {
+		evt.Seq = seq
+		evt.MessageID = reply.ID
+		if stream != nil {
+			if data, err := json.Marshal(evt); err == nil {
+				stream.AppendEvent(ctx, data)
+			}
+			if evt.Type == svctypes.EventMessage {
+				stream.AppendChunk(evt.Data)
 			}
 		}
-	}()
+		outCh <- evt
+	}
+	close(outCh)
+
+	if stream != nil {
+		s.streams.FinishStream(ctx, req.SessionID, reply.ID)
+	}
 
-	return outCh, nil
+	return outCh
 }
@@ -0,0 +1,396 @@
+package chat
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/ashwinyue/next-ai/internal/model"
+	"github.com/ashwinyue/next-ai/internal/repository"
+	"github.com/cloudwego/eino/schema"
+	"github.com/google/uuid"
+)
+
+// ========== 会话导出与导入 ==========
+//
+// 单个会话可导出为 Markdown（阅读）、JSON（完整的消息树，可重新导入）和 JSONL（微调训练格式）；
+// Markdown 和 JSONL 只包含当前分支。批量导出按用户或租户将会话逐个写入 zip 流
+
+// 导出格式
+const (
+	ExportFormatMarkdown = "md"
+	ExportFormatJSON     = "json"
+	ExportFormatJSONL    = "jsonl"
+)
+
+// 会话导出格式标识
+const (
+	SessionExportKind    = "next-ai/session"
+	SessionExportVersion = 1
+)
+
+// exportBatchSize 批量导出时每次加载的会话数
+const exportBatchSize = 100
+
+// SessionExport 会话的 JSON 导出格式
+type SessionExport struct {
+	Kind       string            `json:"kind"`
+	Version    int               `json:"version"`
+	ExportedAt time.Time         `json:"exported_at"`
+	Session    ExportedSession   `json:"session"`
+	Messages   []ExportedMessage `json:"messages"` // 全部分支，按创建时间排序
+}
+
+// ExportedSession 导出的会话信息
+type ExportedSession struct {
+	ID           string    `json:"id"`
+	Title        string    `json:"title"`
+	AgentID      string    `json:"agent_id,omitempty"`
+	UserID       string    `json:"user_id,omitempty"`
+	Status       string    `json:"status"`
+	ActiveLeafID string    `json:"active_leaf_id,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// ExportedMessage 导出的消息
+type ExportedMessage struct {
+	ID               string          `json:"id"`
+	ParentID         string          `json:"parent_id,omitempty"`
+	Role             string          `json:"role"`
+	Content          string          `json:"content"`
+	ReasoningContent string          `json:"reasoning_content,omitempty"`
+	ToolCalls        json.RawMessage `json:"tool_calls,omitempty"`
+	ToolCallID       string          `json:"tool_call_id,omitempty"`
+	ToolName         string          `json:"tool_name,omitempty"`
+	PromptTokens     int             `json:"prompt_tokens,omitempty"`
+	CompletionTokens int             `json:"completion_tokens,omitempty"`
+	TokenUsed        int             `json:"token_used,omitempty"`
+	CreatedAt        time.Time       `json:"created_at"`
+}
+
+// ExportSession 按格式导出单个会话
+func (s *Service) ExportSession(ctx context.Context, owner model.Owner, sessionID, format string) ([]byte, error) {
+	chatRepo := s.repo.Chat.ForOwner(owner)
+	session, err := chatRepo.GetSessionMeta(sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("session not found: %w", err)
+	}
+	return exportSession(chatRepo, session, format)
+}
+
+// exportSession 导出会话
+func exportSession(chatRepo *repository.ChatRepository, session *model.ChatSession, format string) ([]byte, error) {
+	// 先补全早期会话的消息链，保证导入后分支结构一致
+	leafID, err := chatRepo.ResolveActiveLeaf(session.ID)
+	if err != nil {
+		return nil, fmt.Errorf("session not found: %w", err)
+	}
+	session.ActiveLeafID = leafID
+
+	switch format {
+	case ExportFormatJSON:
+		messages, err := chatRepo.GetMessagesBySessionID(session.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load messages: %w", err)
+		}
+		return json.MarshalIndent(newSessionExport(session, messages), "", "  ")
+	case ExportFormatMarkdown, ExportFormatJSONL:
+		path, err := chatRepo.GetMessagePath(session.ID, leafID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load messages: %w", err)
+		}
+		if format == ExportFormatMarkdown {
+			return renderMarkdown(session, path), nil
+		}
+		line, err := renderFineTuning(path)
+		if err != nil {
+			return nil, err
+		}
+		return append(line, '\n'), nil
+	default:
+		return nil, fmt.Errorf("unsupported export format: %s", format)
+	}
+}
+
+// newSessionExport 构建 JSON 导出结构
+func newSessionExport(session *model.ChatSession, messages []*model.ChatMessage) *SessionExport {
+	export := &SessionExport{
+		Kind:       SessionExportKind,
+		Version:    SessionExportVersion,
+		ExportedAt: time.Now(),
+		Session: ExportedSession{
+			ID:           session.ID,
+			Title:        session.Title,
+			AgentID:      session.AgentID,
+			UserID:       session.UserID,
+			Status:       session.Status,
+			ActiveLeafID: session.ActiveLeafID,
+			CreatedAt:    session.CreatedAt,
+			UpdatedAt:    session.UpdatedAt,
+		},
+		Messages: make([]ExportedMessage, 0, len(messages)),
+	}
+	for _, msg := range messages {
+		export.Messages = append(export.Messages, ExportedMessage{
+			ID:               msg.ID,
+			ParentID:         msg.ParentID,
+			Role:             msg.Role,
+			Content:          msg.Content,
+			ReasoningContent: msg.ReasoningContent,
+			ToolCalls:        json.RawMessage(msg.ToolCalls),
+			ToolCallID:       msg.ToolCallID,
+			ToolName:         msg.ToolName,
+			PromptTokens:     msg.PromptTokens,
+			CompletionTokens: msg.CompletionTokens,
+			TokenUsed:        msg.TokenUsed,
+			CreatedAt:        msg.CreatedAt,
+		})
+	}
+	return export
+}
+
+// renderMarkdown 将当前分支渲染为 Markdown
+func renderMarkdown(session *model.ChatSession, messages []*model.ChatMessage) []byte {
+	var b strings.Builder
+	title := session.Title
+	if title == "" {
+		title = "未命名会话"
+	}
+	fmt.Fprintf(&b, "# %s\n\n", title)
+	fmt.Fprintf(&b, "- 会话 ID：%s\n", session.ID)
+	if session.AgentID != "" {
+		fmt.Fprintf(&b, "- Agent：%s\n", session.AgentID)
+	}
+	fmt.Fprintf(&b, "- 创建时间：%s\n", session.CreatedAt.Format(time.DateTime))
+	fmt.Fprintf(&b, "- 导出时间：%s\n", time.Now().Format(time.DateTime))
+
+	for _, msg := range messages {
+		at := msg.CreatedAt.Format(time.DateTime)
+		switch msg.Role {
+		case "user":
+			fmt.Fprintf(&b, "\n## 用户 · %s\n\n%s\n", at, msg.Content)
+		case "assistant":
+			fmt.Fprintf(&b, "\n## 助手 · %s\n\n", at)
+			if msg.ReasoningContent != "" {
+				fmt.Fprintf(&b, "<details><summary>思考过程</summary>\n\n%s\n\n</details>\n\n", msg.ReasoningContent)
+			}
+			if msg.Content != "" {
+				fmt.Fprintf(&b, "%s\n", msg.Content)
+			}
+			for _, call := range decodeToolCalls(msg.ToolCalls) {
+				fmt.Fprintf(&b, "\n调用工具 `%s`：\n\n```json\n%s\n```\n", call.Function.Name, call.Function.Arguments)
+			}
+		case "tool":
+			fmt.Fprintf(&b, "\n## 工具结果 `%s` · %s\n\n```\n%s\n```\n", msg.ToolName, at, msg.Content)
+		default:
+			fmt.Fprintf(&b, "\n## %s · %s\n\n%s\n", msg.Role, at, msg.Content)
+		}
+	}
+	return []byte(b.String())
+}
+
+// fineTuningMessage OpenAI 微调格式的消息
+type fineTuningMessage struct {
+	Role       string               `json:"role"`
+	Content    string               `json:"content"`
+	ToolCalls  []fineTuningToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string               `json:"tool_call_id,omitempty"`
+}
+
+type fineTuningToolCall struct {
+	ID       string `json:"id"`
+	Type     string `json:"type"`
+	Function struct {
+		Name      string `json:"name"`
+		Arguments string `json:"arguments"`
+	} `json:"function"`
+}
+
+// renderFineTuning 将当前分支渲染为一行 OpenAI 微调格式：{"messages":[...]}
+func renderFineTuning(messages []*model.ChatMessage) ([]byte, error) {
+	out := make([]fineTuningMessage, 0, len(messages))
+	for _, msg := range messages {
+		ft := fineTuningMessage{Role: msg.Role, Content: msg.Content}
+		switch msg.Role {
+		case "assistant":
+			for _, call := range decodeToolCalls(msg.ToolCalls) {
+				tc := fineTuningToolCall{ID: call.ID, Type: "function"}
+				tc.Function.Name = call.Function.Name
+				tc.Function.Arguments = call.Function.Arguments
+				ft.ToolCalls = append(ft.ToolCalls, tc)
+			}
+		case "tool":
+			ft.ToolCallID = msg.ToolCallID
+		}
+		out = append(out, ft)
+	}
+	return json.Marshal(map[string]any{"messages": out})
+}
+
+// decodeToolCalls 解析消息记录中的工具调用
+func decodeToolCalls(data []byte) []schema.ToolCall {
+	if len(data) == 0 {
+		return nil
+	}
+	var calls []schema.ToolCall
+	if err := json.Unmarshal(data, &calls); err != nil {
+		return nil
+	}
+	return calls
+}
+
+// ExportSessionsRequest 批量导出请求
+type ExportSessionsRequest struct {
+	Format string
+}
+
+// ExportSessions 将调用方的会话批量导出为 zip 流：Markdown 和 JSON 每个会话一个文件，JSONL 合并为一个训练文件
+func (s *Service) ExportSessions(ctx context.Context, owner model.Owner, w io.Writer, req *ExportSessionsRequest) error {
+	switch req.Format {
+	case ExportFormatMarkdown, ExportFormatJSON, ExportFormatJSONL:
+	default:
+		return fmt.Errorf("unsupported export format: %s", req.Format)
+	}
+
+	chatRepo := s.repo.Chat.ForOwner(owner)
+
+	archive := zip.NewWriter(w)
+	var jsonl io.Writer
+	if req.Format == ExportFormatJSONL {
+		f, err := archive.Create("sessions.jsonl")
+		if err != nil {
+			return err
+		}
+		jsonl = f
+	}
+
+	// 按游标分页，导出期间新建、置顶或删除会话不会造成重复或遗漏
+	var cursor *repository.SessionCursor
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		sessions, err := chatRepo.ListSessionsAfter(&repository.SessionListFilter{}, cursor, exportBatchSize)
+		if err != nil {
+			return fmt.Errorf("failed to list sessions: %w", err)
+		}
+
+		for _, session := range sessions {
+			data, err := exportSession(chatRepo, session, req.Format)
+			if err != nil {
+				return fmt.Errorf("failed to export session %s: %w", session.ID, err)
+			}
+			if jsonl != nil {
+				if _, err := jsonl.Write(data); err != nil {
+					return err
+				}
+				continue
+			}
+			f, err := archive.Create(session.ID + "." + req.Format)
+			if err != nil {
+				return err
+			}
+			if _, err := f.Write(data); err != nil {
+				return err
+			}
+		}
+
+		if len(sessions) < exportBatchSize {
+			break
+		}
+		cursor = sessionCursor(sessions[len(sessions)-1])
+	}
+
+	return archive.Close()
+}
+
+// ImportSession 从 JSON 导出格式重建会话：生成新的会话和消息 ID，保留消息树、时间戳和当前分支
+func (s *Service) ImportSession(ctx context.Context, owner model.Owner, data []byte) (*model.ChatSession, error) {
+	var export SessionExport
+	if err := json.Unmarshal(data, &export); err != nil {
+		return nil, fmt.Errorf("invalid session export: %w", err)
+	}
+	if export.Kind != SessionExportKind {
+		return nil, fmt.Errorf("unsupported export kind: %q", export.Kind)
+	}
+	if export.Version < 1 || export.Version > SessionExportVersion {
+		return nil, fmt.Errorf("unsupported export version: %d", export.Version)
+	}
+
+	session := &model.ChatSession{
+		ID:        uuid.New().String(),
+		Title:     export.Session.Title,
+		Status:    export.Session.Status,
+		CreatedAt: export.Session.CreatedAt,
+	}
+	switch session.Status {
+	case "":
+		session.Status = model.SessionStatusActive
+	case model.SessionStatusActive, model.SessionStatusArchived:
+	default:
+		return nil, fmt.Errorf("unsupported session status: %q", session.Status)
+	}
+	// Agent 在当前环境存在时保留绑定
+	if export.Session.AgentID != "" {
+		if _, err := s.repo.Agent.GetByID(export.Session.AgentID); err == nil {
+			session.AgentID = export.Session.AgentID
+		}
+	}
+
+	ids := make(map[string]string, len(export.Messages))
+	for _, msg := range export.Messages {
+		if msg.ID == "" {
+			return nil, fmt.Errorf("message id is required")
+		}
+		if _, dup := ids[msg.ID]; dup {
+			return nil, fmt.Errorf("duplicate message id: %s", msg.ID)
+		}
+		ids[msg.ID] = uuid.New().String()
+	}
+
+	now := time.Now()
+	messages := make([]*model.ChatMessage, 0, len(export.Messages))
+	for i, msg := range export.Messages {
+		switch msg.Role {
+		case "user", "assistant", "tool", "system":
+		default:
+			return nil, fmt.Errorf("invalid role %q in message %s", msg.Role, msg.ID)
+		}
+		createdAt := msg.CreatedAt
+		if createdAt.IsZero() {
+			createdAt = now.Add(time.Duration(i) * time.Microsecond)
+		}
+		messages = append(messages, &model.ChatMessage{
+			ID:               ids[msg.ID],
+			SessionID:        session.ID,
+			ParentID:         ids[msg.ParentID], // 父消息不在导出中时成为根消息
+			Role:             msg.Role,
+			Content:          msg.Content,
+			ReasoningContent: msg.ReasoningContent,
+			ToolCalls:        []byte(msg.ToolCalls),
+			ToolCallID:       msg.ToolCallID,
+			ToolName:         msg.ToolName,
+			PromptTokens:     msg.PromptTokens,
+			CompletionTokens: msg.CompletionTokens,
+			TokenUsed:        msg.TokenUsed,
+			CreatedAt:        createdAt,
+		})
+	}
+
+	// 当前分支：导出中的叶子，缺失时使用最后一条消息
+	session.ActiveLeafID = ids[export.Session.ActiveLeafID]
+	if session.ActiveLeafID == "" && len(messages) > 0 {
+		session.ActiveLeafID = messages[len(messages)-1].ID
+	}
+
+	if err := s.repo.Chat.ForOwner(owner).CreateSessionWithMessages(session, messages); err != nil {
+		return nil, fmt.Errorf("failed to import session: %w", err)
+	}
+	return session, nil
+}
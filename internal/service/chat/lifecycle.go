@@ -0,0 +1,192 @@
+package chat
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/ashwinyue/next-ai/internal/model"
+	"github.com/ashwinyue/next-ai/internal/repository"
+	"gorm.io/gorm"
+)
+
+// ========== 会话生命周期 ==========
+//
+// 会话可归档（status=archived，不出现在默认列表）和置顶。删除先移入回收站（软删除，保留消息），
+// 同时停止会话的流并清理 Redis 中的运行时数据；从回收站永久删除或清空回收站时才删除消息
+
+// SessionPage 游标分页结果
+type SessionPage struct {
+	Items      []*model.ChatSession `json:"items"`
+	NextCursor string               `json:"next_cursor,omitempty"`
+	HasMore    bool                 `json:"has_more"`
+	Total      int64                `json:"total"`
+}
+
+// ListSessionsByCursorRequest 游标分页请求
+type ListSessionsByCursorRequest struct {
+	Status string // 为空时不限状态
+	Cursor string // 上一页返回的 next_cursor，为空时从第一页开始
+	Size   int
+}
+
+// ListSessionsByCursor 按游标列出会话，翻页期间新建的会话不会造成重复或遗漏
+func (s *Service) ListSessionsByCursor(ctx context.Context, owner model.Owner, req *ListSessionsByCursorRequest) (*SessionPage, error) {
+	if req.Size <= 0 || req.Size > 100 {
+		req.Size = 20
+	}
+	cursor, err := decodeSessionCursor(req.Cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	chatRepo := s.repo.Chat.ForOwner(owner)
+	filter := &repository.SessionListFilter{Status: req.Status}
+	sessions, err := chatRepo.ListSessionsAfter(filter, cursor, req.Size+1)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sessions: %w", err)
+	}
+	total, err := chatRepo.CountSessions(filter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count sessions: %w", err)
+	}
+
+	page := &SessionPage{Items: sessions, Total: total}
+	if len(sessions) > req.Size {
+		page.Items = sessions[:req.Size]
+		page.HasMore = true
+		page.NextCursor = encodeSessionCursor(sessionCursor(page.Items[len(page.Items)-1]))
+	}
+	return page, nil
+}
+
+// sessionCursor 返回指向 session 之后的游标
+func sessionCursor(session *model.ChatSession) *repository.SessionCursor {
+	return &repository.SessionCursor{
+		PinnedAt:  session.PinnedAt,
+		CreatedAt: session.CreatedAt,
+		ID:        session.ID,
+	}
+}
+
+// encodeSessionCursor 将游标编码为不透明字符串
+func encodeSessionCursor(cursor *repository.SessionCursor) string {
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeSessionCursor 解析游标，空字符串返回 nil
+func decodeSessionCursor(s string) (*repository.SessionCursor, error) {
+	if s == "" {
+		return nil, nil
+	}
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor: %w", err)
+	}
+	var cursor repository.SessionCursor
+	if err := json.Unmarshal(data, &cursor); err != nil || cursor.ID == "" {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	return &cursor, nil
+}
+
+// ArchiveSession 归档会话
+func (s *Service) ArchiveSession(ctx context.Context, owner model.Owner, id string) (*model.ChatSession, error) {
+	return s.setSessionStatus(owner, id, model.SessionStatusArchived)
+}
+
+// UnarchiveSession 取消归档
+func (s *Service) UnarchiveSession(ctx context.Context, owner model.Owner, id string) (*model.ChatSession, error) {
+	return s.setSessionStatus(owner, id, model.SessionStatusActive)
+}
+
+// setSessionStatus 更新会话状态
+func (s *Service) setSessionStatus(owner model.Owner, id, status string) (*model.ChatSession, error) {
+	chatRepo := s.repo.Chat.ForOwner(owner)
+	session, err := chatRepo.GetSessionMeta(id)
+	if err != nil {
+		return nil, fmt.Errorf("session not found: %w", err)
+	}
+	if err := chatRepo.UpdateSessionStatus(id, status); err != nil {
+		return nil, fmt.Errorf("failed to update session status: %w", err)
+	}
+	session.Status = status
+	return session, nil
+}
+
+// PinSession 置顶或取消置顶会话
+func (s *Service) PinSession(ctx context.Context, owner model.Owner, id string, pinned bool) (*model.ChatSession, error) {
+	chatRepo := s.repo.Chat.ForOwner(owner)
+	session, err := chatRepo.GetSessionMeta(id)
+	if err != nil {
+		return nil, fmt.Errorf("session not found: %w", err)
+	}
+
+	var pinnedAt *time.Time
+	if pinned {
+		now := time.Now()
+		pinnedAt = &now
+	}
+	if err := chatRepo.UpdateSessionPinned(id, pinnedAt); err != nil {
+		return nil, fmt.Errorf("failed to pin session: %w", err)
+	}
+	session.PinnedAt = pinnedAt
+	return session, nil
+}
+
+// RestoreSession 从回收站恢复会话
+func (s *Service) RestoreSession(ctx context.Context, owner model.Owner, id string) (*model.ChatSession, error) {
+	chatRepo := s.repo.Chat.ForOwner(owner)
+	session, err := chatRepo.GetDeletedSession(id)
+	if err != nil {
+		return nil, fmt.Errorf("session not found in trash: %w", err)
+	}
+	if err := chatRepo.RestoreSession(id); err != nil {
+		return nil, fmt.Errorf("failed to restore session: %w", err)
+	}
+	session.DeletedAt = gorm.DeletedAt{}
+	return session, nil
+}
+
+// EmptyTrash 清空用户的回收站，返回永久删除的会话数
+func (s *Service) EmptyTrash(ctx context.Context, owner model.Owner) (int64, error) {
+	if owner.UserID == "" {
+		return 0, fmt.Errorf("user_id is required")
+	}
+	purged, err := s.repo.Chat.ForOwner(owner).PurgeDeletedSessions(owner.UserID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to empty trash: %w", err)
+	}
+	return purged, nil
+}
+
+// DeleteSession 将会话移入回收站，并停止其流、清理运行时数据
+func (s *ServiceWithAgent) DeleteSession(ctx context.Context, owner model.Owner, id string) error {
+	chatRepo := s.repo.Chat.ForOwner(owner)
+	if _, err := chatRepo.GetSessionMeta(id); err != nil {
+		return fmt.Errorf("session not found: %w", err)
+	}
+	if err := chatRepo.DeleteSession(id); err != nil {
+		return fmt.Errorf("failed to delete session: %w", err)
+	}
+	s.agentSvc.ReleaseSession(ctx, id)
+	return nil
+}
+
+// PurgeSession 永久删除会话及其消息（会话可以在回收站中，也可以未删除）
+func (s *ServiceWithAgent) PurgeSession(ctx context.Context, owner model.Owner, id string) error {
+	chatRepo := s.repo.Chat.ForOwner(owner)
+	if _, err := chatRepo.GetSessionMeta(id); err != nil {
+		if _, err := chatRepo.GetDeletedSession(id); err != nil {
+			return fmt.Errorf("session not found: %w", err)
+		}
+	}
+	s.agentSvc.ReleaseSession(ctx, id)
+	if err := chatRepo.PurgeSession(id); err != nil {
+		return fmt.Errorf("failed to purge session: %w", err)
+	}
+	return nil
+}
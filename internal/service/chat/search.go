@@ -0,0 +1,204 @@
+package chat
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/ashwinyue/next-ai/internal/model"
+	"github.com/ashwinyue/next-ai/internal/pkg/tokenizer"
+	"github.com/ashwinyue/next-ai/internal/repository"
+)
+
+// ========== 会话检索 ==========
+//
+// PostgreSQL 内置分词器不切分中文，因此消息在写入时按 tokenizer（中文单字 + 双字）生成检索文本，
+// 以 simple 配置建立 tsvector 索引；查询词按同样的方式分词后匹配。标题使用 ILIKE 匹配。
+// 高亮片段在应用层生成，原文经过 HTML 转义，命中部分以 <mark> 包裹
+
+// 片段参数
+const (
+	searchMatchesPerSession = 3  // 每个会话返回的命中消息数
+	snippetBefore           = 30 // 片段中首个命中之前保留的字符数
+	snippetLength           = 120
+	highlightOpen           = "<mark>"
+	highlightClose          = "</mark>"
+)
+
+// SearchSessionsRequest 会话检索请求
+type SearchSessionsRequest struct {
+	Query   string
+	AgentID string
+	Status  string
+	From    *time.Time
+	To      *time.Time
+	Page    int
+	Size    int
+}
+
+// SessionSearchResult 会话检索结果
+type SessionSearchResult struct {
+	Session        *model.ChatSession `json:"session"`
+	TitleHighlight string             `json:"title_highlight"`
+	Matches        []*MessageMatch    `json:"matches"`
+}
+
+// MessageMatch 命中的消息及高亮片段
+type MessageMatch struct {
+	MessageID string    `json:"message_id"`
+	Role      string    `json:"role"`
+	Snippet   string    `json:"snippet"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// SearchSessions 按关键词检索会话标题和消息内容
+func (s *Service) SearchSessions(ctx context.Context, owner model.Owner, req *SearchSessionsRequest) ([]*SessionSearchResult, int64, error) {
+	if req.Page <= 0 {
+		req.Page = 1
+	}
+	if req.Size <= 0 || req.Size > 100 {
+		req.Size = 20
+	}
+
+	keywords := strings.Fields(req.Query)
+	tokens := tokenizer.Tokenize(req.Query)
+	if len(keywords) == 0 || len(tokens) == 0 {
+		return nil, 0, fmt.Errorf("query is required")
+	}
+
+	chatRepo := s.repo.Chat.ForOwner(owner)
+	filter := &repository.SessionSearchFilter{
+		Tokens:   strings.Join(tokens, " "),
+		Keywords: keywords,
+		AgentID:  req.AgentID,
+		Status:   req.Status,
+		From:     req.From,
+		To:       req.To,
+	}
+	sessions, total, err := chatRepo.SearchSessions(filter, (req.Page-1)*req.Size, req.Size)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to search sessions: %w", err)
+	}
+
+	sessionIDs := make([]string, len(sessions))
+	for i, session := range sessions {
+		sessionIDs[i] = session.ID
+	}
+	messages, err := chatRepo.SearchMessages(sessionIDs, filter, searchMatchesPerSession)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to search messages: %w", err)
+	}
+	matches := make(map[string][]*MessageMatch)
+	terms := highlightTerms(req.Query)
+	for _, msg := range messages {
+		matches[msg.SessionID] = append(matches[msg.SessionID], &MessageMatch{
+			MessageID: msg.ID,
+			Role:      msg.Role,
+			Snippet:   highlight(msg.Content, terms, snippetLength),
+			CreatedAt: msg.CreatedAt,
+		})
+	}
+
+	results := make([]*SessionSearchResult, len(sessions))
+	for i, session := range sessions {
+		results[i] = &SessionSearchResult{
+			Session:        session,
+			TitleHighlight: highlight(session.Title, terms, 0),
+			Matches:        matches[session.ID],
+		}
+		if results[i].Matches == nil {
+			results[i].Matches = []*MessageMatch{}
+		}
+	}
+	return results, total, nil
+}
+
+// highlightTerms 高亮词：查询中的各个关键词及其分词结果（忽略中文单字，避免高亮过碎）
+func highlightTerms(query string) [][]rune {
+	seen := make(map[string]bool)
+	var terms [][]rune
+	add := func(term string) {
+		term = strings.ToLower(term)
+		if term != "" && !seen[term] {
+			seen[term] = true
+			terms = append(terms, []rune(term))
+		}
+	}
+
+	for _, keyword := range strings.Fields(query) {
+		add(keyword)
+		for _, t := range tokenizer.Tokenize(keyword) {
+			if utf8.RuneCountInString(t) == 1 && tokenizer.IsCJK([]rune(t)[0]) {
+				continue
+			}
+			add(t)
+		}
+	}
+	return terms
+}
+
+// highlight 以首个命中位置为中心截取片段并标记所有命中，limit 为 0 时不截取
+func highlight(text string, terms [][]rune, limit int) string {
+	runes := []rune(strings.Join(strings.Fields(text), " "))
+	lower := []rune(strings.ToLower(string(runes)))
+	if len(lower) != len(runes) {
+		lower = runes
+	}
+
+	marked := make([]bool, len(runes))
+	first := -1
+	for _, term := range terms {
+		for i := 0; i+len(term) <= len(lower); i++ {
+			if !hasPrefixAt(lower, term, i) {
+				continue
+			}
+			for j := i; j < i+len(term); j++ {
+				marked[j] = true
+			}
+			if first < 0 || i < first {
+				first = i
+			}
+		}
+	}
+
+	start, end := 0, len(runes)
+	if limit > 0 && len(runes) > limit {
+		start = max(0, first-snippetBefore)
+		end = min(len(runes), start+limit)
+	}
+
+	var b strings.Builder
+	if start > 0 {
+		b.WriteString("…")
+	}
+	for i := start; i < end; {
+		j := i
+		for j < end && marked[j] == marked[i] {
+			j++
+		}
+		chunk := html.EscapeString(string(runes[i:j]))
+		if marked[i] {
+			b.WriteString(highlightOpen + chunk + highlightClose)
+		} else {
+			b.WriteString(chunk)
+		}
+		i = j
+	}
+	if end < len(runes) {
+		b.WriteString("…")
+	}
+	return b.String()
+}
+
+// hasPrefixAt 判断 text 在位置 i 处是否以 term 开头
+func hasPrefixAt(text, term []rune, i int) bool {
+	for k, c := range term {
+		if text[i+k] != c {
+			return false
+		}
+	}
+	return true
+}
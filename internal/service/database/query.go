@@ -5,17 +5,25 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"regexp"
 	"strings"
+	"sync"
+	"time"
 
+	"github.com/ashwinyue/next-ai/internal/model"
 	"github.com/cloudwego/eino/components/tool"
 	"github.com/cloudwego/eino/schema"
 	pg_query "github.com/pganalyze/pg_query_go/v6"
 	"gorm.io/gorm"
+	gormschema "gorm.io/gorm/schema"
 )
 
 const (
 	ToolDatabaseQuery = "database_query"
+
+	// queryTimeout 单次查询的语句超时
+	queryTimeout = 10 * time.Second
+	// maxQueryRows 单次查询最多返回的行数
+	maxQueryRows = 100
 )
 
 // DatabaseQueryInput 数据库查询输入参数
@@ -34,27 +42,7 @@ type SQLSecurityValidator struct {
 // NewSQLSecurityValidator 创建 SQL 安全验证器
 func NewSQLSecurityValidator(tenantID string) *SQLSecurityValidator {
 	return &SQLSecurityValidator{
-		allowedTables: map[string]bool{
-			// 用户表
-			"users": true,
-			// 知识库表
-			"knowledge_bases": true,
-			"knowledges":      true,
-			"chunks":          true,
-			"chunk_tags":      true,
-			// 聊天表
-			"chat_sessions": true,
-			"chat_messages": true,
-			// Agent 表
-			"agents": true,
-			// 工具表
-			"tools": true,
-			// FAQ 表
-			"faqs":        true,
-			"faq_entries": true,
-			// 模型表
-			"models": true,
-		},
+		allowedTables: defaultAllowedTables(),
 		allowedFunctions: map[string]bool{
 			// 聚合函数
 			"count": true, "sum": true, "avg": true, "min": true, "max": true,
@@ -76,51 +64,103 @@ func NewSQLSecurityValidator(tenantID string) *SQLSecurityValidator {
 	}
 }
 
+// defaultAllowedTables 默认允许查询的表
+// 查询始终按租户执行，只开放带 tenant_id 列、能够注入租户过滤条件的表
+func defaultAllowedTables() map[string]bool {
+	tables := make(map[string]bool)
+	for _, name := range []string{
+		// 用户表
+		"users",
+		// 知识库表
+		"knowledge_bases", "knowledges", "chunks",
+		// 聊天表
+		"chat_sessions",
+		// FAQ 表
+		"faqs",
+	} {
+		if tablesWithTenantID[name] {
+			tables[name] = true
+		}
+	}
+	return tables
+}
+
+// RestrictTables 将允许查询的表限制为 tables 与默认白名单的交集
+// tables 为空时不做限制
+func (v *SQLSecurityValidator) RestrictTables(tables []string) {
+	if len(tables) == 0 {
+		return
+	}
+
+	restricted := make(map[string]bool, len(tables))
+	for _, name := range tables {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if v.allowedTables[name] {
+			restricted[name] = true
+		}
+	}
+	v.allowedTables = restricted
+}
+
 // ValidateAndSecure 验证并加固 SQL 查询
-func (v *SQLSecurityValidator) ValidateAndSecure(sqlQuery string) (string, error) {
+// 返回加固后的 SQL 及其绑定参数（租户 ID 以 $1 传入，不拼接进 SQL）
+func (v *SQLSecurityValidator) ValidateAndSecure(sqlQuery string) (string, []interface{}, error) {
 	// 阶段 1: 基本输入验证
 	if err := v.validateInput(sqlQuery); err != nil {
-		return "", err
+		return "", nil, err
 	}
 
 	// 阶段 2: 使用 PostgreSQL 官方解析器解析 SQL
 	result, err := pg_query.Parse(sqlQuery)
 	if err != nil {
-		return "", fmt.Errorf("SQL 解析错误: %v", err)
+		return "", nil, fmt.Errorf("SQL 解析错误: %v", err)
 	}
 
-	// 阶段 3: 确保只有一个语句
+	// 阶段 3: 不允许自带参数占位符，$1 保留给注入的租户 ID
+	if err := rejectParams(sqlQuery); err != nil {
+		return "", nil, err
+	}
+
+	// 阶段 4: 确保只有一个语句
 	if len(result.Stmts) == 0 {
-		return "", fmt.Errorf("空查询")
+		return "", nil, fmt.Errorf("空查询")
 	}
 	if len(result.Stmts) > 1 {
-		return "", fmt.Errorf("不允许执行多条语句")
+		return "", nil, fmt.Errorf("不允许执行多条语句")
 	}
 
 	stmt := result.Stmts[0].Stmt
 
-	// 阶段 4: 确保是 SELECT 语句
+	// 阶段 5: 确保是 SELECT 语句
 	selectStmt := stmt.GetSelectStmt()
 	if selectStmt == nil {
-		return "", fmt.Errorf("只允许 SELECT 查询")
+		return "", nil, fmt.Errorf("只允许 SELECT 查询")
 	}
 
-	// 阶段 5: 递归验证 SELECT 语句
-	tablesInQuery, err := v.validateSelectStmt(selectStmt)
-	if err != nil {
-		return "", err
+	// 阶段 6: 递归验证 SELECT 语句
+	if _, err := v.validateSelectStmt(selectStmt); err != nil {
+		return "", nil, err
 	}
 
-	// 阶段 6: 标准化 SQL
-	normalizedSQL, err := pg_query.Deparse(result)
-	if err != nil {
-		return "", fmt.Errorf("SQL 标准化失败: %v", err)
+	// 阶段 7: 在 AST 中注入租户过滤条件 (如果设置了 TenantID)
+	var args []interface{}
+	if v.TenantID != "" {
+		if err := injectTenantConditions(selectStmt); err != nil {
+			return "", nil, err
+		}
+		args = append(args, v.TenantID)
 	}
 
-	// 阶段 7: 注入租户过滤条件 (如果设置了 TenantID)
-	securedSQL := v.injectTenantConditions(normalizedSQL, tablesInQuery)
+	// 阶段 8: 限制返回行数
+	limitRows(selectStmt, maxQueryRows+1)
+
+	// 阶段 9: 生成 SQL
+	securedSQL, err := pg_query.Deparse(result)
+	if err != nil {
+		return "", nil, fmt.Errorf("SQL 标准化失败: %v", err)
+	}
 
-	return securedSQL, nil
+	return securedSQL, args, nil
 }
 
 // validateInput 基本输入验证
@@ -137,6 +177,20 @@ func (v *SQLSecurityValidator) validateInput(sql string) error {
 	return nil
 }
 
+// rejectParams 拒绝包含 $n 参数占位符的查询
+func rejectParams(sql string) error {
+	scanned, err := pg_query.Scan(sql)
+	if err != nil {
+		return fmt.Errorf("SQL 解析错误: %v", err)
+	}
+	for _, token := range scanned.Tokens {
+		if token.Token == pg_query.Token_PARAM {
+			return fmt.Errorf("不允许使用参数占位符: %s", sql[token.Start:token.End])
+		}
+	}
+	return nil
+}
+
 // validateSelectStmt 验证 SELECT 语句并提取表信息
 func (v *SQLSecurityValidator) validateSelectStmt(stmt *pg_query.SelectStmt) (map[string]string, error) {
 	tablesInQuery := make(map[string]string)
@@ -161,6 +215,14 @@ func (v *SQLSecurityValidator) validateSelectStmt(stmt *pg_query.SelectStmt) (ma
 		return nil, fmt.Errorf("不允许使用锁定子句 (FOR UPDATE 等)")
 	}
 
+	// 检查 VALUES 和 WINDOW 子句
+	if len(stmt.ValuesLists) > 0 {
+		return nil, fmt.Errorf("不允许使用 VALUES")
+	}
+	if len(stmt.WindowClause) > 0 {
+		return nil, fmt.Errorf("不允许使用 WINDOW 子句，请在 OVER 中直接定义窗口")
+	}
+
 	// 验证 FROM 子句
 	for _, fromItem := range stmt.FromClause {
 		if err := v.validateFromItem(fromItem, tablesInQuery); err != nil {
@@ -168,9 +230,14 @@ func (v *SQLSecurityValidator) validateSelectStmt(stmt *pg_query.SelectStmt) (ma
 		}
 	}
 
-	// 验证 WHERE 子句
-	if stmt.WhereClause != nil {
-		if err := v.validateNode(stmt.WhereClause); err != nil {
+	// 验证 SELECT 列表、DISTINCT ON、WHERE、GROUP BY、HAVING、ORDER BY 和 LIMIT/OFFSET 子句
+	clauses := []*pg_query.Node{stmt.WhereClause, stmt.HavingClause, stmt.LimitCount, stmt.LimitOffset}
+	clauses = append(clauses, stmt.TargetList...)
+	clauses = append(clauses, stmt.DistinctClause...)
+	clauses = append(clauses, stmt.GroupClause...)
+	clauses = append(clauses, stmt.SortClause...)
+	for _, node := range clauses {
+		if err := v.validateNode(node); err != nil {
 			return nil, err
 		}
 	}
@@ -217,6 +284,10 @@ func (v *SQLSecurityValidator) validateFromItem(node *pg_query.Node, tables map[
 
 	// 处理 JoinExpr (JOIN)
 	if je := node.GetJoinExpr(); je != nil {
+		// FULL JOIN 两侧都会保留不满足 ON 的行，无法通过条件限定租户
+		if je.Jointype == pg_query.JoinType_JOIN_FULL {
+			return fmt.Errorf("不允许使用 FULL JOIN")
+		}
 		if err := v.validateFromItem(je.Larg, tables); err != nil {
 			return err
 		}
@@ -236,44 +307,96 @@ func (v *SQLSecurityValidator) validateFromItem(node *pg_query.Node, tables map[
 		return fmt.Errorf("不允许在 FROM 子句中使用子查询")
 	}
 
-	return nil
+	// 表函数、TABLESAMPLE 等其他 FROM 项均不允许
+	return fmt.Errorf("FROM 子句中不支持的表引用: %s", nodeName(node))
 }
 
 // validateNode 递归验证 AST 节点
+// 只接受下列已知的表达式节点并检查其全部子表达式，其他节点（包括子查询）一律拒绝
 func (v *SQLSecurityValidator) validateNode(node *pg_query.Node) error {
 	if node == nil {
 		return nil
 	}
 
-	// 检查子查询
-	if node.GetSubLink() != nil {
+	switch n := node.Node.(type) {
+	case *pg_query.Node_ColumnRef, *pg_query.Node_AConst, *pg_query.Node_AStar,
+		*pg_query.Node_String_, *pg_query.Node_SqlvalueFunction:
+		return nil
+	case *pg_query.Node_SubLink:
 		return fmt.Errorf("不允许使用子查询")
-	}
-
-	// 检查函数调用
-	if fc := node.GetFuncCall(); fc != nil {
-		return v.validateFuncCall(fc)
-	}
-
-	// 递归检查表达式
-	if ae := node.GetAExpr(); ae != nil {
-		if err := v.validateNode(ae.Lexpr); err != nil {
+	case *pg_query.Node_FuncCall:
+		return v.validateFuncCall(n.FuncCall)
+	case *pg_query.Node_AExpr:
+		if err := v.validateNode(n.AExpr.Lexpr); err != nil {
+			return err
+		}
+		return v.validateNode(n.AExpr.Rexpr)
+	case *pg_query.Node_BoolExpr:
+		return v.validateNodes(n.BoolExpr.Args)
+	case *pg_query.Node_ResTarget:
+		return v.validateNode(n.ResTarget.Val)
+	case *pg_query.Node_SortBy:
+		return v.validateNode(n.SortBy.Node)
+	case *pg_query.Node_TypeCast:
+		return v.validateNode(n.TypeCast.Arg)
+	case *pg_query.Node_CollateClause:
+		return v.validateNode(n.CollateClause.Arg)
+	case *pg_query.Node_NamedArgExpr:
+		return v.validateNode(n.NamedArgExpr.Arg)
+	case *pg_query.Node_NullTest:
+		return v.validateNode(n.NullTest.Arg)
+	case *pg_query.Node_BooleanTest:
+		return v.validateNode(n.BooleanTest.Arg)
+	case *pg_query.Node_CoalesceExpr:
+		return v.validateNodes(n.CoalesceExpr.Args)
+	case *pg_query.Node_MinMaxExpr:
+		return v.validateNodes(n.MinMaxExpr.Args)
+	case *pg_query.Node_AArrayExpr:
+		return v.validateNodes(n.AArrayExpr.Elements)
+	case *pg_query.Node_RowExpr:
+		return v.validateNodes(n.RowExpr.Args)
+	case *pg_query.Node_List:
+		return v.validateNodes(n.List.Items)
+	case *pg_query.Node_AIndirection:
+		if err := v.validateNode(n.AIndirection.Arg); err != nil {
 			return err
 		}
-		if err := v.validateNode(ae.Rexpr); err != nil {
+		return v.validateNodes(n.AIndirection.Indirection)
+	case *pg_query.Node_AIndices:
+		if err := v.validateNode(n.AIndices.Lidx); err != nil {
 			return err
 		}
+		return v.validateNode(n.AIndices.Uidx)
+	case *pg_query.Node_CaseExpr:
+		if err := v.validateNode(n.CaseExpr.Arg); err != nil {
+			return err
+		}
+		if err := v.validateNode(n.CaseExpr.Defresult); err != nil {
+			return err
+		}
+		return v.validateNodes(n.CaseExpr.Args)
+	case *pg_query.Node_CaseWhen:
+		if err := v.validateNode(n.CaseWhen.Expr); err != nil {
+			return err
+		}
+		return v.validateNode(n.CaseWhen.Result)
 	}
 
-	// 检查布尔表达式
-	if be := node.GetBoolExpr(); be != nil {
-		for _, arg := range be.Args {
-			if err := v.validateNode(arg); err != nil {
-				return err
-			}
+	return fmt.Errorf("不支持的 SQL 表达式: %s", nodeName(node))
+}
+
+// nodeName 返回 AST 节点类型名，用于错误信息
+func nodeName(node *pg_query.Node) string {
+	return strings.TrimPrefix(fmt.Sprintf("%T", node.Node), "*pg_query.Node_")
+}
+
+// validateNodes 依次验证多个 AST 节点
+func (v *SQLSecurityValidator) validateNodes(nodes []*pg_query.Node) error {
+	for _, node := range nodes {
+		if err := v.validateNode(node); err != nil {
+			return err
 		}
 	}
-
 	return nil
 }
 
@@ -311,88 +434,201 @@ func (v *SQLSecurityValidator) validateFuncCall(fc *pg_query.FuncCall) error {
 		return fmt.Errorf("函数不允许: %s", funcName)
 	}
 
-	// 递归验证参数
-	for _, arg := range fc.Args {
-		if err := v.validateNode(arg); err != nil {
+	// 递归验证参数、聚合排序、FILTER 和窗口定义
+	if err := v.validateNodes(fc.Args); err != nil {
+		return err
+	}
+	if err := v.validateNodes(fc.AggOrder); err != nil {
+		return err
+	}
+	if err := v.validateNode(fc.AggFilter); err != nil {
+		return err
+	}
+	if w := fc.Over; w != nil {
+		if w.Refname != "" || w.Name != "" {
+			return fmt.Errorf("不允许引用命名窗口，请在 OVER 中直接定义窗口")
+		}
+		if err := v.validateNodes(w.PartitionClause); err != nil {
+			return err
+		}
+		if err := v.validateNodes(w.OrderClause); err != nil {
+			return err
+		}
+		if err := v.validateNode(w.StartOffset); err != nil {
 			return err
 		}
+		return v.validateNode(w.EndOffset)
 	}
 
 	return nil
 }
 
-// injectTenantConditions 注入租户过滤条件
-func (v *SQLSecurityValidator) injectTenantConditions(sql string, tablesInQuery map[string]string) string {
-	if v.TenantID == "" {
-		return sql
+// tablesWithTenantID 需要 tenant_id 过滤的表，由模型定义中实际带有 tenant_id 列的表构成
+var tablesWithTenantID = tenantTables(model.AllModels...)
+
+// tenantTables 解析模型定义，返回带有 tenant_id 列的表名
+func tenantTables(models ...interface{}) map[string]bool {
+	cache := &sync.Map{}
+	tables := make(map[string]bool)
+	for _, m := range models {
+		s, err := gormschema.Parse(m, cache, gormschema.NamingStrategy{})
+		if err != nil {
+			panic(fmt.Sprintf("failed to parse model %T: %v", m, err))
+		}
+		if _, ok := s.FieldsByDBName["tenant_id"]; ok {
+			tables[s.Table] = true
+		}
 	}
+	return tables
+}
 
-	// 需要 tenant_id 过滤的表
-	tablesWithTenantID := map[string]bool{
-		"users":           true,
-		"knowledge_bases": true,
-		"knowledges":      true,
-		"chunks":          true,
-		"chat_sessions":   true,
-		"chat_messages":   true,
-		"agents":          true,
-		"tools":           true,
-		"faqs":            true,
-		"faq_entries":     true,
-		"models":          true,
+// injectTenantConditions 在 AST 中为每个表引用注入 <alias>.tenant_id = $1
+// 内连接和外连接保留侧的条件加入 WHERE；外连接可空侧的条件加入对应的 ON，
+// 避免把 LEFT/RIGHT JOIN 变成内连接（FULL JOIN 没有保留侧，在验证阶段拒绝）
+func injectTenantConditions(stmt *pg_query.SelectStmt) error {
+	var conditions []*pg_query.Node
+	for _, fromItem := range stmt.FromClause {
+		conds, err := tenantConditions(fromItem)
+		if err != nil {
+			return err
+		}
+		conditions = append(conditions, conds...)
 	}
 
-	var conditions []string
-	for tableName, alias := range tablesInQuery {
-		if tablesWithTenantID[tableName] {
-			conditions = append(conditions, fmt.Sprintf("%s.tenant_id = '%s'", alias, v.TenantID))
+	stmt.WhereClause = andNodes(stmt.WhereClause, conditions...)
+	return nil
+}
+
+// tenantConditions 返回 FROM 子句项中需要由上层应用的租户条件
+func tenantConditions(node *pg_query.Node) ([]*pg_query.Node, error) {
+	if rv := node.GetRangeVar(); rv != nil {
+		tableName := strings.ToLower(rv.Relname)
+		if !tablesWithTenantID[tableName] {
+			return nil, nil
 		}
+		alias := rv.Relname
+		if rv.Alias != nil && rv.Alias.Aliasname != "" {
+			alias = rv.Alias.Aliasname
+		}
+		return []*pg_query.Node{tenantCondition(alias)}, nil
 	}
 
-	if len(conditions) == 0 {
-		return sql
+	je := node.GetJoinExpr()
+	if je == nil {
+		return nil, nil
+	}
+
+	left, err := tenantConditions(je.Larg)
+	if err != nil {
+		return nil, err
+	}
+	right, err := tenantConditions(je.Rarg)
+	if err != nil {
+		return nil, err
 	}
 
-	tenantFilter := strings.Join(conditions, " AND ")
+	// 外连接可空侧的条件需要写入 ON 子句
+	var onConditions, upper []*pg_query.Node
+	switch je.Jointype {
+	case pg_query.JoinType_JOIN_LEFT:
+		onConditions, upper = right, left
+	case pg_query.JoinType_JOIN_RIGHT:
+		onConditions, upper = left, right
+	case pg_query.JoinType_JOIN_FULL:
+		return nil, fmt.Errorf("不允许使用 FULL JOIN")
+	default:
+		upper = append(left, right...)
+	}
 
-	// 检查 WHERE 是否存在
-	wherePattern := regexp.MustCompile(`(?i)\bWHERE\b`)
-	if wherePattern.MatchString(sql) {
-		return wherePattern.ReplaceAllString(sql, fmt.Sprintf("WHERE %s AND ", tenantFilter))
+	if len(onConditions) > 0 {
+		if je.IsNatural || len(je.UsingClause) > 0 {
+			return nil, fmt.Errorf("外连接不支持 NATURAL 或 USING，请使用 ON 子句")
+		}
+		je.Quals = andNodes(je.Quals, onConditions...)
+	}
+	return upper, nil
+}
+
+// tenantCondition 构造 <alias>.tenant_id = $1
+func tenantCondition(alias string) *pg_query.Node {
+	column := &pg_query.Node{Node: &pg_query.Node_ColumnRef{ColumnRef: &pg_query.ColumnRef{
+		Fields: []*pg_query.Node{stringNode(alias), stringNode("tenant_id")},
+	}}}
+	param := &pg_query.Node{Node: &pg_query.Node_ParamRef{ParamRef: &pg_query.ParamRef{Number: 1}}}
+
+	return &pg_query.Node{Node: &pg_query.Node_AExpr{AExpr: &pg_query.A_Expr{
+		Kind:  pg_query.A_Expr_Kind_AEXPR_OP,
+		Name:  []*pg_query.Node{stringNode("=")},
+		Lexpr: column,
+		Rexpr: param,
+	}}}
+}
+
+// andNodes 用 AND 连接已有条件和新增条件
+func andNodes(existing *pg_query.Node, conditions ...*pg_query.Node) *pg_query.Node {
+	if len(conditions) == 0 {
+		return existing
+	}
+
+	args := make([]*pg_query.Node, 0, len(conditions)+1)
+	args = append(args, conditions...)
+	if existing != nil {
+		args = append(args, existing)
+	}
+	if len(args) == 1 {
+		return args[0]
 	}
 
-	// 在 ORDER BY, GROUP BY, LIMIT 等子句前添加
-	clausePattern := regexp.MustCompile(`(?i)\b(GROUP BY|ORDER BY|LIMIT|OFFSET|HAVING|FETCH)\b`)
-	if loc := clausePattern.FindStringIndex(sql); loc != nil {
-		return sql[:loc[0]] + fmt.Sprintf(" WHERE %s ", tenantFilter) + sql[loc[0]:]
+	return &pg_query.Node{Node: &pg_query.Node_BoolExpr{BoolExpr: &pg_query.BoolExpr{
+		Boolop: pg_query.BoolExprType_AND_EXPR,
+		Args:   args,
+	}}}
+}
+
+// limitRows 除不超过 n 的整数常量外，将 LIMIT 设置为 n（包括未指定、LIMIT ALL 和表达式）
+func limitRows(stmt *pg_query.SelectStmt, n int32) {
+	if c := stmt.LimitCount.GetAConst(); c != nil && c.GetIval() != nil && c.GetIval().Ival <= n &&
+		stmt.LimitOption == pg_query.LimitOption_LIMIT_OPTION_COUNT {
+		return
 	}
 
-	return fmt.Sprintf("%s WHERE %s", sql, tenantFilter)
+	stmt.LimitCount = &pg_query.Node{Node: &pg_query.Node_AConst{AConst: &pg_query.A_Const{
+		Val: &pg_query.A_Const_Ival{Ival: &pg_query.Integer{Ival: n}},
+	}}}
+	stmt.LimitOption = pg_query.LimitOption_LIMIT_OPTION_COUNT
+}
+
+// stringNode 构造字符串节点
+func stringNode(s string) *pg_query.Node {
+	return &pg_query.Node{Node: &pg_query.Node_String_{String_: &pg_query.String{Sval: s}}}
 }
 
 // QueryTool 数据库查询工具
+// 每次运行按调用方租户创建，查询自动限定在该租户的数据范围内
 type QueryTool struct {
-	db       *gorm.DB
-	tenantID string
+	db            *gorm.DB
+	tenantID      string
+	allowedTables []string // 租户配置的表白名单，为空时使用默认白名单
 }
 
 // NewQueryTool 创建数据库查询工具
-func NewQueryTool(db *gorm.DB, tenantID string) *QueryTool {
+func NewQueryTool(db *gorm.DB, tenantID string, allowedTables []string) *QueryTool {
 	return &QueryTool{
-		db:       db,
-		tenantID: tenantID,
+		db:            db,
+		tenantID:      tenantID,
+		allowedTables: allowedTables,
 	}
 }
 
-// ToolInfo 返回工具信息
-func (t *QueryTool) ToolInfo(ctx context.Context) (*schema.ToolInfo, error) {
+// Info 返回工具信息
+func (t *QueryTool) Info(ctx context.Context) (*schema.ToolInfo, error) {
 	return &schema.ToolInfo{
 		Name: ToolDatabaseQuery,
 		Desc: `执行 SQL 查询以从数据库中获取信息。
 
 ## 安全特性
 - 只读查询: 只允许 SELECT 语句
-- 表白名单: 只允许查询授权的表
+- 表白名单: 只允许查询授权的、带租户隔离的表
 - 自动租户过滤: 自动添加 tenant_id 过滤条件
 
 ## 可用表
@@ -434,19 +670,13 @@ func (t *QueryTool) ToolInfo(ctx context.Context) (*schema.ToolInfo, error) {
 - agent_id: 关联的 Agent ID
 - created_at, updated_at: 时间戳
 
-### 聊天消息表 (chat_messages)
-- id: 消息 ID
-- session_id: 会话 ID
-- role: 角色 (user/assistant/system)
-- content: 内容
-- created_at: 时间戳
-
-### Agent 表 (agents)
-- id: Agent ID
-- name: 名称
-- description: 描述
-- system_prompt: 系统提示词
-- is_active: 是否激活
+### FAQ 表 (faqs)
+- id: FAQ ID
+- question: 标准问题
+- answer: 答案
+- category: 分类
+- is_active: 是否启用
+- hit_count: 命中次数
 - created_at, updated_at: 时间戳
 
 ## 使用示例
@@ -462,8 +692,9 @@ func (t *QueryTool) ToolInfo(ctx context.Context) (*schema.ToolInfo, error) {
 
 ## 注意事项
 - 只允许 SELECT 查询
-- 建议使用 LIMIT 子句限制结果数量
-- 支持多表 JOIN`,
+- 建议使用 LIMIT 子句限制结果数量，单次最多返回 100 行
+- 查询超过 10 秒会被取消
+- 支持多表 JOIN（不支持 FULL JOIN），不支持子查询`,
 		ParamsOneOf: schema.NewParamsOneOfByParams(
 			map[string]*schema.ParameterInfo{
 				"sql": {
@@ -489,54 +720,78 @@ func (t *QueryTool) InvokableRun(ctx context.Context, argumentsInJSON string, op
 
 	// 验证并加固 SQL
 	validator := NewSQLSecurityValidator(t.tenantID)
-	securedSQL, err := validator.ValidateAndSecure(input.SQL)
+	validator.RestrictTables(t.allowedTables)
+	securedSQL, args, err := validator.ValidateAndSecure(input.SQL)
 	if err != nil {
 		return "", fmt.Errorf("SQL 验证失败: %v", err)
 	}
 
-	// 执行查询
-	rows, err := t.db.WithContext(ctx).Raw(securedSQL).Rows()
-	if err != nil {
-		return "", fmt.Errorf("查询执行失败: %v", err)
-	}
-	defer rows.Close()
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
 
-	// 获取列名
-	columns, err := rows.Columns()
-	if err != nil {
-		return "", fmt.Errorf("获取列名失败: %v", err)
-	}
-
-	// 处理结果
+	// 在只读事务中执行，语句超时仅对本事务生效
+	var columns []string
 	results := make([]map[string]interface{}, 0)
-	for rows.Next() {
-		columnValues := make([]interface{}, len(columns))
-		columnPointers := make([]interface{}, len(columns))
-		for i := range columnValues {
-			columnPointers[i] = &columnValues[i]
+	err = t.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SET TRANSACTION READ ONLY").Error; err != nil {
+			return err
+		}
+		if err := tx.Exec(fmt.Sprintf("SET LOCAL statement_timeout = %d", queryTimeout.Milliseconds())).Error; err != nil {
+			return err
 		}
 
-		if err := rows.Scan(columnPointers...); err != nil {
-			return "", fmt.Errorf("读取行数据失败: %v", err)
+		// 直接使用底层连接执行，$1 参数不经过 GORM 的占位符替换
+		rows, err := tx.Statement.ConnPool.QueryContext(ctx, securedSQL, args...)
+		if err != nil {
+			return err
 		}
+		defer rows.Close()
 
-		rowMap := make(map[string]interface{})
-		for i, colName := range columns {
-			val := columnValues[i]
-			if b, ok := val.([]byte); ok {
-				rowMap[colName] = string(b)
-			} else {
-				rowMap[colName] = val
+		// 获取列名
+		columns, err = rows.Columns()
+		if err != nil {
+			return fmt.Errorf("获取列名失败: %v", err)
+		}
+
+		// 处理结果，多读一行用于判断是否截断
+		for len(results) <= maxQueryRows && rows.Next() {
+			columnValues := make([]interface{}, len(columns))
+			columnPointers := make([]interface{}, len(columns))
+			for i := range columnValues {
+				columnPointers[i] = &columnValues[i]
+			}
+
+			if err := rows.Scan(columnPointers...); err != nil {
+				return fmt.Errorf("读取行数据失败: %v", err)
 			}
+
+			rowMap := make(map[string]interface{})
+			for i, colName := range columns {
+				val := columnValues[i]
+				if b, ok := val.([]byte); ok {
+					rowMap[colName] = string(b)
+				} else {
+					rowMap[colName] = val
+				}
+			}
+			results = append(results, rowMap)
 		}
-		results = append(results, rowMap)
+		return rows.Err()
+	})
+	if err != nil {
+		return "", fmt.Errorf("查询执行失败: %v", err)
+	}
+
+	truncated := len(results) > maxQueryRows
+	if truncated {
+		results = results[:maxQueryRows]
 	}
 
-	return t.formatQueryResults(columns, results, securedSQL), nil
+	return t.formatQueryResults(columns, results, securedSQL, truncated), nil
 }
 
 // formatQueryResults 格式化查询结果
-func (t *QueryTool) formatQueryResults(columns []string, results []map[string]interface{}, query string) string {
+func (t *QueryTool) formatQueryResults(columns []string, results []map[string]interface{}, query string, truncated bool) string {
 	output := "=== 查询结果 ===\n\n"
 	output += fmt.Sprintf("执行的 SQL: %s\n\n", query)
 	output += fmt.Sprintf("返回 %d 行数据\n\n", len(results))
@@ -573,7 +828,9 @@ func (t *QueryTool) formatQueryResults(columns []string, results []map[string]in
 		output += "\n"
 	}
 
-	if len(results) > 10 {
+	if truncated {
+		output += fmt.Sprintf("注意: 结果已截断，仅显示前 %d 条记录。请使用 WHERE 或 LIMIT 缩小查询范围。\n", maxQueryRows)
+	} else if len(results) > 10 {
 		output += fmt.Sprintf("注意: 显示了全部 %d 条记录。建议使用 LIMIT 子句限制结果数量。\n", len(results))
 	}
 
@@ -0,0 +1,147 @@
+package database
+
+import (
+	"strings"
+	"testing"
+)
+
+const testTenantID = "tenant-1"
+
+func secure(t *testing.T, tenantID, sql string) (string, []interface{}) {
+	t.Helper()
+	secured, args, err := NewSQLSecurityValidator(tenantID).ValidateAndSecure(sql)
+	if err != nil {
+		t.Fatalf("ValidateAndSecure(%q): %v", sql, err)
+	}
+	return secured, args
+}
+
+func TestTenantConditions(t *testing.T) {
+	cases := []struct {
+		name string
+		sql  string
+		want string
+	}{
+		{
+			name: "plain table",
+			sql:  "SELECT id FROM faqs",
+			want: "SELECT id FROM faqs WHERE faqs.tenant_id = $1 LIMIT 101",
+		},
+		{
+			name: "aliased table with where",
+			sql:  "SELECT f.id FROM faqs f WHERE f.is_active",
+			want: "SELECT f.id FROM faqs f WHERE f.tenant_id = $1 AND f.is_active LIMIT 101",
+		},
+		{
+			name: "inner join",
+			sql:  "SELECT k.id FROM knowledges k JOIN chunks c ON k.id = c.knowledge_id",
+			want: "SELECT k.id FROM knowledges k JOIN chunks c ON k.id = c.knowledge_id WHERE k.tenant_id = $1 AND c.tenant_id = $1 LIMIT 101",
+		},
+		{
+			name: "left join",
+			sql:  "SELECT k.id FROM knowledges k LEFT JOIN chunks c ON k.id = c.knowledge_id",
+			want: "SELECT k.id FROM knowledges k LEFT JOIN chunks c ON c.tenant_id = $1 AND k.id = c.knowledge_id WHERE k.tenant_id = $1 LIMIT 101",
+		},
+		{
+			name: "right join",
+			sql:  "SELECT k.id FROM knowledges k RIGHT JOIN chunks c ON k.id = c.knowledge_id",
+			want: "SELECT k.id FROM knowledges k RIGHT JOIN chunks c ON k.tenant_id = $1 AND k.id = c.knowledge_id WHERE c.tenant_id = $1 LIMIT 101",
+		},
+		{
+			name: "comma join",
+			sql:  "SELECT kb.id FROM knowledge_bases kb, knowledges k WHERE k.knowledge_base_id = kb.id",
+			want: "SELECT kb.id FROM knowledge_bases kb, knowledges k WHERE kb.tenant_id = $1 AND k.tenant_id = $1 AND k.knowledge_base_id = kb.id LIMIT 101",
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, args := secure(t, testTenantID, tc.sql)
+			if got != tc.want {
+				t.Errorf("secured SQL:\n got  %s\n want %s", got, tc.want)
+			}
+			if len(args) != 1 || args[0] != testTenantID {
+				t.Errorf("args = %v, want [%s]", args, testTenantID)
+			}
+		})
+	}
+}
+
+func TestTenantIDIsBoundNotInlined(t *testing.T) {
+	tenantID := `t' OR '1'='1`
+	got, args := secure(t, tenantID, "SELECT id FROM faqs")
+	if strings.Contains(got, "OR") || strings.Contains(got, "'") {
+		t.Errorf("tenant ID leaked into SQL: %s", got)
+	}
+	if len(args) != 1 || args[0] != tenantID {
+		t.Errorf("args = %v, want [%s]", args, tenantID)
+	}
+}
+
+func TestLimitIsCapped(t *testing.T) {
+	cases := []struct {
+		sql  string
+		want string
+	}{
+		{"SELECT id FROM faqs LIMIT 5", "LIMIT 5"},
+		{"SELECT id FROM faqs LIMIT 1000", "LIMIT 101"},
+		{"SELECT id FROM faqs LIMIT ALL", "LIMIT 101"},
+		{"SELECT id FROM faqs LIMIT 10 + 1000", "LIMIT 101"},
+	}
+	for _, tc := range cases {
+		got, _ := secure(t, testTenantID, tc.sql)
+		if !strings.HasSuffix(got, tc.want) {
+			t.Errorf("%q secured to %q, want suffix %q", tc.sql, got, tc.want)
+		}
+	}
+}
+
+func TestRejectedQueries(t *testing.T) {
+	cases := []struct {
+		name string
+		sql  string
+	}{
+		{"user param", "SELECT id FROM faqs WHERE tenant_id = $1"},
+		{"user param in limit", "SELECT id FROM faqs LIMIT $2"},
+		{"full join", "SELECT k.id FROM knowledges k FULL JOIN chunks c ON k.id = c.knowledge_id"},
+		{"table not allowed", "SELECT api_key FROM models"},
+		{"write", "DELETE FROM faqs"},
+		{"multiple statements", "SELECT id FROM faqs; SELECT id FROM users"},
+		{"union", "SELECT id FROM faqs UNION SELECT id FROM users"},
+		{"cte", "WITH m AS (SELECT 1) SELECT id FROM faqs"},
+		{"subquery in where", "SELECT id FROM faqs WHERE id IN (SELECT id FROM users)"},
+		{"subquery in from", "SELECT id FROM (SELECT id FROM faqs) f"},
+		{"table function", "SELECT id FROM faqs, pg_ls_dir('.') d"},
+		{"subquery in array", "SELECT ARRAY[(SELECT api_key FROM models LIMIT 1)] FROM faqs"},
+		{"subquery in row", "SELECT ROW((SELECT content FROM chat_messages LIMIT 1)) FROM faqs"},
+		{"subquery in window", "SELECT count(*) OVER (ORDER BY (SELECT 1 FROM tenants)) FROM faqs"},
+		{"subquery in aggregate order", "SELECT string_agg(question, ',' ORDER BY (SELECT 1 FROM tenants)) FROM faqs"},
+		{"subquery in indirection", "SELECT (ARRAY[1])[(SELECT 1 FROM tenants)] FROM faqs"},
+		{"subquery in collate", `SELECT (SELECT name FROM tenants LIMIT 1) COLLATE "C" FROM faqs`},
+		{"subquery in named arg", "SELECT concat(a => (SELECT 1 FROM tenants)) FROM faqs"},
+		{"subquery in distinct on", "SELECT DISTINCT ON ((SELECT 1 FROM tenants)) id FROM faqs"},
+		{"subquery in limit", "SELECT id FROM faqs LIMIT (SELECT 1 FROM tenants)"},
+		{"named window", "SELECT count(*) OVER w FROM faqs WINDOW w AS (ORDER BY id)"},
+		{"function not allowed", "SELECT pg_read_file('/etc/passwd') FROM faqs"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got, _, err := NewSQLSecurityValidator(testTenantID).ValidateAndSecure(tc.sql); err == nil {
+				t.Errorf("ValidateAndSecure(%q) = %q, want error", tc.sql, got)
+			}
+		})
+	}
+}
+
+func TestRestrictTables(t *testing.T) {
+	v := NewSQLSecurityValidator(testTenantID)
+	v.RestrictTables([]string{"FAQs", "models"})
+
+	if _, _, err := v.ValidateAndSecure("SELECT id FROM faqs"); err != nil {
+		t.Errorf("faqs rejected after restriction: %v", err)
+	}
+	for _, sql := range []string{"SELECT id FROM users", "SELECT id FROM models"} {
+		if _, _, err := v.ValidateAndSecure(sql); err == nil {
+			t.Errorf("%q accepted after restriction", sql)
+		}
+	}
+}
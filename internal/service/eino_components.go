@@ -2,93 +2,34 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
+	"time"
 
 	"github.com/ashwinyue/next-ai/internal/config"
 	"github.com/ashwinyue/next-ai/internal/repository"
 	"github.com/ashwinyue/next-ai/internal/service/file"
-	"github.com/cloudwego/eino-ext/components/model/openai"
+	svcModel "github.com/ashwinyue/next-ai/internal/service/model"
+	"github.com/cloudwego/eino-ext/components/embedding/dashscope"
+	openaiembed "github.com/cloudwego/eino-ext/components/embedding/openai"
+	"github.com/cloudwego/eino/components/embedding"
 	ecomodel "github.com/cloudwego/eino/components/model"
+	"github.com/elastic/go-elasticsearch/v8"
 )
 
 // newChatModel 创建 ChatModel
-func newChatModel(ctx context.Context, cfg *config.Config) (ecomodel.ChatModel, error) {
-	aiCfg := cfg.AI
-
-	var apiKey, baseURL, modelName string
-
-	switch aiCfg.Provider {
-	case "openai":
-		apiKey = aiCfg.OpenAI.APIKey
-		baseURL = aiCfg.OpenAI.BaseURL
-		modelName = aiCfg.OpenAI.Model
-	case "alibaba", "qwen", "dashscope":
-		apiKey = aiCfg.Alibaba.AccessKeySecret
-		baseURL = "https://dashscope.aliyuncs.com/compatible-mode/v1"
-		modelName = aiCfg.Alibaba.Model
-	case "deepseek":
-		apiKey = aiCfg.DeepSeek.APIKey
-		baseURL = aiCfg.DeepSeek.BaseURL
-		modelName = aiCfg.DeepSeek.Model
-	default:
-		return nil, fmt.Errorf("unsupported ai provider: %s", aiCfg.Provider)
-	}
-
-	if apiKey == "" {
-		return nil, fmt.Errorf("api_key is required for provider: %s", aiCfg.Provider)
+// 优先使用 models 表中的默认对话模型，未配置时回退到全局 AI 配置
+func newChatModel(ctx context.Context, cfg *config.Config, modelSvc *svcModel.Service) (ecomodel.BaseChatModel, error) {
+	chatCfg, err := modelSvc.ChatModelConfigFor(ctx, "")
+	if errors.Is(err, svcModel.ErrNoDefaultChatModel) {
+		chatCfg, err = svcModel.ChatModelConfigFromAIConfig(cfg.AI)
 	}
-
-	if modelName == "" {
-		modelName = "gpt-4o-mini"
+	if err != nil {
+		return nil, err
 	}
 
-	return openai.NewChatModel(ctx, &openai.ChatModelConfig{
-		APIKey:  apiKey,
-		BaseURL: baseURL,
-		Model:   modelName,
-	})
-}
-
-// newToolCallingChatModel 创建支持工具调用的 ChatModel
-func newToolCallingChatModel(ctx context.Context, cfg *config.Config) (ecomodel.ToolCallingChatModel, error) {
-	aiCfg := cfg.AI
-
-	var apiKey, baseURL, modelName string
-
-	switch aiCfg.Provider {
-	case "openai":
-		apiKey = aiCfg.OpenAI.APIKey
-		baseURL = aiCfg.OpenAI.BaseURL
-		modelName = aiCfg.OpenAI.Model
-	case "alibaba", "qwen", "dashscope":
-		apiKey = aiCfg.Alibaba.AccessKeySecret
-		baseURL = "https://dashscope.aliyuncs.com/compatible-mode/v1"
-		modelName = aiCfg.Alibaba.Model
-	case "deepseek":
-		apiKey = aiCfg.DeepSeek.APIKey
-		baseURL = aiCfg.DeepSeek.BaseURL
-		modelName = aiCfg.DeepSeek.Model
-	default:
-		return nil, fmt.Errorf("unsupported ai provider: %s", aiCfg.Provider)
-	}
-
-	if apiKey == "" {
-		return nil, fmt.Errorf("api_key is required for provider: %s", aiCfg.Provider)
-	}
-
-	if modelName == "" {
-		modelName = "gpt-4o-mini"
-	}
-
-	temperature := float32(0.7)
-
-	return openai.NewChatModel(ctx, &openai.ChatModelConfig{
-		APIKey:      apiKey,
-		BaseURL:     baseURL,
-		Model:       modelName,
-		Temperature: &temperature,
-	})
+	return svcModel.NewChatModel(ctx, chatCfg)
 }
 
 // newFileService 创建文件存储服务
@@ -136,3 +77,73 @@ func newFileService(repo *repository.Repositories, cfg *config.Config) *file.Ser
 	log.Printf("File service initialized with type: %s", storageType)
 	return fileSvc
 }
+
+// newEmbedder 创建 Embedder
+func newEmbedder(ctx context.Context, cfg *config.Config) (embedding.Embedder, error) {
+	embCfg := cfg.AI.Embedding
+
+	timeout := time.Duration(embCfg.Timeout) * time.Second
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+
+	var dimensions *int
+	if embCfg.Dimensions > 0 {
+		dimensions = &embCfg.Dimensions
+	}
+
+	switch embCfg.Provider {
+	case "alibaba", "qwen", "dashscope":
+		apiKey := embCfg.APIKey
+		if apiKey == "" {
+			apiKey = cfg.AI.Alibaba.AccessKeySecret
+		}
+		if apiKey == "" {
+			return nil, fmt.Errorf("api_key is required for embedding provider: %s", embCfg.Provider)
+		}
+		embedder, err := dashscope.NewEmbedder(ctx, &dashscope.EmbeddingConfig{
+			APIKey:     apiKey,
+			Model:      embCfg.Model,
+			Dimensions: dimensions,
+			Timeout:    timeout,
+		})
+		if err != nil {
+			return nil, err
+		}
+		return embedder, nil
+	case "openai":
+		apiKey := embCfg.APIKey
+		if apiKey == "" {
+			apiKey = cfg.AI.OpenAI.APIKey
+		}
+		if apiKey == "" {
+			return nil, fmt.Errorf("api_key is required for embedding provider: %s", embCfg.Provider)
+		}
+		embedder, err := openaiembed.NewEmbedder(ctx, &openaiembed.EmbeddingConfig{
+			APIKey:     apiKey,
+			BaseURL:    embCfg.BaseURL,
+			Model:      embCfg.Model,
+			Dimensions: dimensions,
+			Timeout:    timeout,
+		})
+		if err != nil {
+			return nil, err
+		}
+		return embedder, nil
+	default:
+		return nil, fmt.Errorf("unsupported embedding provider: %s", embCfg.Provider)
+	}
+}
+
+// newESClient 创建 Elasticsearch 客户端
+func newESClient(cfg *config.Config) (*elasticsearch.Client, error) {
+	if cfg.Elastic.Host == "" {
+		return nil, fmt.Errorf("elastic host is not configured")
+	}
+
+	return elasticsearch.NewClient(elasticsearch.Config{
+		Addresses: []string{cfg.Elastic.Host},
+		Username:  cfg.Elastic.Username,
+		Password:  cfg.Elastic.Password,
+	})
+}
@@ -0,0 +1,170 @@
+package faq
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/ashwinyue/next-ai/internal/model"
+	"github.com/xuri/excelize/v2"
+)
+
+// maxImportRows 单次导入的最大行数
+const maxImportRows = 5000
+
+// headerNames 表头首列可能的名称（识别到时跳过首行）
+var headerNames = map[string]bool{
+	"question": true,
+	"问题":       true,
+	"标准问题":     true,
+}
+
+// ImportResult 导入结果
+type ImportResult struct {
+	Total    int      `json:"total"`
+	Imported int      `json:"imported"`
+	Skipped  int      `json:"skipped"`
+	Errors   []string `json:"errors,omitempty"`
+}
+
+// ImportFAQs 从 CSV 或 Excel 批量导入 FAQ
+// 列顺序：问题, 答案, 相似问法（用 | 或换行分隔，可选）, 分类（可选）
+// 与已有 FAQ 或文件内重复的问题会被跳过
+func (s *Service) ImportFAQs(ctx context.Context, tenantID, fileName string, r io.Reader) (*ImportResult, error) {
+	var rows [][]string
+	var err error
+
+	switch strings.ToLower(filepath.Ext(fileName)) {
+	case ".csv":
+		rows, err = readCSV(r)
+	case ".xlsx":
+		rows, err = readExcel(r)
+	default:
+		return nil, fmt.Errorf("unsupported file type: %s, only .csv and .xlsx are supported", filepath.Ext(fileName))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if len(rows) > 0 && len(rows[0]) > 0 && headerNames[strings.ToLower(strings.TrimSpace(rows[0][0]))] {
+		rows = rows[1:]
+	}
+	if len(rows) > maxImportRows {
+		return nil, fmt.Errorf("too many rows: %d, at most %d rows per import", len(rows), maxImportRows)
+	}
+
+	existing, err := s.repo.FAQ.ListActive(tenantID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load faqs: %w", err)
+	}
+	seen := make(map[string]bool, len(existing))
+	for _, faq := range existing {
+		seen[normalize(faq.Question)] = true
+	}
+
+	result := &ImportResult{}
+	faqs := make([]*model.FAQ, 0, len(rows))
+	for i, row := range rows {
+		if isEmptyRow(row) {
+			continue
+		}
+		result.Total++
+
+		question, answer := cell(row, 0), cell(row, 1)
+		if question == "" || answer == "" {
+			result.Skipped++
+			result.Errors = append(result.Errors, fmt.Sprintf("row %d: question and answer are required", i+1))
+			continue
+		}
+		if seen[normalize(question)] {
+			result.Skipped++
+			continue
+		}
+		seen[normalize(question)] = true
+
+		faqs = append(faqs, &model.FAQ{
+			TenantID:         tenantID,
+			Question:         question,
+			Answer:           answer,
+			SimilarQuestions: cleanQuestions(splitQuestions(cell(row, 2))),
+			Category:         cell(row, 3),
+			IsActive:         true,
+		})
+	}
+
+	s.embedFAQs(ctx, faqs)
+
+	if err := s.repo.FAQ.CreateBatch(faqs); err != nil {
+		return nil, fmt.Errorf("failed to import faqs: %w", err)
+	}
+	result.Imported = len(faqs)
+
+	return result, nil
+}
+
+// readCSV 读取 CSV（兼容 UTF-8 BOM）
+func readCSV(r io.Reader) ([][]string, error) {
+	br := bufio.NewReader(r)
+	if bom, err := br.Peek(3); err == nil && string(bom) == "\xef\xbb\xbf" {
+		_, _ = br.Discard(3)
+	}
+
+	reader := csv.NewReader(br)
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read csv: %w", err)
+	}
+	return rows, nil
+}
+
+// readExcel 读取 Excel 第一个工作表
+func readExcel(r io.Reader) ([][]string, error) {
+	f, err := excelize.OpenReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open excel: %w", err)
+	}
+	defer f.Close()
+
+	sheets := f.GetSheetList()
+	if len(sheets) == 0 {
+		return nil, fmt.Errorf("excel file has no sheet")
+	}
+
+	rows, err := f.GetRows(sheets[0])
+	if err != nil {
+		return nil, fmt.Errorf("failed to read excel rows: %w", err)
+	}
+	return rows, nil
+}
+
+// splitQuestions 拆分相似问法
+func splitQuestions(s string) []string {
+	return strings.FieldsFunc(s, func(r rune) bool {
+		return r == '|' || r == '\n' || r == '｜'
+	})
+}
+
+// cell 读取单元格（越界返回空字符串）
+func cell(row []string, i int) string {
+	if i >= len(row) {
+		return ""
+	}
+	return strings.TrimSpace(row[i])
+}
+
+// isEmptyRow 判断是否为空行
+func isEmptyRow(row []string) bool {
+	for _, c := range row {
+		if strings.TrimSpace(c) != "" {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,383 @@
+// Package faq 提供 FAQ 管理与匹配服务
+// 匹配顺序：规范化后完全一致 -> 语义相似（配置了 Embedder 时）-> 字符二元组相似度
+package faq
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/ashwinyue/next-ai/internal/model"
+	"github.com/ashwinyue/next-ai/internal/repository"
+	"github.com/cloudwego/eino/components/embedding"
+)
+
+// 匹配类型
+const (
+	MatchTypeExact    = "exact"
+	MatchTypeSemantic = "semantic"
+	MatchTypeKeyword  = "keyword"
+)
+
+const (
+	// DefaultMatchThreshold 直接回答所需的默认置信度
+	DefaultMatchThreshold = 0.9
+	// embeddingBatchSize 每批向量化的问题数
+	embeddingBatchSize = 10
+)
+
+// Service FAQ 服务
+type Service struct {
+	repo     *repository.Repositories
+	embedder embedding.Embedder
+}
+
+// NewService 创建 FAQ 服务
+// embedder 为 nil 时仅使用完全匹配和字符相似度
+func NewService(repo *repository.Repositories, embedder embedding.Embedder) *Service {
+	return &Service{
+		repo:     repo,
+		embedder: embedder,
+	}
+}
+
+// CreateFAQRequest 创建 FAQ 请求
+type CreateFAQRequest struct {
+	Question         string   `json:"question" binding:"required"`
+	Answer           string   `json:"answer" binding:"required"`
+	SimilarQuestions []string `json:"similar_questions"`
+	Category         string   `json:"category"`
+	IsActive         *bool    `json:"is_active,omitempty"`
+	TenantID         string   `json:"-"`
+}
+
+// CreateFAQ 创建 FAQ
+func (s *Service) CreateFAQ(ctx context.Context, req *CreateFAQRequest) (*model.FAQ, error) {
+	faq := &model.FAQ{
+		TenantID:         req.TenantID,
+		Question:         strings.TrimSpace(req.Question),
+		Answer:           strings.TrimSpace(req.Answer),
+		SimilarQuestions: cleanQuestions(req.SimilarQuestions),
+		Category:         req.Category,
+		IsActive:         true,
+	}
+	if req.IsActive != nil {
+		faq.IsActive = *req.IsActive
+	}
+	if faq.Question == "" || faq.Answer == "" {
+		return nil, fmt.Errorf("question and answer are required")
+	}
+
+	s.embedFAQs(ctx, []*model.FAQ{faq})
+
+	if err := s.repo.FAQ.Create(faq); err != nil {
+		return nil, fmt.Errorf("failed to create faq: %w", err)
+	}
+	return faq, nil
+}
+
+// GetFAQ 获取 FAQ
+func (s *Service) GetFAQ(ctx context.Context, id string) (*model.FAQ, error) {
+	faq, err := s.repo.FAQ.GetByID(id)
+	if err != nil {
+		return nil, fmt.Errorf("faq not found: %w", err)
+	}
+	return faq, nil
+}
+
+// ListFAQsRequest 列出 FAQ 请求
+type ListFAQsRequest struct {
+	TenantID   string `json:"tenant_id"`
+	Category   string `json:"category"`
+	ActiveOnly bool   `json:"active_only"`
+	Page       int    `json:"page"`
+	Size       int    `json:"size"`
+}
+
+// ListFAQs 列出 FAQ
+func (s *Service) ListFAQs(ctx context.Context, req *ListFAQsRequest) ([]*model.FAQ, int64, error) {
+	if req.Page <= 0 {
+		req.Page = 1
+	}
+	if req.Size <= 0 || req.Size > 100 {
+		req.Size = 20
+	}
+
+	offset := (req.Page - 1) * req.Size
+	faqs, total, err := s.repo.FAQ.List(req.TenantID, req.Category, req.ActiveOnly, offset, req.Size)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list faqs: %w", err)
+	}
+	return faqs, total, nil
+}
+
+// UpdateFAQRequest 更新 FAQ 请求
+type UpdateFAQRequest struct {
+	Question         *string   `json:"question,omitempty"`
+	Answer           *string   `json:"answer,omitempty"`
+	SimilarQuestions *[]string `json:"similar_questions,omitempty"`
+	Category         *string   `json:"category,omitempty"`
+	IsActive         *bool     `json:"is_active,omitempty"`
+}
+
+// UpdateFAQ 更新 FAQ，问题或相似问法变化时重新向量化
+func (s *Service) UpdateFAQ(ctx context.Context, id string, req *UpdateFAQRequest) (*model.FAQ, error) {
+	faq, err := s.repo.FAQ.GetByID(id)
+	if err != nil {
+		return nil, fmt.Errorf("faq not found: %w", err)
+	}
+
+	questionsChanged := false
+	if req.Question != nil {
+		q := strings.TrimSpace(*req.Question)
+		if q == "" {
+			return nil, fmt.Errorf("question cannot be empty")
+		}
+		questionsChanged = questionsChanged || q != faq.Question
+		faq.Question = q
+	}
+	if req.SimilarQuestions != nil {
+		faq.SimilarQuestions = cleanQuestions(*req.SimilarQuestions)
+		questionsChanged = true
+	}
+	if req.Answer != nil {
+		a := strings.TrimSpace(*req.Answer)
+		if a == "" {
+			return nil, fmt.Errorf("answer cannot be empty")
+		}
+		faq.Answer = a
+	}
+	if req.Category != nil {
+		faq.Category = *req.Category
+	}
+	if req.IsActive != nil {
+		faq.IsActive = *req.IsActive
+	}
+
+	if questionsChanged || len(faq.Embeddings) != len(faq.Questions()) {
+		s.embedFAQs(ctx, []*model.FAQ{faq})
+	}
+
+	if err := s.repo.FAQ.Update(faq); err != nil {
+		return nil, fmt.Errorf("failed to update faq: %w", err)
+	}
+	return faq, nil
+}
+
+// DeleteFAQ 删除 FAQ
+func (s *Service) DeleteFAQ(ctx context.Context, id string) error {
+	if _, err := s.repo.FAQ.GetByID(id); err != nil {
+		return fmt.Errorf("faq not found: %w", err)
+	}
+	if err := s.repo.FAQ.Delete(id); err != nil {
+		return fmt.Errorf("failed to delete faq: %w", err)
+	}
+	return nil
+}
+
+// SearchResult FAQ 搜索结果
+type SearchResult struct {
+	FAQ             *model.FAQ `json:"faq"`
+	Score           float64    `json:"score"`
+	MatchType       string     `json:"match_type"`       // exact, semantic, keyword
+	MatchedQuestion string     `json:"matched_question"` // 命中的问法
+}
+
+// SearchFAQs 搜索启用的 FAQ，按匹配分数降序返回
+func (s *Service) SearchFAQs(ctx context.Context, tenantID, query string, limit int) ([]*SearchResult, error) {
+	query = strings.TrimSpace(query)
+	if query == "" {
+		return nil, fmt.Errorf("query is required")
+	}
+	if limit <= 0 || limit > 50 {
+		limit = 10
+	}
+
+	faqs, err := s.repo.FAQ.ListActive(tenantID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load faqs: %w", err)
+	}
+
+	results := s.score(ctx, faqs, query)
+	if len(results) > limit {
+		results = results[:limit]
+	}
+	return results, nil
+}
+
+// Match 返回置信度不低于 threshold 的最佳 FAQ，未命中时返回 nil
+// 命中时累加 FAQ 的命中次数
+func (s *Service) Match(ctx context.Context, tenantID, query string, threshold float64) (*SearchResult, error) {
+	if threshold <= 0 {
+		threshold = DefaultMatchThreshold
+	}
+
+	results, err := s.SearchFAQs(ctx, tenantID, query, 1)
+	if err != nil {
+		return nil, err
+	}
+	if len(results) == 0 || results[0].Score < threshold {
+		return nil, nil
+	}
+
+	best := results[0]
+	if err := s.repo.FAQ.IncrementHitCount(best.FAQ.ID); err != nil {
+		log.Printf("Warning: failed to increment hit count of faq %s: %v", best.FAQ.ID, err)
+	}
+	return best, nil
+}
+
+// score 计算查询与每个 FAQ 的匹配分数
+func (s *Service) score(ctx context.Context, faqs []*model.FAQ, query string) []*SearchResult {
+	normQuery := normalize(query)
+
+	var queryVector []float64
+	if s.embedder != nil && len(faqs) > 0 {
+		vectors, err := s.embedder.EmbedStrings(ctx, []string{query})
+		if err != nil {
+			log.Printf("Warning: failed to embed faq query: %v", err)
+		} else if len(vectors) == 1 {
+			queryVector = vectors[0]
+		}
+	}
+
+	results := make([]*SearchResult, 0)
+	for _, faq := range faqs {
+		best := &SearchResult{FAQ: faq}
+		questions := faq.Questions()
+		hasVectors := queryVector != nil && len(faq.Embeddings) == len(questions)
+
+		for i, q := range questions {
+			if normQuery != "" && normalize(q) == normQuery {
+				best.Score, best.MatchType, best.MatchedQuestion = 1, MatchTypeExact, q
+				break
+			}
+			if hasVectors {
+				if sim := cosine(queryVector, faq.Embeddings[i]); sim > best.Score {
+					best.Score, best.MatchType, best.MatchedQuestion = sim, MatchTypeSemantic, q
+				}
+			}
+			if sim := bigramSimilarity(normQuery, normalize(q)); sim > best.Score {
+				best.Score, best.MatchType, best.MatchedQuestion = sim, MatchTypeKeyword, q
+			}
+		}
+
+		if best.Score > 0 {
+			results = append(results, best)
+		}
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].Score == results[j].Score {
+			return results[i].FAQ.HitCount > results[j].FAQ.HitCount
+		}
+		return results[i].Score > results[j].Score
+	})
+	return results
+}
+
+// embedFAQs 为 FAQ 的全部问法生成向量，失败时清空向量（退化为字符匹配）
+func (s *Service) embedFAQs(ctx context.Context, faqs []*model.FAQ) {
+	if s.embedder == nil || len(faqs) == 0 {
+		return
+	}
+
+	var texts []string
+	for _, faq := range faqs {
+		texts = append(texts, faq.Questions()...)
+	}
+
+	vectors := make([][]float64, 0, len(texts))
+	for start := 0; start < len(texts); start += embeddingBatchSize {
+		end := min(start+embeddingBatchSize, len(texts))
+		batch, err := s.embedder.EmbedStrings(ctx, texts[start:end])
+		if err != nil || len(batch) != end-start {
+			log.Printf("Warning: failed to embed faq questions: %v", err)
+			for _, faq := range faqs {
+				faq.Embeddings = nil
+			}
+			return
+		}
+		vectors = append(vectors, batch...)
+	}
+
+	offset := 0
+	for _, faq := range faqs {
+		n := len(faq.Questions())
+		faq.Embeddings = vectors[offset : offset+n]
+		offset += n
+	}
+}
+
+// cleanQuestions 去除空白、重复以及规范化后为空（如纯标点）的相似问法
+func cleanQuestions(questions []string) []string {
+	seen := make(map[string]bool, len(questions))
+	result := make([]string, 0, len(questions))
+	for _, q := range questions {
+		q = strings.TrimSpace(q)
+		key := normalize(q)
+		if key == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		result = append(result, q)
+	}
+	return result
+}
+
+// normalize 规范化问题：转小写，去除空白和标点
+func normalize(s string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(s) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// bigramSimilarity 字符二元组 Dice 系数，适合中文短问题
+func bigramSimilarity(a, b string) float64 {
+	ra, rb := []rune(a), []rune(b)
+	if len(ra) < 2 || len(rb) < 2 {
+		return 0
+	}
+
+	counts := make(map[string]int, len(ra))
+	for i := 0; i+1 < len(ra); i++ {
+		counts[string(ra[i:i+2])]++
+	}
+
+	var overlap int
+	for i := 0; i+1 < len(rb); i++ {
+		bg := string(rb[i : i+2])
+		if counts[bg] > 0 {
+			counts[bg]--
+			overlap++
+		}
+	}
+
+	return 2 * float64(overlap) / float64(len(ra)-1+len(rb)-1)
+}
+
+// cosine 余弦相似度
+func cosine(a, b []float64) float64 {
+	if len(a) != len(b) || len(a) == 0 {
+		return 0
+	}
+
+	var dot, na, nb float64
+	for i := range a {
+		dot += a[i] * b[i]
+		na += a[i] * a[i]
+		nb += b[i] * b[i]
+	}
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(na) * math.Sqrt(nb))
+}
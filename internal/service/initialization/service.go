@@ -10,7 +10,9 @@ import (
 	"strings"
 	"time"
 
+	dbmodel "github.com/ashwinyue/next-ai/internal/model"
 	"github.com/ashwinyue/next-ai/internal/repository"
+	"github.com/ashwinyue/next-ai/internal/service/rerank"
 	"github.com/cloudwego/eino-ext/components/embedding/ollama"
 	"github.com/cloudwego/eino-ext/components/embedding/openai"
 	"github.com/cloudwego/eino/components/embedding"
@@ -21,13 +23,13 @@ import (
 // Service 初始化服务
 type Service struct {
 	repo      *repository.Repositories
-	chatModel model.ChatModel
+	chatModel model.BaseChatModel
 	startTime time.Time
 	version   string
 }
 
 // NewService 创建初始化服务
-func NewService(repo *repository.Repositories, chatModel model.ChatModel) *Service {
+func NewService(repo *repository.Repositories, chatModel model.BaseChatModel) *Service {
 	return &Service{
 		repo:      repo,
 		chatModel: chatModel,
@@ -453,50 +455,47 @@ func (s *Service) CheckRerankModel(ctx context.Context, req *CheckRerankModelReq
 		}, nil
 	}
 
-	// 构造 Rerank 测试请求
-	rerankURL := fmt.Sprintf("%s/rerank", strings.TrimSuffix(req.BaseURL, "/"))
-	payload := map[string]interface{}{
-		"model":     req.ModelName,
-		"query":     "test query",
-		"documents": []string{"document 1", "document 2"},
-		"top_n":     1,
-	}
-
-	body, err := json.Marshal(payload)
-	if err != nil {
-		return nil, fmt.Errorf("编码请求失败: %w", err)
-	}
-
-	httpReq, err := http.NewRequestWithContext(ctx, "POST", rerankURL, strings.NewReader(string(body)))
+	// 使用与检索相同的 Rerank 客户端做一次真实重排
+	reranker, err := rerank.NewAPIReranker(&dbmodel.Model{
+		Name:   req.ModelName,
+		Type:   dbmodel.ModelTypeRerank,
+		Source: dbmodel.ModelSourceRemote,
+		Parameters: dbmodel.ModelParameters{
+			BaseURL: req.BaseURL,
+			APIKey:  req.APIKey,
+		},
+	}, rerank.Options{})
 	if err != nil {
-		return nil, fmt.Errorf("创建请求失败: %w", err)
+		return &CheckRerankModelResponse{
+			Available: false,
+			Message:   fmt.Sprintf("配置无效: %v", err),
+		}, nil
 	}
 
-	httpReq.Header.Set("Content-Type", "application/json")
-	if req.APIKey != "" {
-		httpReq.Header.Set("Authorization", "Bearer "+req.APIKey)
-	}
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
 
-	client := &http.Client{Timeout: 30 * time.Second}
-	resp, err := client.Do(httpReq)
+	docs, err := reranker.Rerank(ctx, "什么是人工智能", []*schema.Document{
+		{ID: "1", Content: "今天天气晴朗，适合出游。"},
+		{ID: "2", Content: "人工智能是研究如何让计算机模拟人类智能的学科。"},
+	})
 	if err != nil {
 		return &CheckRerankModelResponse{
 			Available: false,
-			Message:   fmt.Sprintf("连接失败: %v", err),
+			Message:   fmt.Sprintf("Rerank 测试失败: %v", err),
 		}, nil
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode == http.StatusOK {
+	if len(docs) == 0 {
 		return &CheckRerankModelResponse{
-			Available: true,
-			Message:   "Rerank 功能正常",
+			Available: false,
+			Message:   "Rerank 返回结果为空",
 		}, nil
 	}
 
 	return &CheckRerankModelResponse{
-		Available: false,
-		Message:   fmt.Sprintf("Rerank 测试失败，状态码: %d", resp.StatusCode),
+		Available: true,
+		Message:   "Rerank 功能正常",
 	}, nil
 }
 
@@ -0,0 +1,322 @@
+package knowledge
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/ashwinyue/next-ai/internal/model"
+	"github.com/cloudwego/eino-ext/components/document/parser/docx"
+	"github.com/cloudwego/eino-ext/components/document/parser/pdf"
+	"github.com/cloudwego/eino-ext/components/document/transformer/splitter/recursive"
+	"github.com/cloudwego/eino-ext/components/indexer/es8"
+	"github.com/cloudwego/eino/components/document"
+	"github.com/cloudwego/eino/components/document/parser"
+	"github.com/cloudwego/eino/schema"
+)
+
+// Elasticsearch 索引字段
+const (
+	fieldContent         = "content"
+	fieldContentVector   = "content_vector"
+	fieldTenantID        = "tenant_id"
+	fieldKnowledgeBaseID = "knowledge_base_id"
+	fieldKnowledgeID     = "knowledge_id"
+	fieldChunkIndex      = "chunk_index"
+	fieldTitle           = "title"
+)
+
+const (
+	// embeddingBatchSize 每批向量化的分块数（DashScope 单次最多 10 条）
+	embeddingBatchSize = 10
+	// processTimeout 单个文档处理超时
+	processTimeout = 30 * time.Minute
+)
+
+// chunkSeparators 分块分隔符，按优先级从段落到句子，兼顾中英文标点
+var chunkSeparators = []string{"\n\n", "\n", "。", "！", "？", "；", ". ", "! ", "? ", "; ", " "}
+
+// newParser 创建按扩展名分发的文档解析器
+// pdf/docx 使用专用解析器，其余文本类文件按纯文本处理
+func newParser(ctx context.Context) (parser.Parser, error) {
+	pdfParser, err := pdf.NewPDFParser(ctx, &pdf.Config{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create pdf parser: %w", err)
+	}
+
+	docxParser, err := docx.NewDocxParser(ctx, &docx.Config{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create docx parser: %w", err)
+	}
+
+	return parser.NewExtParser(ctx, &parser.ExtParserConfig{
+		Parsers: map[string]parser.Parser{
+			".pdf":  pdfParser,
+			".docx": docxParser,
+		},
+		FallbackParser: parser.TextParser{},
+	})
+}
+
+// newSplitter 创建递归分块器，长度按字符（rune）计算
+func newSplitter(ctx context.Context, chunkSize, chunkOverlap int) (document.Transformer, error) {
+	return recursive.NewSplitter(ctx, &recursive.Config{
+		ChunkSize:   chunkSize,
+		OverlapSize: chunkOverlap,
+		Separators:  chunkSeparators,
+		LenFunc:     utf8.RuneCountInString,
+	})
+}
+
+// newIndexer 创建 ES8 索引器，content 字段写入时自动向量化到 content_vector
+func (s *Service) newIndexer(ctx context.Context) (*es8.Indexer, error) {
+	return es8.NewIndexer(ctx, &es8.IndexerConfig{
+		Client:    s.es,
+		Index:     s.indexName,
+		BatchSize: embeddingBatchSize,
+		DocumentToFields: func(ctx context.Context, doc *schema.Document) (map[string]es8.FieldValue, error) {
+			return map[string]es8.FieldValue{
+				fieldContent: {
+					Value:    doc.Content,
+					EmbedKey: fieldContentVector,
+				},
+				fieldTenantID:        {Value: doc.MetaData[fieldTenantID]},
+				fieldKnowledgeBaseID: {Value: doc.MetaData[fieldKnowledgeBaseID]},
+				fieldKnowledgeID:     {Value: doc.MetaData[fieldKnowledgeID]},
+				fieldChunkIndex:      {Value: doc.MetaData[fieldChunkIndex]},
+				fieldTitle:           {Value: doc.MetaData[fieldTitle]},
+			}, nil
+		},
+		Embedding: s.embedder,
+	})
+}
+
+// processDocument 处理文档：解析 -> 分块 -> 保存分块 -> 向量化索引
+func (s *Service) processDocument(ctx context.Context, kb *model.KnowledgeBase, k *model.Knowledge) {
+	ctx, cancel := context.WithTimeout(ctx, processTimeout)
+	defer cancel()
+
+	if err := s.repo.Knowledge.UpdateKnowledgeStatus(k.ID, model.ParseStatusProcessing, "", 0); err != nil {
+		log.Printf("Warning: failed to update status of document %s: %v", k.ID, err)
+	}
+
+	count, err := s.indexDocument(ctx, kb, k)
+	if err != nil {
+		log.Printf("Failed to process document %s (%s): %v", k.ID, k.FileName, err)
+		if err := s.repo.Knowledge.UpdateKnowledgeStatus(k.ID, model.ParseStatusFailed, err.Error(), 0); err != nil {
+			log.Printf("Warning: failed to update status of document %s: %v", k.ID, err)
+		}
+		return
+	}
+
+	if err := s.repo.Knowledge.UpdateKnowledgeStatus(k.ID, model.ParseStatusCompleted, "", count); err != nil {
+		log.Printf("Warning: failed to update status of document %s: %v", k.ID, err)
+	}
+	log.Printf("Document %s (%s) indexed with %d chunks", k.ID, k.FileName, count)
+}
+
+// indexDocument 执行文档处理流水线，返回分块数量
+func (s *Service) indexDocument(ctx context.Context, kb *model.KnowledgeBase, k *model.Knowledge) (int, error) {
+	if s.embedder == nil || s.es == nil {
+		return 0, fmt.Errorf("embedding or elasticsearch is not configured")
+	}
+
+	if err := s.ensureIndex(ctx); err != nil {
+		return 0, err
+	}
+
+	// 1. 读取并解析原始文件
+	_, reader, err := s.fileSvc.GetFile(ctx, k.FileID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read file: %w", err)
+	}
+	defer reader.Close()
+
+	p, err := newParser(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	docs, err := p.Parse(ctx, reader, parser.WithURI(k.FileName))
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse document: %w", err)
+	}
+
+	// 2. 分块
+	splitter, err := newSplitter(ctx, kb.ChunkSize, kb.ChunkOverlap)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create splitter: %w", err)
+	}
+
+	splitDocs, err := splitter.Transform(ctx, docs)
+	if err != nil {
+		return 0, fmt.Errorf("failed to split document: %w", err)
+	}
+
+	// 3. 保存分块（重新处理时替换旧分块）
+	chunks := make([]*model.Chunk, 0, len(splitDocs))
+	for _, d := range splitDocs {
+		content := strings.TrimSpace(d.Content)
+		if content == "" {
+			continue
+		}
+		chunks = append(chunks, &model.Chunk{
+			TenantID:        k.TenantID,
+			KnowledgeBaseID: k.KnowledgeBaseID,
+			KnowledgeID:     k.ID,
+			ChunkIndex:      len(chunks),
+			Content:         content,
+			ChunkType:       model.ChunkTypeText,
+		})
+	}
+
+	if len(chunks) == 0 {
+		return 0, fmt.Errorf("no content extracted from document")
+	}
+
+	if err := s.repo.Knowledge.ReplaceChunks(k.ID, chunks); err != nil {
+		return 0, fmt.Errorf("failed to save chunks: %w", err)
+	}
+
+	// 4. 向量化并写入索引，分块 ID 作为 ES 文档 ID
+	if err := s.deleteIndexedChunks(ctx, fieldKnowledgeID, k.ID); err != nil {
+		return 0, err
+	}
+
+	indexer, err := s.newIndexer(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create indexer: %w", err)
+	}
+
+	indexDocs := make([]*schema.Document, 0, len(chunks))
+	for _, c := range chunks {
+		indexDocs = append(indexDocs, &schema.Document{
+			ID:      c.ID,
+			Content: c.Content,
+			MetaData: map[string]any{
+				fieldTenantID:        c.TenantID,
+				fieldKnowledgeBaseID: c.KnowledgeBaseID,
+				fieldKnowledgeID:     c.KnowledgeID,
+				fieldChunkIndex:      c.ChunkIndex,
+				fieldTitle:           k.Title,
+			},
+		})
+	}
+
+	if _, err := indexer.Store(ctx, indexDocs); err != nil {
+		return 0, fmt.Errorf("failed to index chunks: %w", err)
+	}
+
+	return len(chunks), nil
+}
+
+// ensureIndex 确保分块索引存在，不存在时按向量维度创建
+func (s *Service) ensureIndex(ctx context.Context) error {
+	s.indexMu.Lock()
+	defer s.indexMu.Unlock()
+
+	if s.indexReady {
+		return nil
+	}
+
+	res, err := s.es.Indices.Exists([]string{s.indexName}, s.es.Indices.Exists.WithContext(ctx))
+	if err != nil {
+		return fmt.Errorf("failed to check index: %w", err)
+	}
+	res.Body.Close()
+
+	if res.StatusCode == 200 {
+		s.indexReady = true
+		return nil
+	}
+
+	if s.dimensions <= 0 {
+		return fmt.Errorf("embedding dimensions must be configured to create index %s", s.indexName)
+	}
+
+	mapping := map[string]any{
+		"mappings": map[string]any{
+			"properties": map[string]any{
+				fieldContent: map[string]any{"type": "text"},
+				fieldContentVector: map[string]any{
+					"type":       "dense_vector",
+					"dims":       s.dimensions,
+					"index":      true,
+					"similarity": "cosine",
+				},
+				fieldTenantID:        map[string]any{"type": "keyword"},
+				fieldKnowledgeBaseID: map[string]any{"type": "keyword"},
+				fieldKnowledgeID:     map[string]any{"type": "keyword"},
+				fieldChunkIndex:      map[string]any{"type": "integer"},
+				fieldTitle:           map[string]any{"type": "text"},
+			},
+		},
+	}
+	body, err := json.Marshal(mapping)
+	if err != nil {
+		return fmt.Errorf("failed to marshal index mapping: %w", err)
+	}
+
+	res, err = s.es.Indices.Create(
+		s.indexName,
+		s.es.Indices.Create.WithBody(strings.NewReader(string(body))),
+		s.es.Indices.Create.WithContext(ctx),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create index: %w", err)
+	}
+	defer res.Body.Close()
+
+	// 并发创建时可能已被其他实例创建
+	if res.IsError() && !strings.Contains(readBody(res.Body), "resource_already_exists_exception") {
+		return fmt.Errorf("failed to create index %s: %s", s.indexName, res.Status())
+	}
+
+	s.indexReady = true
+	return nil
+}
+
+// deleteIndexedChunks 按字段删除索引中的分块
+func (s *Service) deleteIndexedChunks(ctx context.Context, field, value string) error {
+	if s.es == nil {
+		return nil
+	}
+
+	query := map[string]any{
+		"query": map[string]any{
+			"term": map[string]any{field: value},
+		},
+	}
+	body, err := json.Marshal(query)
+	if err != nil {
+		return fmt.Errorf("failed to marshal delete query: %w", err)
+	}
+
+	res, err := s.es.DeleteByQuery(
+		[]string{s.indexName},
+		strings.NewReader(string(body)),
+		s.es.DeleteByQuery.WithContext(ctx),
+		s.es.DeleteByQuery.WithRefresh(true),
+		s.es.DeleteByQuery.WithIgnoreUnavailable(true),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to delete indexed chunks: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.IsError() && res.StatusCode != 404 {
+		return fmt.Errorf("failed to delete indexed chunks: %s", res.Status())
+	}
+	return nil
+}
+
+// readBody 读取响应体（用于错误信息）
+func readBody(r io.Reader) string {
+	b, _ := io.ReadAll(r)
+	return string(b)
+}
@@ -0,0 +1,360 @@
+package knowledge
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+
+	"github.com/ashwinyue/next-ai/internal/model"
+	"github.com/ashwinyue/next-ai/internal/service/rerank"
+	svctypes "github.com/ashwinyue/next-ai/internal/service/types"
+	"github.com/cloudwego/eino-ext/components/retriever/es8"
+	"github.com/cloudwego/eino-ext/components/retriever/es8/search_mode"
+	"github.com/cloudwego/eino/components/embedding"
+	"github.com/cloudwego/eino/components/retriever"
+	"github.com/cloudwego/eino/schema"
+	"github.com/elastic/go-elasticsearch/v8"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types"
+)
+
+// 租户未配置 ContextConfig 时的检索默认值
+const (
+	defaultEmbeddingTopK    = 5
+	defaultKeywordThreshold = 0.3
+	defaultVectorThreshold  = 0.5
+)
+
+// 检索命中类型
+const (
+	MatchTypeKeyword = "keyword"
+	MatchTypeVector  = "vector"
+	MatchTypeHybrid  = "hybrid"
+)
+
+// SearchScope 检索范围
+// Agent 运行时根据绑定的知识库注入 context，knowledge_search 工具只在该范围内检索
+type SearchScope struct {
+	TenantID         string
+	KnowledgeBaseIDs []string
+}
+
+type searchScopeKey struct{}
+
+// WithSearchScope 将检索范围写入 context
+func WithSearchScope(ctx context.Context, scope *SearchScope) context.Context {
+	return context.WithValue(ctx, searchScopeKey{}, scope)
+}
+
+// SearchScopeFromContext 从 context 读取检索范围
+func SearchScopeFromContext(ctx context.Context) (*SearchScope, bool) {
+	scope, ok := ctx.Value(searchScopeKey{}).(*SearchScope)
+	return scope, ok && scope != nil
+}
+
+// SearchRequest 检索请求
+type SearchRequest struct {
+	Query            string   `json:"query"`
+	TenantID         string   `json:"tenant_id"`
+	KnowledgeBaseIDs []string `json:"knowledge_base_ids"`
+}
+
+// SearchResult 检索结果
+type SearchResult struct {
+	ChunkID         string  `json:"chunk_id"`
+	KnowledgeID     string  `json:"knowledge_id"` // 来源文档 ID
+	KnowledgeBaseID string  `json:"knowledge_base_id"`
+	Title           string  `json:"title"`
+	ChunkIndex      int     `json:"chunk_index"`
+	Content         string  `json:"content"`
+	Score           float64 `json:"score"`                  // 检索分数
+	RerankScore     float64 `json:"rerank_score,omitempty"` // 重排分数
+	MatchType       string  `json:"match_type"`             // keyword, vector, hybrid
+}
+
+// newKeywordRetriever 创建关键词检索器（BM25 全文匹配）
+func newKeywordRetriever(ctx context.Context, client *elasticsearch.Client, index string) (*es8.Retriever, error) {
+	return es8.NewRetriever(ctx, &es8.RetrieverConfig{
+		Client:       client,
+		Index:        index,
+		TopK:         defaultEmbeddingTopK,
+		SearchMode:   search_mode.SearchModeExactMatch(fieldContent),
+		ResultParser: parseHit,
+	})
+}
+
+// newVectorRetriever 创建向量检索器（近似 kNN）
+func newVectorRetriever(ctx context.Context, client *elasticsearch.Client, index string, embedder embedding.Embedder) (*es8.Retriever, error) {
+	return es8.NewRetriever(ctx, &es8.RetrieverConfig{
+		Client: client,
+		Index:  index,
+		TopK:   defaultEmbeddingTopK,
+		SearchMode: search_mode.SearchModeApproximate(&search_mode.ApproximateConfig{
+			QueryFieldName:  fieldContent,
+			VectorFieldName: fieldContentVector,
+		}),
+		ResultParser: parseHit,
+		Embedding:    embedder,
+	})
+}
+
+// parseHit 将 ES 命中结果转换为 Document
+func parseHit(ctx context.Context, hit types.Hit) (*schema.Document, error) {
+	var source struct {
+		Content         string `json:"content"`
+		TenantID        string `json:"tenant_id"`
+		KnowledgeBaseID string `json:"knowledge_base_id"`
+		KnowledgeID     string `json:"knowledge_id"`
+		ChunkIndex      int    `json:"chunk_index"`
+		Title           string `json:"title"`
+	}
+	if err := json.Unmarshal(hit.Source_, &source); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal hit source: %w", err)
+	}
+
+	doc := &schema.Document{
+		Content: source.Content,
+		MetaData: map[string]any{
+			fieldTenantID:        source.TenantID,
+			fieldKnowledgeBaseID: source.KnowledgeBaseID,
+			fieldKnowledgeID:     source.KnowledgeID,
+			fieldChunkIndex:      source.ChunkIndex,
+			fieldTitle:           source.Title,
+		},
+	}
+	if hit.Id_ != nil {
+		doc.ID = *hit.Id_
+	}
+	if hit.Score_ != nil {
+		doc.WithScore(float64(*hit.Score_))
+	}
+
+	return doc, nil
+}
+
+// Search 在指定知识库中进行关键词 + 向量混合检索，再对召回结果重排
+// 召回数量和过滤阈值取自租户 ContextConfig（EmbeddingTopK / KeywordThreshold / VectorThreshold），
+// 重排数量和阈值取自 ConversationConfig（RerankTopK / RerankThreshold）
+func (s *Service) Search(ctx context.Context, req *SearchRequest) ([]*SearchResult, error) {
+	if req.Query == "" {
+		return nil, fmt.Errorf("query is required")
+	}
+	if len(req.KnowledgeBaseIDs) == 0 {
+		return nil, fmt.Errorf("at least one knowledge base is required")
+	}
+	if s.keywordRetriever == nil || s.vectorRetriever == nil {
+		return nil, fmt.Errorf("knowledge search is not available: embedding or elasticsearch is not configured")
+	}
+
+	tenant := s.getTenant(req.TenantID)
+	cfg := contextConfig(tenant)
+
+	kbIDs := make([]types.FieldValue, 0, len(req.KnowledgeBaseIDs))
+	for _, id := range req.KnowledgeBaseIDs {
+		kbIDs = append(kbIDs, id)
+	}
+	filters := []types.Query{
+		{Terms: &types.TermsQuery{TermsQuery: map[string]types.TermsQueryField{fieldKnowledgeBaseID: kbIDs}}},
+	}
+	if req.TenantID != "" {
+		filters = append(filters, types.Query{Term: map[string]types.TermQuery{fieldTenantID: {Value: req.TenantID}}})
+	}
+
+	opts := []retriever.Option{
+		retriever.WithTopK(cfg.EmbeddingTopK),
+		es8.WithFilters(filters),
+	}
+
+	keywordDocs, err := s.keywordRetriever.Retrieve(ctx, req.Query, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("keyword retrieval failed: %w", err)
+	}
+
+	vectorDocs, err := s.vectorRetriever.Retrieve(ctx, req.Query, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("vector retrieval failed: %w", err)
+	}
+
+	results := mergeResults(keywordDocs, vectorDocs, cfg)
+	if len(results) == 0 {
+		return results, nil
+	}
+
+	reranker := s.newReranker(ctx, rerankOptions(tenant, cfg))
+	return rerankResults(ctx, reranker, req.Query, results)
+}
+
+// newReranker 创建重排器
+// 优先使用默认 Rerank 模型，调用失败或未配置时使用本地 BM25
+func (s *Service) newReranker(ctx context.Context, opts rerank.Options) svctypes.Reranker {
+	fallback := rerank.NewBM25Reranker(opts)
+
+	m, err := s.repo.Model.GetDefaultByType(ctx, model.ModelTypeRerank)
+	if err != nil || m == nil {
+		return fallback
+	}
+
+	apiReranker, err := rerank.NewAPIReranker(m, opts)
+	if err != nil {
+		log.Printf("Warning: failed to create rerank model %s: %v", m.Name, err)
+		return fallback
+	}
+
+	return rerank.NewFallbackReranker(apiReranker, fallback)
+}
+
+// rerankResults 对检索结果重排，返回重排后保留的结果
+func rerankResults(ctx context.Context, reranker svctypes.Reranker, query string, results []*SearchResult) ([]*SearchResult, error) {
+	byID := make(map[string]*SearchResult, len(results))
+	docs := make([]*schema.Document, 0, len(results))
+	for _, r := range results {
+		byID[r.ChunkID] = r
+		docs = append(docs, &schema.Document{ID: r.ChunkID, Content: r.Content})
+	}
+
+	reranked, err := reranker.Rerank(ctx, query, docs)
+	if err != nil {
+		return nil, fmt.Errorf("rerank failed: %w", err)
+	}
+
+	out := make([]*SearchResult, 0, len(reranked))
+	for _, d := range reranked {
+		r, ok := byID[d.ID]
+		if !ok {
+			continue
+		}
+		r.RerankScore = d.Score()
+		out = append(out, r)
+	}
+	return out, nil
+}
+
+// cosineFromESScore 将 ES cosine 相似度分数 (1+cos)/2 还原为余弦相似度
+func cosineFromESScore(score float64) float64 {
+	return 2*score - 1
+}
+
+// mergeResults 合并关键词和向量检索结果
+// BM25 分数没有上界，按本次最高分归一化到 [0,1] 后再与 KeywordThreshold 比较；
+// ES kNN 的 cosine 分数为 (1+cos)/2，先还原为余弦相似度再与 VectorThreshold 比较。
+// 两路都命中的分块取较高分并标记为 hybrid。
+func mergeResults(keywordDocs, vectorDocs []*schema.Document, cfg model.ContextConfig) []*SearchResult {
+	byID := make(map[string]*SearchResult)
+
+	var maxKeywordScore float64
+	for _, d := range keywordDocs {
+		if d.Score() > maxKeywordScore {
+			maxKeywordScore = d.Score()
+		}
+	}
+
+	for _, d := range keywordDocs {
+		if maxKeywordScore <= 0 {
+			break
+		}
+		score := d.Score() / maxKeywordScore
+		if score < cfg.KeywordThreshold {
+			continue
+		}
+		byID[d.ID] = newSearchResult(d, score, MatchTypeKeyword)
+	}
+
+	for _, d := range vectorDocs {
+		score := cosineFromESScore(d.Score())
+		if score < cfg.VectorThreshold {
+			continue
+		}
+		if r, ok := byID[d.ID]; ok {
+			r.MatchType = MatchTypeHybrid
+			if score > r.Score {
+				r.Score = score
+			}
+			continue
+		}
+		byID[d.ID] = newSearchResult(d, score, MatchTypeVector)
+	}
+
+	results := make([]*SearchResult, 0, len(byID))
+	for _, r := range byID {
+		results = append(results, r)
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		// 同分时双路命中优先
+		if results[i].Score == results[j].Score {
+			return results[i].MatchType == MatchTypeHybrid && results[j].MatchType != MatchTypeHybrid
+		}
+		return results[i].Score > results[j].Score
+	})
+
+	if len(results) > cfg.EmbeddingTopK {
+		results = results[:cfg.EmbeddingTopK]
+	}
+	return results
+}
+
+// newSearchResult 从检索文档构建结果
+func newSearchResult(d *schema.Document, score float64, matchType string) *SearchResult {
+	r := &SearchResult{
+		ChunkID:   d.ID,
+		Content:   d.Content,
+		Score:     score,
+		MatchType: matchType,
+	}
+	r.KnowledgeID, _ = d.MetaData[fieldKnowledgeID].(string)
+	r.KnowledgeBaseID, _ = d.MetaData[fieldKnowledgeBaseID].(string)
+	r.Title, _ = d.MetaData[fieldTitle].(string)
+	r.ChunkIndex, _ = d.MetaData[fieldChunkIndex].(int)
+	return r
+}
+
+// getTenant 获取租户，不存在时返回 nil（使用默认配置）
+func (s *Service) getTenant(tenantID string) *model.Tenant {
+	if tenantID == "" {
+		return nil
+	}
+	tenant, err := s.repo.Tenant.GetByID(tenantID)
+	if err != nil {
+		return nil
+	}
+	return tenant
+}
+
+// contextConfig 获取租户的检索配置，未设置的字段使用默认值
+func contextConfig(tenant *model.Tenant) model.ContextConfig {
+	cfg := model.ContextConfig{
+		EmbeddingTopK:    defaultEmbeddingTopK,
+		KeywordThreshold: defaultKeywordThreshold,
+		VectorThreshold:  defaultVectorThreshold,
+	}
+	if tenant == nil || tenant.ContextConfig == nil {
+		return cfg
+	}
+
+	if tenant.ContextConfig.EmbeddingTopK > 0 {
+		cfg.EmbeddingTopK = tenant.ContextConfig.EmbeddingTopK
+	}
+	if tenant.ContextConfig.KeywordThreshold > 0 {
+		cfg.KeywordThreshold = tenant.ContextConfig.KeywordThreshold
+	}
+	if tenant.ContextConfig.VectorThreshold > 0 {
+		cfg.VectorThreshold = tenant.ContextConfig.VectorThreshold
+	}
+	return cfg
+}
+
+// rerankOptions 获取租户的重排配置
+// 未设置 RerankTopK 时保留全部召回结果，未设置 RerankThreshold 时不过滤
+func rerankOptions(tenant *model.Tenant, cfg model.ContextConfig) rerank.Options {
+	opts := rerank.Options{TopK: cfg.EmbeddingTopK}
+	if tenant == nil || tenant.ConversationConfig == nil {
+		return opts
+	}
+
+	if tenant.ConversationConfig.RerankTopK > 0 {
+		opts.TopK = tenant.ConversationConfig.RerankTopK
+	}
+	opts.Threshold = tenant.ConversationConfig.RerankThreshold
+	return opts
+}
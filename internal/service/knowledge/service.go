@@ -0,0 +1,397 @@
+// Package knowledge 提供知识库管理服务
+// 文档上传后异步完成 解析 -> 分块 -> 向量化 -> 写入 Elasticsearch
+package knowledge
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/ashwinyue/next-ai/internal/config"
+	"github.com/ashwinyue/next-ai/internal/model"
+	"github.com/ashwinyue/next-ai/internal/repository"
+	"github.com/ashwinyue/next-ai/internal/service/file"
+	"github.com/cloudwego/eino-ext/components/retriever/es8"
+	"github.com/cloudwego/eino/components/embedding"
+	"github.com/elastic/go-elasticsearch/v8"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultChunkSize    = 1000
+	defaultChunkOverlap = 200
+)
+
+// supportedFileTypes 支持的文档类型
+var supportedFileTypes = map[string]bool{
+	"pdf":      true,
+	"docx":     true,
+	"txt":      true,
+	"md":       true,
+	"markdown": true,
+	"csv":      true,
+	"json":     true,
+}
+
+// Service 知识库服务
+type Service struct {
+	repo       *repository.Repositories
+	fileSvc    *file.Service
+	embedder   embedding.Embedder
+	es         *elasticsearch.Client
+	indexName  string
+	dimensions int
+
+	indexMu    sync.Mutex
+	indexReady bool
+
+	keywordRetriever *es8.Retriever
+	vectorRetriever  *es8.Retriever
+}
+
+// NewService 创建知识库服务
+// embedder 或 es 为 nil 时仍可管理知识库，但文档无法完成向量化索引，检索也不可用
+func NewService(
+	ctx context.Context,
+	repo *repository.Repositories,
+	cfg *config.Config,
+	fileSvc *file.Service,
+	embedder embedding.Embedder,
+	es *elasticsearch.Client,
+) *Service {
+	prefix := cfg.Elastic.IndexPrefix
+	if prefix == "" {
+		prefix = "next_ai"
+	}
+
+	s := &Service{
+		repo:       repo,
+		fileSvc:    fileSvc,
+		embedder:   embedder,
+		es:         es,
+		indexName:  prefix + "_chunks",
+		dimensions: cfg.AI.Embedding.Dimensions,
+	}
+
+	if es != nil && embedder != nil {
+		var err error
+		if s.keywordRetriever, err = newKeywordRetriever(ctx, es, s.indexName); err != nil {
+			log.Printf("Warning: failed to create keyword retriever: %v", err)
+		}
+		if s.vectorRetriever, err = newVectorRetriever(ctx, es, s.indexName, embedder); err != nil {
+			log.Printf("Warning: failed to create vector retriever: %v", err)
+		}
+	}
+
+	return s
+}
+
+// ========== 知识库 ==========
+
+// CreateKnowledgeBaseRequest 创建知识库请求
+type CreateKnowledgeBaseRequest struct {
+	Name         string `json:"name" binding:"required"`
+	Description  string `json:"description"`
+	ChunkSize    int    `json:"chunk_size"`
+	ChunkOverlap int    `json:"chunk_overlap"`
+	TenantID     string `json:"-"`
+}
+
+// CreateKnowledgeBase 创建知识库
+func (s *Service) CreateKnowledgeBase(ctx context.Context, req *CreateKnowledgeBaseRequest) (*model.KnowledgeBase, error) {
+	if _, err := s.repo.Knowledge.GetKnowledgeBaseByName(req.TenantID, req.Name); err == nil {
+		return nil, fmt.Errorf("knowledge base name already exists")
+	}
+
+	chunkSize, chunkOverlap, err := normalizeChunking(req.ChunkSize, req.ChunkOverlap)
+	if err != nil {
+		return nil, err
+	}
+
+	kb := &model.KnowledgeBase{
+		TenantID:     req.TenantID,
+		Name:         req.Name,
+		Description:  req.Description,
+		ChunkSize:    chunkSize,
+		ChunkOverlap: chunkOverlap,
+	}
+
+	if err := s.repo.Knowledge.CreateKnowledgeBase(kb); err != nil {
+		return nil, fmt.Errorf("failed to create knowledge base: %w", err)
+	}
+
+	return kb, nil
+}
+
+// getKnowledgeBase 获取租户的知识库，其他租户的知识库按不存在处理
+// tenantID 为空时不限租户（与列表一致）
+func (s *Service) getKnowledgeBase(tenantID, id string) (*model.KnowledgeBase, error) {
+	kb, err := s.repo.Knowledge.GetKnowledgeBaseByID(id)
+	if err == nil && tenantID != "" && kb.TenantID != tenantID {
+		err = gorm.ErrRecordNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("knowledge base not found: %w", err)
+	}
+	return kb, nil
+}
+
+// GetKnowledgeBase 获取知识库
+func (s *Service) GetKnowledgeBase(ctx context.Context, tenantID, id string) (*model.KnowledgeBase, error) {
+	kb, err := s.getKnowledgeBase(tenantID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	count, err := s.repo.Knowledge.CountKnowledgeByBase(kb.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count documents: %w", err)
+	}
+	kb.DocumentCount = int(count)
+
+	return kb, nil
+}
+
+// ListKnowledgeBasesRequest 列出知识库请求
+type ListKnowledgeBasesRequest struct {
+	TenantID string `json:"tenant_id"`
+	Page     int    `json:"page"`
+	Size     int    `json:"size"`
+}
+
+// ListKnowledgeBases 列出知识库
+func (s *Service) ListKnowledgeBases(ctx context.Context, req *ListKnowledgeBasesRequest) ([]*model.KnowledgeBase, int64, error) {
+	if req.Page <= 0 {
+		req.Page = 1
+	}
+	if req.Size <= 0 || req.Size > 100 {
+		req.Size = 20
+	}
+
+	offset := (req.Page - 1) * req.Size
+	kbs, total, err := s.repo.Knowledge.ListKnowledgeBases(req.TenantID, offset, req.Size)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list knowledge bases: %w", err)
+	}
+
+	for _, kb := range kbs {
+		count, err := s.repo.Knowledge.CountKnowledgeByBase(kb.ID)
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to count documents: %w", err)
+		}
+		kb.DocumentCount = int(count)
+	}
+
+	return kbs, total, nil
+}
+
+// UpdateKnowledgeBaseRequest 更新知识库请求
+// 分块参数只影响之后上传的文档
+type UpdateKnowledgeBaseRequest struct {
+	Name         *string `json:"name,omitempty"`
+	Description  *string `json:"description,omitempty"`
+	ChunkSize    *int    `json:"chunk_size,omitempty"`
+	ChunkOverlap *int    `json:"chunk_overlap,omitempty"`
+}
+
+// UpdateKnowledgeBase 更新知识库
+func (s *Service) UpdateKnowledgeBase(ctx context.Context, tenantID, id string, req *UpdateKnowledgeBaseRequest) (*model.KnowledgeBase, error) {
+	kb, err := s.getKnowledgeBase(tenantID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Name != nil && *req.Name != kb.Name {
+		if _, err := s.repo.Knowledge.GetKnowledgeBaseByName(kb.TenantID, *req.Name); err == nil {
+			return nil, fmt.Errorf("knowledge base name already exists")
+		}
+		kb.Name = *req.Name
+	}
+	if req.Description != nil {
+		kb.Description = *req.Description
+	}
+
+	chunkSize, chunkOverlap := kb.ChunkSize, kb.ChunkOverlap
+	if req.ChunkSize != nil {
+		chunkSize = *req.ChunkSize
+	}
+	if req.ChunkOverlap != nil {
+		chunkOverlap = *req.ChunkOverlap
+	}
+	kb.ChunkSize, kb.ChunkOverlap, err = normalizeChunking(chunkSize, chunkOverlap)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.repo.Knowledge.UpdateKnowledgeBase(kb); err != nil {
+		return nil, fmt.Errorf("failed to update knowledge base: %w", err)
+	}
+
+	return kb, nil
+}
+
+// DeleteKnowledgeBase 删除知识库（同时删除文档、分块和索引数据）
+func (s *Service) DeleteKnowledgeBase(ctx context.Context, tenantID, id string) error {
+	if _, err := s.getKnowledgeBase(tenantID, id); err != nil {
+		return err
+	}
+
+	if err := s.deleteIndexedChunks(ctx, fieldKnowledgeBaseID, id); err != nil {
+		return err
+	}
+
+	if err := s.repo.Knowledge.DeleteKnowledgeBase(id); err != nil {
+		return fmt.Errorf("failed to delete knowledge base: %w", err)
+	}
+	return nil
+}
+
+// ========== 文档 ==========
+
+// UploadDocumentRequest 上传文档请求
+type UploadDocumentRequest struct {
+	FileName    string
+	ContentType string
+	Size        int64
+	Reader      io.Reader
+	TenantID    string
+	Title       string
+	Description string
+}
+
+// UploadDocument 上传文档到知识库
+// 文件通过 file.Service 保存后立即返回，解析和索引在后台完成，进度见 parse_status
+func (s *Service) UploadDocument(ctx context.Context, kbID string, req *UploadDocumentRequest) (*model.Knowledge, error) {
+	kb, err := s.getKnowledgeBase(req.TenantID, kbID)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.fileSvc == nil {
+		return nil, fmt.Errorf("file service is not available")
+	}
+
+	fileType := strings.TrimPrefix(strings.ToLower(filepath.Ext(req.FileName)), ".")
+	if !supportedFileTypes[fileType] {
+		return nil, fmt.Errorf("unsupported file type: %s", fileType)
+	}
+
+	storedFile, err := s.fileSvc.SaveFile(ctx, &file.SaveFileRequest{
+		FileName:    req.FileName,
+		ContentType: req.ContentType,
+		Size:        req.Size,
+		Reader:      req.Reader,
+		TenantID:    kb.TenantID,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to save document: %w", err)
+	}
+
+	title := req.Title
+	if title == "" {
+		title = strings.TrimSuffix(req.FileName, filepath.Ext(req.FileName))
+	}
+
+	knowledge := &model.Knowledge{
+		TenantID:        kb.TenantID,
+		KnowledgeBaseID: kb.ID,
+		FileID:          storedFile.ID,
+		Title:           title,
+		Description:     req.Description,
+		FileName:        req.FileName,
+		FileType:        fileType,
+		FileSize:        req.Size,
+		ParseStatus:     model.ParseStatusPending,
+	}
+
+	if err := s.repo.Knowledge.CreateKnowledge(knowledge); err != nil {
+		_ = s.fileSvc.DeleteFile(ctx, storedFile.ID)
+		return nil, fmt.Errorf("failed to create document: %w", err)
+	}
+
+	// 后台处理，不受请求 context 取消影响
+	go s.processDocument(context.WithoutCancel(ctx), kb, knowledge)
+
+	return knowledge, nil
+}
+
+// GetDocument 获取文档，其他租户的文档按不存在处理
+func (s *Service) GetDocument(ctx context.Context, tenantID, id string) (*model.Knowledge, error) {
+	k, err := s.repo.Knowledge.GetKnowledgeByID(id)
+	if err == nil && tenantID != "" && k.TenantID != tenantID {
+		err = gorm.ErrRecordNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("document not found: %w", err)
+	}
+	return k, nil
+}
+
+// ListDocumentsRequest 列出文档请求
+type ListDocumentsRequest struct {
+	Page int `json:"page"`
+	Size int `json:"size"`
+}
+
+// ListDocuments 列出知识库中的文档
+func (s *Service) ListDocuments(ctx context.Context, tenantID, kbID string, req *ListDocumentsRequest) ([]*model.Knowledge, int64, error) {
+	if _, err := s.getKnowledgeBase(tenantID, kbID); err != nil {
+		return nil, 0, err
+	}
+
+	if req.Page <= 0 {
+		req.Page = 1
+	}
+	if req.Size <= 0 || req.Size > 100 {
+		req.Size = 20
+	}
+
+	offset := (req.Page - 1) * req.Size
+	items, total, err := s.repo.Knowledge.ListKnowledgeByBase(kbID, offset, req.Size)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list documents: %w", err)
+	}
+	return items, total, nil
+}
+
+// DeleteDocument 删除文档（同时删除分块、索引数据和原始文件）
+func (s *Service) DeleteDocument(ctx context.Context, tenantID, id string) error {
+	k, err := s.GetDocument(ctx, tenantID, id)
+	if err != nil {
+		return err
+	}
+
+	if err := s.deleteIndexedChunks(ctx, fieldKnowledgeID, k.ID); err != nil {
+		return err
+	}
+
+	if err := s.repo.Knowledge.DeleteKnowledge(k.ID); err != nil {
+		return fmt.Errorf("failed to delete document: %w", err)
+	}
+
+	if s.fileSvc != nil && k.FileID != "" {
+		if err := s.fileSvc.DeleteFile(ctx, k.FileID); err != nil {
+			log.Printf("Warning: failed to delete file %s of document %s: %v", k.FileID, k.ID, err)
+		}
+	}
+
+	return nil
+}
+
+// normalizeChunking 校验分块参数并填充默认值，未设置（<= 0）时使用默认值
+func normalizeChunking(size, overlap int) (int, int, error) {
+	if size <= 0 {
+		size = defaultChunkSize
+	}
+	if overlap <= 0 {
+		overlap = defaultChunkOverlap
+	}
+	if overlap >= size {
+		return 0, 0, fmt.Errorf("chunk_overlap (%d) must be less than chunk_size (%d)", overlap, size)
+	}
+	return size, overlap, nil
+}
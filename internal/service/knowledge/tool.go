@@ -0,0 +1,139 @@
+package knowledge
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/cloudwego/eino/components/tool"
+	"github.com/cloudwego/eino/schema"
+)
+
+// SearchToolName 知识库检索工具名称
+const SearchToolName = "knowledge_search"
+
+// SearchToolInput knowledge_search 输入参数
+type SearchToolInput struct {
+	Query            string   `json:"query"`
+	KnowledgeBaseIDs []string `json:"knowledge_base_ids,omitempty"`
+}
+
+// SearchToolOutput knowledge_search 输出
+type SearchToolOutput struct {
+	Query   string          `json:"query"`
+	Results []*SearchResult `json:"results"`
+	Sources []string        `json:"sources"` // 命中的来源文档 ID（去重，按相关度排序）
+	Message string          `json:"message,omitempty"`
+}
+
+// SearchTool 知识库检索工具
+// 检索范围来自 context 中的 SearchScope（Agent 绑定的知识库），模型只能在该范围内收窄
+type SearchTool struct {
+	svc *Service
+}
+
+// NewSearchTool 创建知识库检索工具
+func NewSearchTool(svc *Service) *SearchTool {
+	return &SearchTool{svc: svc}
+}
+
+// Info 返回工具信息
+func (t *SearchTool) Info(ctx context.Context) (*schema.ToolInfo, error) {
+	return &schema.ToolInfo{
+		Name: SearchToolName,
+		Desc: "Search the knowledge bases bound to the current agent using hybrid keyword and semantic retrieval. " +
+			"Returns relevant text chunks with their source document IDs; cite the sources in your answer.",
+		ParamsOneOf: schema.NewParamsOneOfByParams(map[string]*schema.ParameterInfo{
+			"query": {
+				Type:     schema.String,
+				Desc:     "The search query, phrased as a concise question or keywords",
+				Required: true,
+			},
+			"knowledge_base_ids": {
+				Type:     schema.Array,
+				ElemInfo: &schema.ParameterInfo{Type: schema.String},
+				Desc:     "Optional subset of knowledge base IDs to search; defaults to all bound knowledge bases",
+			},
+		}),
+	}, nil
+}
+
+// InvokableRun 执行检索
+func (t *SearchTool) InvokableRun(ctx context.Context, argumentsInJSON string, opts ...tool.Option) (string, error) {
+	var input SearchToolInput
+	if err := json.Unmarshal([]byte(argumentsInJSON), &input); err != nil {
+		return "", fmt.Errorf("invalid arguments: %w", err)
+	}
+	if input.Query == "" {
+		return "", fmt.Errorf("query is required")
+	}
+
+	output := &SearchToolOutput{
+		Query:   input.Query,
+		Results: []*SearchResult{},
+		Sources: []string{},
+	}
+
+	scope, ok := SearchScopeFromContext(ctx)
+	if !ok || len(scope.KnowledgeBaseIDs) == 0 {
+		output.Message = "no knowledge base is bound to this agent"
+		return marshalOutput(output)
+	}
+
+	kbIDs := scope.KnowledgeBaseIDs
+	if len(input.KnowledgeBaseIDs) > 0 {
+		kbIDs = intersect(scope.KnowledgeBaseIDs, input.KnowledgeBaseIDs)
+		if len(kbIDs) == 0 {
+			output.Message = "none of the requested knowledge bases are bound to this agent"
+			return marshalOutput(output)
+		}
+	}
+
+	results, err := t.svc.Search(ctx, &SearchRequest{
+		Query:            input.Query,
+		TenantID:         scope.TenantID,
+		KnowledgeBaseIDs: kbIDs,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	output.Results = results
+	seen := make(map[string]bool, len(results))
+	for _, r := range results {
+		if r.KnowledgeID != "" && !seen[r.KnowledgeID] {
+			seen[r.KnowledgeID] = true
+			output.Sources = append(output.Sources, r.KnowledgeID)
+		}
+	}
+	if len(results) == 0 {
+		output.Message = "no relevant content found"
+	}
+
+	return marshalOutput(output)
+}
+
+// marshalOutput 序列化工具输出
+func marshalOutput(output *SearchToolOutput) (string, error) {
+	b, err := json.Marshal(output)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal output: %w", err)
+	}
+	return string(b), nil
+}
+
+// intersect 返回同时存在于 allowed 和 requested 中的 ID（保持 requested 顺序）
+func intersect(allowed, requested []string) []string {
+	set := make(map[string]bool, len(allowed))
+	for _, id := range allowed {
+		set[id] = true
+	}
+
+	result := make([]string, 0, len(requested))
+	for _, id := range requested {
+		if set[id] {
+			result = append(result, id)
+		}
+	}
+	return result
+}
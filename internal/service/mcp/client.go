@@ -0,0 +1,281 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"time"
+
+	"github.com/ashwinyue/next-ai/internal/model"
+	mcpsdk "github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+const (
+	clientName    = "next-ai"
+	clientVersion = "1.0.0"
+)
+
+// headerRoundTripper 为每个请求注入自定义 HTTP 头
+type headerRoundTripper struct {
+	headers map[string]string
+	next    http.RoundTripper
+}
+
+// RoundTrip 实现 http.RoundTripper
+func (t *headerRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	for k, v := range t.headers {
+		req.Header.Set(k, v)
+	}
+	return t.next.RoundTrip(req)
+}
+
+// advancedOptions 合并默认值后的高级配置
+type advancedOptions struct {
+	timeout    int // 秒
+	retryCount int
+	retryDelay int // 秒
+}
+
+// advancedConfig 返回服务的高级配置，未设置的字段使用默认值
+func advancedConfig(svc *model.MCPService) advancedOptions {
+	def := model.GetDefaultAdvancedConfig()
+	opts := advancedOptions{
+		timeout:    def.Timeout,
+		retryCount: *def.RetryCount,
+		retryDelay: def.RetryDelay,
+	}
+	cfg := svc.AdvancedConfig
+	if cfg == nil {
+		return opts
+	}
+	if cfg.Timeout > 0 {
+		opts.timeout = cfg.Timeout
+	}
+	if cfg.RetryCount != nil && *cfg.RetryCount >= 0 {
+		opts.retryCount = *cfg.RetryCount
+	}
+	if cfg.RetryDelay > 0 {
+		opts.retryDelay = cfg.RetryDelay
+	}
+	return opts
+}
+
+// buildHeaders 合并 Headers 与 AuthConfig 生成请求头
+// 优先级：Headers < AuthConfig.APIKey/Token < AuthConfig.CustomHeaders
+func buildHeaders(svc *model.MCPService) map[string]string {
+	headers := make(map[string]string, len(svc.Headers))
+	for k, v := range svc.Headers {
+		headers[k] = v
+	}
+
+	if auth := svc.AuthConfig; auth != nil {
+		if auth.APIKey != "" {
+			headers["X-API-Key"] = auth.APIKey
+		}
+		if auth.Token != "" {
+			headers["Authorization"] = "Bearer " + auth.Token
+		}
+		for k, v := range auth.CustomHeaders {
+			headers[k] = v
+		}
+	}
+
+	return headers
+}
+
+// newTransport 根据传输类型创建 MCP 传输层
+func newTransport(svc *model.MCPService) (mcpsdk.Transport, error) {
+	switch svc.TransportType {
+	case model.MCPTransportSSE, model.MCPTransportHTTPStreamable:
+		if svc.URL == nil || *svc.URL == "" {
+			return nil, fmt.Errorf("%s transport requires url", svc.TransportType)
+		}
+
+		// 不设置 http.Client.Timeout，避免长连接被中断；超时由 context 控制
+		httpClient := &http.Client{
+			Transport: &headerRoundTripper{
+				headers: buildHeaders(svc),
+				next:    http.DefaultTransport,
+			},
+		}
+
+		if svc.TransportType == model.MCPTransportSSE {
+			return &mcpsdk.SSEClientTransport{
+				Endpoint:   *svc.URL,
+				HTTPClient: httpClient,
+			}, nil
+		}
+		return &mcpsdk.StreamableClientTransport{
+			Endpoint:   *svc.URL,
+			HTTPClient: httpClient,
+			MaxRetries: advancedConfig(svc).retryCount,
+		}, nil
+
+	case model.MCPTransportStdio:
+		if svc.StdioConfig == nil || svc.StdioConfig.Command == "" {
+			return nil, fmt.Errorf("stdio transport requires command")
+		}
+
+		cmd := exec.Command(svc.StdioConfig.Command, svc.StdioConfig.Args...)
+		cmd.Env = os.Environ()
+		for k, v := range svc.EnvVars {
+			cmd.Env = append(cmd.Env, k+"="+v)
+		}
+		return &mcpsdk.CommandTransport{Command: cmd}, nil
+
+	default:
+		return nil, fmt.Errorf("unsupported transport type: %s", svc.TransportType)
+	}
+}
+
+// connect 建立 MCP 客户端会话
+// 连接失败时按 AdvancedConfig 的 RetryCount/RetryDelay 重试，每次尝试受 Timeout 限制
+func connect(ctx context.Context, svc *model.MCPService) (*mcpsdk.ClientSession, error) {
+	cfg := advancedConfig(svc)
+	client := mcpsdk.NewClient(&mcpsdk.Implementation{
+		Name:    clientName,
+		Version: clientVersion,
+	}, nil)
+
+	var lastErr error
+	for attempt := 0; attempt <= cfg.retryCount; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(time.Duration(cfg.retryDelay) * time.Second):
+			}
+		}
+
+		// 传输层（尤其是 stdio 的 exec.Cmd）不可复用，每次尝试重新创建
+		transport, err := newTransport(svc)
+		if err != nil {
+			return nil, err
+		}
+
+		session, err := connectOnce(ctx, client, transport, cfg.timeout)
+		if err == nil {
+			return session, nil
+		}
+		lastErr = err
+	}
+
+	return nil, fmt.Errorf("failed to connect MCP service %s after %d attempts: %w", svc.Name, cfg.retryCount+1, lastErr)
+}
+
+// connectResult 连接结果
+type connectResult struct {
+	session *mcpsdk.ClientSession
+	err     error
+}
+
+// connectOnce 在超时限制内完成一次连接和初始化握手
+func connectOnce(ctx context.Context, client *mcpsdk.Client, transport mcpsdk.Transport, timeout int) (*mcpsdk.ClientSession, error) {
+	// 会话生命周期不能绑定到带超时的 context，因此用独立 goroutine 控制握手超时
+	done := make(chan connectResult, 1)
+	go func() {
+		session, err := client.Connect(context.WithoutCancel(ctx), transport, nil)
+		done <- connectResult{session: session, err: err}
+	}()
+
+	select {
+	case r := <-done:
+		return r.session, r.err
+	case <-ctx.Done():
+		go closeLate(done)
+		return nil, ctx.Err()
+	case <-time.After(time.Duration(timeout) * time.Second):
+		go closeLate(done)
+		return nil, fmt.Errorf("connect timeout after %ds", timeout)
+	}
+}
+
+// closeLate 关闭超时后才完成握手的会话
+func closeLate(done <-chan connectResult) {
+	if r := <-done; r.err == nil && r.session != nil {
+		_ = r.session.Close()
+	}
+}
+
+// withTimeout 为单次 MCP 调用设置超时
+func withTimeout(ctx context.Context, svc *model.MCPService) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, time.Duration(advancedConfig(svc).timeout)*time.Second)
+}
+
+// listTools 列出会话中的全部工具（自动翻页）
+func listTools(ctx context.Context, svc *model.MCPService, session *mcpsdk.ClientSession) ([]*model.MCPTool, error) {
+	ctx, cancel := withTimeout(ctx, svc)
+	defer cancel()
+
+	now := time.Now()
+	tools := make([]*model.MCPTool, 0)
+	params := &mcpsdk.ListToolsParams{}
+	for {
+		res, err := session.ListTools(ctx, params)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list tools: %w", err)
+		}
+
+		for _, t := range res.Tools {
+			inputSchema, err := json.Marshal(t.InputSchema)
+			if err != nil {
+				return nil, fmt.Errorf("failed to marshal input schema of %s: %w", t.Name, err)
+			}
+			tools = append(tools, &model.MCPTool{
+				ID:          svc.ID + "/" + t.Name,
+				ServiceID:   svc.ID,
+				Name:        t.Name,
+				Description: t.Description,
+				InputSchema: inputSchema,
+				CreatedAt:   now,
+			})
+		}
+
+		if res.NextCursor == "" {
+			return tools, nil
+		}
+		params.Cursor = res.NextCursor
+	}
+}
+
+// listResources 列出会话中的全部资源（自动翻页）
+func listResources(ctx context.Context, svc *model.MCPService, session *mcpsdk.ClientSession) ([]*model.MCPResource, error) {
+	// 服务端未声明 resources 能力时直接返回空列表
+	if caps := session.InitializeResult().Capabilities; caps == nil || caps.Resources == nil {
+		return []*model.MCPResource{}, nil
+	}
+
+	ctx, cancel := withTimeout(ctx, svc)
+	defer cancel()
+
+	now := time.Now()
+	resources := make([]*model.MCPResource, 0)
+	params := &mcpsdk.ListResourcesParams{}
+	for {
+		res, err := session.ListResources(ctx, params)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list resources: %w", err)
+		}
+
+		for _, r := range res.Resources {
+			resources = append(resources, &model.MCPResource{
+				ID:          svc.ID + "/" + r.URI,
+				ServiceID:   svc.ID,
+				URI:         r.URI,
+				Name:        r.Name,
+				Description: r.Description,
+				MimeType:    r.MIMEType,
+				CreatedAt:   now,
+			})
+		}
+
+		if res.NextCursor == "" {
+			return resources, nil
+		}
+		params.Cursor = res.NextCursor
+	}
+}
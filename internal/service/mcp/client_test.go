@@ -0,0 +1,209 @@
+package mcp
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ashwinyue/next-ai/internal/model"
+	"github.com/cloudwego/eino/components/tool"
+	"github.com/cloudwego/eino/schema"
+	mcpsdk "github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// fixtureEnv 设置后测试二进制作为 stdio MCP 服务端运行
+const fixtureEnv = "NEXT_AI_MCP_FIXTURE"
+
+func TestMain(m *testing.M) {
+	if os.Getenv(fixtureEnv) == "1" {
+		runFixtureServer()
+		return
+	}
+	os.Exit(m.Run())
+}
+
+// echoInput echo 工具参数
+type echoInput struct {
+	Text string `json:"text" jsonschema:"text to echo"`
+}
+
+// runFixtureServer 以 stdio 运行一个提供 echo 工具和 readme 资源的 MCP 服务端
+func runFixtureServer() {
+	server := mcpsdk.NewServer(&mcpsdk.Implementation{Name: "fixture", Version: "1.0.0"}, nil)
+	mcpsdk.AddTool(server, &mcpsdk.Tool{Name: "echo", Description: "Echo the text back"},
+		func(ctx context.Context, req *mcpsdk.CallToolRequest, in echoInput) (*mcpsdk.CallToolResult, any, error) {
+			return &mcpsdk.CallToolResult{
+				Content: []mcpsdk.Content{&mcpsdk.TextContent{Text: "echo: " + in.Text}},
+			}, nil, nil
+		})
+	server.AddResource(&mcpsdk.Resource{URI: "fixture://readme", Name: "readme", MIMEType: "text/plain"},
+		func(ctx context.Context, req *mcpsdk.ReadResourceRequest) (*mcpsdk.ReadResourceResult, error) {
+			return &mcpsdk.ReadResourceResult{
+				Contents: []*mcpsdk.ResourceContents{{URI: req.Params.URI, MIMEType: "text/plain", Text: "fixture"}},
+			}, nil
+		})
+	if err := server.Run(context.Background(), &mcpsdk.StdioTransport{}); err != nil {
+		os.Exit(1)
+	}
+}
+
+// fixtureService 启动测试二进制自身作为 stdio 服务端的 MCP 服务配置
+func fixtureService(t *testing.T) *model.MCPService {
+	t.Helper()
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatalf("os.Executable: %v", err)
+	}
+	noRetry := 0
+	return &model.MCPService{
+		ID:            "fixture-id",
+		Name:          "fixture",
+		TransportType: model.MCPTransportStdio,
+		StdioConfig:   &model.MCPStdioConfig{Command: exe},
+		EnvVars:       model.MCPEnvVars{fixtureEnv: "1"},
+		AdvancedConfig: &model.MCPAdvancedConfig{
+			Timeout:    10,
+			RetryCount: &noRetry,
+			RetryDelay: 1,
+		},
+	}
+}
+
+func testContext(t *testing.T) context.Context {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	t.Cleanup(cancel)
+	return ctx
+}
+
+func TestAdvancedConfig(t *testing.T) {
+	zero, five := 0, 5
+	cases := []struct {
+		name string
+		cfg  *model.MCPAdvancedConfig
+		want advancedOptions
+	}{
+		{"unset", nil, advancedOptions{timeout: 30, retryCount: 3, retryDelay: 1}},
+		{"timeout only", &model.MCPAdvancedConfig{Timeout: 5}, advancedOptions{timeout: 5, retryCount: 3, retryDelay: 1}},
+		{"no retry", &model.MCPAdvancedConfig{RetryCount: &zero}, advancedOptions{timeout: 30, retryCount: 0, retryDelay: 1}},
+		{"retries", &model.MCPAdvancedConfig{RetryCount: &five, RetryDelay: 2}, advancedOptions{timeout: 30, retryCount: 5, retryDelay: 2}},
+	}
+	for _, tc := range cases {
+		if got := advancedConfig(&model.MCPService{AdvancedConfig: tc.cfg}); got != tc.want {
+			t.Errorf("%s: advancedConfig = %+v, want %+v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestTestConnection(t *testing.T) {
+	result := testConnection(testContext(t), fixtureService(t))
+	if !result.Success {
+		t.Fatalf("testConnection failed: %s", result.Message)
+	}
+	if len(result.Tools) != 1 || result.Tools[0].Name != "echo" {
+		t.Fatalf("tools = %+v, want [echo]", result.Tools)
+	}
+	if len(result.Resources) != 1 || result.Resources[0].URI != "fixture://readme" {
+		t.Fatalf("resources = %+v, want [fixture://readme]", result.Resources)
+	}
+}
+
+func TestTestConnectionFailure(t *testing.T) {
+	svc := fixtureService(t)
+	svc.StdioConfig.Command = "/nonexistent/mcp-server"
+
+	result := testConnection(testContext(t), svc)
+	if result.Success {
+		t.Fatal("testConnection succeeded for a missing command")
+	}
+}
+
+func TestListToolsAndResources(t *testing.T) {
+	ctx := testContext(t)
+	svc := fixtureService(t)
+	session, err := connect(ctx, svc)
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	defer session.Close()
+
+	tools, err := listTools(ctx, svc, session)
+	if err != nil {
+		t.Fatalf("listTools: %v", err)
+	}
+	if len(tools) != 1 {
+		t.Fatalf("got %d tools, want 1", len(tools))
+	}
+	echo := tools[0]
+	if echo.ID != svc.ID+"/echo" || echo.ServiceID != svc.ID || echo.Description != "Echo the text back" {
+		t.Errorf("unexpected tool: %+v", echo)
+	}
+	if !strings.Contains(string(echo.InputSchema), `"text"`) {
+		t.Errorf("input schema %s does not describe text", echo.InputSchema)
+	}
+
+	resources, err := listResources(ctx, svc, session)
+	if err != nil {
+		t.Fatalf("listResources: %v", err)
+	}
+	if len(resources) != 1 {
+		t.Fatalf("got %d resources, want 1", len(resources))
+	}
+	if r := resources[0]; r.Name != "readme" || r.MimeType != "text/plain" || r.ServiceID != svc.ID {
+		t.Errorf("unexpected resource: %+v", r)
+	}
+}
+
+func TestGetTools(t *testing.T) {
+	ctx := testContext(t)
+	session, err := connect(ctx, fixtureService(t))
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	defer session.Close()
+
+	missing, err := getTools(ctx, session, session, []string{"missing"})
+	if err != nil {
+		t.Fatalf("getTools: %v", err)
+	}
+	if len(missing) != 0 {
+		t.Fatalf("got %d tools for an unknown name, want 0", len(missing))
+	}
+
+	tools, err := getTools(ctx, session, session, []string{"echo"})
+	if err != nil {
+		t.Fatalf("getTools: %v", err)
+	}
+	if len(tools) != 1 {
+		t.Fatalf("got %d tools, want 1", len(tools))
+	}
+
+	info, err := tools[0].Info(ctx)
+	if err != nil {
+		t.Fatalf("Info: %v", err)
+	}
+	if info.Name != "echo" || info.ParamsOneOf == nil {
+		t.Fatalf("unexpected tool info: %+v", info)
+	}
+
+	out, err := tools[0].(tool.InvokableTool).InvokableRun(ctx, `{"text":"hello"}`)
+	if err != nil {
+		t.Fatalf("InvokableRun: %v", err)
+	}
+	if !strings.Contains(out, "echo: hello") {
+		t.Errorf("InvokableRun = %s, want it to contain %q", out, "echo: hello")
+	}
+}
+
+func TestMissingTools(t *testing.T) {
+	tools := []tool.BaseTool{&einoTool{info: &schema.ToolInfo{Name: "echo"}}}
+
+	missing, err := missingTools(context.Background(), tools, []string{"echo", "search"})
+	if err != nil {
+		t.Fatalf("missingTools: %v", err)
+	}
+	if len(missing) != 1 || missing[0] != "search" {
+		t.Errorf("missingTools = %v, want [search]", missing)
+	}
+}
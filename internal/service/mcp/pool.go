@@ -0,0 +1,212 @@
+package mcp
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/ashwinyue/next-ai/internal/model"
+	mcpsdk "github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// pooledSession 连接池中的会话
+// refs 为正在使用该会话的调用数，移出连接池后等最后一个调用归还再关闭
+type pooledSession struct {
+	session   *mcpsdk.ClientSession
+	updatedAt time.Time // 建立连接时服务配置的更新时间，配置变更后需重连
+	refs      int
+	evicted   bool
+}
+
+// connectCall 进行中的连接，同一服务的并发请求共享这一次连接
+type connectCall struct {
+	done    chan struct{}
+	err     error
+	evicted bool // 连接期间服务被移除，连接完成后直接关闭
+}
+
+// sessionPool MCP 会话连接池
+// 按服务 ID 复用会话，避免每次 Agent 运行都重新建立连接（stdio 需要启动子进程）
+// 连接在锁外建立，慢服务不会阻塞其他服务的会话获取
+type sessionPool struct {
+	mu         sync.Mutex
+	sessions   map[string]*pooledSession
+	connecting map[string]*connectCall
+}
+
+// newSessionPool 创建会话连接池
+func newSessionPool() *sessionPool {
+	return &sessionPool{
+		sessions:   make(map[string]*pooledSession),
+		connecting: make(map[string]*connectCall),
+	}
+}
+
+// get 获取服务的会话，不存在或配置已变更时重新连接
+// 返回的会话使用完毕后必须调用 release 归还
+func (p *sessionPool) get(ctx context.Context, svc *model.MCPService) (*pooledSession, error) {
+	for {
+		p.mu.Lock()
+		var stale *pooledSession
+		if ps, ok := p.sessions[svc.ID]; ok {
+			// 持有旧配置的调用方也复用较新的会话
+			if !ps.updatedAt.Before(svc.UpdatedAt) {
+				ps.refs++
+				p.mu.Unlock()
+				return ps, nil
+			}
+			// 配置已变更，旧会话在使用结束后关闭
+			if p.evictLocked(svc.ID, ps) {
+				stale = ps
+			}
+		}
+
+		call, ok := p.connecting[svc.ID]
+		if !ok {
+			call = &connectCall{done: make(chan struct{})}
+			p.connecting[svc.ID] = call
+			go p.connect(context.WithoutCancel(ctx), svc, call)
+		}
+		p.mu.Unlock()
+
+		if stale != nil {
+			_ = stale.session.Close()
+		}
+
+		select {
+		case <-call.done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		if call.err != nil {
+			return nil, call.err
+		}
+		// 连接已放入连接池，重新获取并增加引用
+	}
+}
+
+// connect 建立连接并放入连接池，完成后通知等待的调用方
+func (p *sessionPool) connect(ctx context.Context, svc *model.MCPService, call *connectCall) {
+	session, err := connect(ctx, svc)
+
+	p.mu.Lock()
+	if p.connecting[svc.ID] == call {
+		delete(p.connecting, svc.ID)
+	}
+	call.err = err
+	evicted := call.evicted
+	if err == nil && !evicted {
+		ps := &pooledSession{
+			session:   session,
+			updatedAt: svc.UpdatedAt,
+		}
+		p.sessions[svc.ID] = ps
+
+		// 会话断开（服务端退出、网络中断）时自动移出连接池，下次使用时重连
+		go func() {
+			if err := session.Wait(); err != nil {
+				log.Printf("MCP session for %s closed: %v", svc.Name, err)
+			}
+			p.remove(svc.ID, ps)
+		}()
+	}
+	p.mu.Unlock()
+	close(call.done)
+
+	if err == nil && evicted {
+		_ = session.Close()
+	}
+}
+
+// release 归还会话，已移出连接池的会话在最后一个调用归还后关闭
+func (p *sessionPool) release(ps *pooledSession) {
+	p.mu.Lock()
+	ps.refs--
+	closeNow := ps.evicted && ps.refs == 0
+	p.mu.Unlock()
+
+	if closeNow {
+		_ = ps.session.Close()
+	}
+}
+
+// evictLocked 将会话移出连接池并标记，返回是否已无调用在使用、可立即关闭
+// 调用方需持有 p.mu
+func (p *sessionPool) evictLocked(serviceID string, ps *pooledSession) bool {
+	if p.sessions[serviceID] == ps {
+		delete(p.sessions, serviceID)
+	}
+	if ps.evicted {
+		return false
+	}
+	ps.evicted = true
+	return ps.refs == 0
+}
+
+// remove 移除已断开的会话（仅当池中仍是该会话时）
+func (p *sessionPool) remove(serviceID string, ps *pooledSession) {
+	p.mu.Lock()
+	closeNow := p.evictLocked(serviceID, ps)
+	p.mu.Unlock()
+
+	if closeNow {
+		_ = ps.session.Close()
+	}
+}
+
+// evict 移除服务的会话，正在使用的会话在调用结束后关闭
+func (p *sessionPool) evict(serviceID string) {
+	p.mu.Lock()
+	if call, ok := p.connecting[serviceID]; ok {
+		call.evicted = true
+		delete(p.connecting, serviceID)
+	}
+	ps, ok := p.sessions[serviceID]
+	closeNow := ok && p.evictLocked(serviceID, ps)
+	p.mu.Unlock()
+
+	if closeNow {
+		_ = ps.session.Close()
+	}
+}
+
+// closeAll 移除所有会话，正在使用的会话在调用结束后关闭
+func (p *sessionPool) closeAll() {
+	p.mu.Lock()
+	var idle []*pooledSession
+	for id, ps := range p.sessions {
+		if p.evictLocked(id, ps) {
+			idle = append(idle, ps)
+		}
+	}
+	for id, call := range p.connecting {
+		call.evicted = true
+		delete(p.connecting, id)
+	}
+	p.mu.Unlock()
+
+	for _, ps := range idle {
+		_ = ps.session.Close()
+	}
+}
+
+// poolCaller 通过连接池调用工具，每次调用获取当前会话并在结束后归还
+// 服务重连或配置变更后，已创建的工具自动使用新会话
+type poolCaller struct {
+	pool *sessionPool
+	svc  *model.MCPService
+}
+
+// CallTool 调用 MCP 工具，单次调用受服务 Timeout 限制
+func (c *poolCaller) CallTool(ctx context.Context, params *mcpsdk.CallToolParams) (*mcpsdk.CallToolResult, error) {
+	ps, err := c.pool.get(ctx, c.svc)
+	if err != nil {
+		return nil, err
+	}
+	defer c.pool.release(ps)
+
+	ctx, cancel := withTimeout(ctx, c.svc)
+	defer cancel()
+	return ps.session.CallTool(ctx, params)
+}
@@ -0,0 +1,66 @@
+package mcp
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestSessionPoolSharesConnectionAndDefersClose(t *testing.T) {
+	ctx := testContext(t)
+	svc := fixtureService(t)
+	pool := newSessionPool()
+	defer pool.closeAll()
+
+	// 并发获取只建立一次连接
+	const users = 5
+	got := make([]*pooledSession, users)
+	var wg sync.WaitGroup
+	for i := range got {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			ps, err := pool.get(ctx, svc)
+			if err != nil {
+				t.Errorf("get: %v", err)
+				return
+			}
+			got[i] = ps
+		}(i)
+	}
+	wg.Wait()
+	if t.Failed() {
+		t.FailNow()
+	}
+	ps := got[0]
+	for _, other := range got[1:] {
+		if other != ps {
+			t.Fatal("concurrent gets returned different sessions")
+		}
+	}
+	if ps.refs != users {
+		t.Fatalf("refs = %d, want %d", ps.refs, users)
+	}
+
+	// 移除后仍在使用的会话保持可用，最后一个调用归还后关闭
+	pool.evict(svc.ID)
+	for i := 0; i < users-1; i++ {
+		pool.release(ps)
+	}
+	if _, err := ps.session.ListTools(ctx, nil); err != nil {
+		t.Fatalf("evicted session closed while still in use: %v", err)
+	}
+	pool.release(ps)
+	if _, err := ps.session.ListTools(ctx, nil); err == nil {
+		t.Fatal("evicted session still open after the last release")
+	}
+
+	// 再次获取时重新连接
+	fresh, err := pool.get(ctx, svc)
+	if err != nil {
+		t.Fatalf("get after evict: %v", err)
+	}
+	defer pool.release(fresh)
+	if fresh == ps {
+		t.Fatal("get after evict returned the evicted session")
+	}
+}
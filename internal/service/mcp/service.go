@@ -1,37 +1,51 @@
 // Package mcp 提供 MCP 服务管理
-// 参考: github.com/cloudwego/eino-ext/components/tool/mcp/officialmcp
 package mcp
 
 import (
 	"context"
 	"fmt"
+	"slices"
+	"strings"
 
 	"github.com/ashwinyue/next-ai/internal/model"
 	"github.com/ashwinyue/next-ai/internal/repository"
+	"github.com/cloudwego/eino/components/tool"
 )
 
+// ToolRefPrefix Agent.Tools 中引用 MCP 工具的前缀，格式: mcp:<service>/<tool>
+// <service> 可以是服务名称或 ID，<tool> 为 * 时引用该服务的全部工具
+const ToolRefPrefix = "mcp:"
+
 // Service MCP 服务管理
 type Service struct {
 	repo *repository.Repositories
+	pool *sessionPool
 }
 
 // NewService 创建 MCP 服务
 func NewService(repo *repository.Repositories) *Service {
 	return &Service{
 		repo: repo,
+		pool: newSessionPool(),
 	}
 }
 
+// Close 关闭连接池中的所有会话
+func (s *Service) Close() {
+	s.pool.closeAll()
+}
+
 // CreateMCPServiceRequest 创建 MCP 服务请求
 type CreateMCPServiceRequest struct {
-	Name          string                 `json:"name" binding:"required"`
-	Description   string                 `json:"description"`
-	TransportType model.MCPTransportType `json:"transport_type" binding:"required"`
-	URL           *string                `json:"url,omitempty"`
-	Headers       model.MCPHeaders       `json:"headers"`
-	AuthConfig    *model.MCPAuthConfig   `json:"auth_config"`
-	StdioConfig   *model.MCPStdioConfig  `json:"stdio_config,omitempty"`
-	EnvVars       model.MCPEnvVars       `json:"env_vars"`
+	Name           string                   `json:"name" binding:"required"`
+	Description    string                   `json:"description"`
+	TransportType  model.MCPTransportType   `json:"transport_type" binding:"required"`
+	URL            *string                  `json:"url,omitempty"`
+	Headers        model.MCPHeaders         `json:"headers"`
+	AuthConfig     *model.MCPAuthConfig     `json:"auth_config"`
+	StdioConfig    *model.MCPStdioConfig    `json:"stdio_config,omitempty"`
+	EnvVars        model.MCPEnvVars         `json:"env_vars"`
+	AdvancedConfig *model.MCPAdvancedConfig `json:"advanced_config,omitempty"`
 }
 
 // CreateMCPService 创建 MCP 服务
@@ -41,12 +55,15 @@ func (s *Service) CreateMCPService(ctx context.Context, req *CreateMCPServiceReq
 		Description:    req.Description,
 		Enabled:        true,
 		TransportType:  req.TransportType,
-		URL:             req.URL,
+		URL:            req.URL,
 		Headers:        req.Headers,
 		AuthConfig:     req.AuthConfig,
 		StdioConfig:    req.StdioConfig,
 		EnvVars:        req.EnvVars,
-		AdvancedConfig: model.GetDefaultAdvancedConfig(),
+		AdvancedConfig: req.AdvancedConfig,
+	}
+	if svc.AdvancedConfig == nil {
+		svc.AdvancedConfig = model.GetDefaultAdvancedConfig()
 	}
 
 	if err := s.repo.MCP.Create(svc); err != nil {
@@ -76,15 +93,16 @@ func (s *Service) GetMCPService(ctx context.Context, id string) (*model.MCPServi
 
 // UpdateMCPServiceRequest 更新 MCP 服务请求
 type UpdateMCPServiceRequest struct {
-	Name          *string                 `json:"name,omitempty"`
-	Description   *string                 `json:"description,omitempty"`
-	Enabled       *bool                   `json:"enabled,omitempty"`
-	TransportType *model.MCPTransportType `json:"transport_type,omitempty"`
-	URL           *string                 `json:"url,omitempty"`
-	Headers       model.MCPHeaders        `json:"headers,omitempty"`
-	AuthConfig    *model.MCPAuthConfig    `json:"auth_config,omitempty"`
-	StdioConfig   *model.MCPStdioConfig   `json:"stdio_config,omitempty"`
-	EnvVars       model.MCPEnvVars        `json:"env_vars,omitempty"`
+	Name           *string                  `json:"name,omitempty"`
+	Description    *string                  `json:"description,omitempty"`
+	Enabled        *bool                    `json:"enabled,omitempty"`
+	TransportType  *model.MCPTransportType  `json:"transport_type,omitempty"`
+	URL            *string                  `json:"url,omitempty"`
+	Headers        model.MCPHeaders         `json:"headers,omitempty"`
+	AuthConfig     *model.MCPAuthConfig     `json:"auth_config,omitempty"`
+	StdioConfig    *model.MCPStdioConfig    `json:"stdio_config,omitempty"`
+	EnvVars        model.MCPEnvVars         `json:"env_vars,omitempty"`
+	AdvancedConfig *model.MCPAdvancedConfig `json:"advanced_config,omitempty"`
 }
 
 // UpdateMCPService 更新 MCP 服务
@@ -122,10 +140,14 @@ func (s *Service) UpdateMCPService(ctx context.Context, id string, req *UpdateMC
 	if len(req.EnvVars) > 0 {
 		svc.EnvVars = req.EnvVars
 	}
+	if req.AdvancedConfig != nil {
+		svc.AdvancedConfig = req.AdvancedConfig
+	}
 
 	if err := s.repo.MCP.Update(svc); err != nil {
 		return nil, fmt.Errorf("failed to update MCP service: %w", err)
 	}
+	s.pool.evict(svc.ID)
 
 	return svc, nil
 }
@@ -135,11 +157,12 @@ func (s *Service) DeleteMCPService(ctx context.Context, id string) error {
 	if err := s.repo.MCP.Delete(id); err != nil {
 		return fmt.Errorf("failed to delete MCP service: %w", err)
 	}
+	s.pool.evict(id)
 	return nil
 }
 
 // TestMCPService 测试 MCP 服务连接
-// 注意: 完整实现需要使用 github.com/modelcontextprotocol/go-sdk/mcp
+// 建立真实的客户端会话，完成握手后返回服务端提供的工具和资源
 func (s *Service) TestMCPService(ctx context.Context, id string) (*model.MCPTestResult, error) {
 	svc, err := s.repo.MCP.GetByID(id)
 	if err != nil {
@@ -148,46 +171,58 @@ func (s *Service) TestMCPService(ctx context.Context, id string) (*model.MCPTest
 			Message: "MCP service not found",
 		}, nil
 	}
+	return testConnection(ctx, svc), nil
+}
 
-	// 简化版: 检查服务配置是否完整
-	// SSE 和 HTTP Streamable 都需要 URL
-	if (svc.TransportType == model.MCPTransportSSE || svc.TransportType == model.MCPTransportHTTPStreamable) && svc.URL == nil {
+// testConnection 连接服务并列出工具和资源，失败原因记录在结果中
+func testConnection(ctx context.Context, svc *model.MCPService) *model.MCPTestResult {
+	session, err := connect(ctx, svc)
+	if err != nil {
 		return &model.MCPTestResult{
 			Success: false,
-			Message: "SSE/HTTP transport requires URL",
-		}, nil
+			Message: err.Error(),
+		}
 	}
+	defer session.Close()
 
-	if svc.TransportType == model.MCPTransportStdio && svc.StdioConfig == nil {
+	tools, err := listTools(ctx, svc, session)
+	if err != nil {
 		return &model.MCPTestResult{
 			Success: false,
-			Message: "Stdio transport requires command",
-		}, nil
+			Message: err.Error(),
+		}
+	}
+
+	resources, err := listResources(ctx, svc, session)
+	if err != nil {
+		return &model.MCPTestResult{
+			Success: false,
+			Message: err.Error(),
+		}
 	}
 
-	// 实际连接测试需要集成 go-sdk 的 mcp.ClientSession
 	return &model.MCPTestResult{
-		Success: true,
-		Message: "Configuration is valid (actual connection test requires go-sdk integration)",
-	}, nil
+		Success:   true,
+		Message:   fmt.Sprintf("Connected successfully, %d tools and %d resources available", len(tools), len(resources)),
+		Tools:     tools,
+		Resources: resources,
+	}
 }
 
 // GetMCPServiceTools 获取 MCP 服务提供的工具列表
-// 注意: 完整实现需要使用 eino-ext/components/tool/mcp/officialmcp.GetTools
 func (s *Service) GetMCPServiceTools(ctx context.Context, id string) ([]*model.MCPTool, error) {
 	svc, err := s.repo.MCP.GetByID(id)
 	if err != nil {
 		return nil, fmt.Errorf("MCP service not found: %w", err)
 	}
 
-	// 简化版: 返回空工具列表
-	// 实际实现需要:
-	// 1. 创建 mcp.ClientSession (使用 go-sdk)
-	// 2. 调用 cli.ListTools(ctx)
-	// 3. 转换为 model.MCPTool 列表
-	_ = svc
+	session, err := connect(ctx, svc)
+	if err != nil {
+		return nil, err
+	}
+	defer session.Close()
 
-	return []*model.MCPTool{}, nil
+	return listTools(ctx, svc, session)
 }
 
 // GetMCPServiceResources 获取 MCP 服务提供的资源列表
@@ -196,29 +231,142 @@ func (s *Service) GetMCPServiceResources(ctx context.Context, id string) ([]*mod
 	if err != nil {
 		return nil, fmt.Errorf("MCP service not found: %w", err)
 	}
-	_ = svc
 
-	// 实际实现需要使用 cli.ListResources(ctx)
-	return []*model.MCPResource{}, nil
+	session, err := connect(ctx, svc)
+	if err != nil {
+		return nil, err
+	}
+	defer session.Close()
+
+	return listResources(ctx, svc, session)
 }
 
 // ConvertToEinoTools 将 MCP 服务转换为 Eino 工具列表
-// 参考: github.com/cloudwego/eino-ext/components/tool/mcp/officialmcp.GetTools
-func (s *Service) ConvertToEinoTools(ctx context.Context, serviceID string) ([]interface{}, error) {
+// 工具共享连接池中的会话，toolNames 为空时返回全部工具
+func (s *Service) ConvertToEinoTools(ctx context.Context, serviceID string, toolNames ...string) ([]tool.BaseTool, error) {
 	svc, err := s.repo.MCP.GetByID(serviceID)
 	if err != nil {
 		return nil, fmt.Errorf("MCP service not found: %w", err)
 	}
+	return s.getEinoTools(ctx, svc, toolNames)
+}
+
+// getEinoTools 从连接池会话获取 Eino 工具，工具每次调用时从连接池获取会话
+func (s *Service) getEinoTools(ctx context.Context, svc *model.MCPService, toolNames []string) ([]tool.BaseTool, error) {
+	ps, err := s.pool.get(ctx, svc)
+	if err != nil {
+		return nil, err
+	}
+	defer s.pool.release(ps)
 
-	// 简化版: 返回空工具列表
-	// 实际实现:
-	// import mcptool "github.com/cloudwego/eino-ext/components/tool/mcp/officialmcp"
-	// tools, err := mcptool.GetTools(ctx, &mcptool.Config{
-	//     Cli: mcpClient,
-	// })
-	_ = svc
+	tools, err := getTools(ctx, ps.session, &poolCaller{pool: s.pool, svc: svc}, toolNames)
+	if err != nil {
+		// 会话可能已失效，移出连接池以便下次重连
+		s.pool.evict(svc.ID)
+		return nil, fmt.Errorf("failed to get eino tools from MCP service %s: %w", svc.Name, err)
+	}
+
+	return tools, nil
+}
 
-	return []interface{}{}, nil
+// IsToolRef 判断工具名是否为 MCP 工具引用
+func IsToolRef(name string) bool {
+	return strings.HasPrefix(name, ToolRefPrefix)
+}
+
+// ParseToolRef 解析 mcp:<service>/<tool> 引用
+func ParseToolRef(ref string) (service, toolName string, err error) {
+	body := strings.TrimPrefix(ref, ToolRefPrefix)
+	idx := strings.LastIndex(body, "/")
+	if idx <= 0 || idx == len(body)-1 {
+		return "", "", fmt.Errorf("invalid MCP tool reference: %s, expected mcp:<service>/<tool>", ref)
+	}
+	return body[:idx], body[idx+1:], nil
+}
+
+// ResolveTools 将 Agent.Tools 中的 MCP 工具引用解析为 Eino 工具
+// 只解析已启用的服务，每个服务复用连接池中的会话
+func (s *Service) ResolveTools(ctx context.Context, refs []string) ([]tool.BaseTool, error) {
+	if len(refs) == 0 {
+		return nil, nil
+	}
+
+	enabled, err := s.repo.MCP.ListEnabled()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list enabled MCP services: %w", err)
+	}
+
+	byKey := make(map[string]*model.MCPService, len(enabled)*2)
+	for _, svc := range enabled {
+		byKey[svc.ID] = svc
+		byKey[svc.Name] = svc
+	}
+
+	// 按服务分组，保持引用顺序
+	var order []*model.MCPService
+	wanted := make(map[string][]string)
+	all := make(map[string]bool)
+	for _, ref := range refs {
+		serviceKey, toolName, err := ParseToolRef(ref)
+		if err != nil {
+			return nil, err
+		}
+		svc, ok := byKey[serviceKey]
+		if !ok {
+			return nil, fmt.Errorf("MCP service not found or disabled: %s", serviceKey)
+		}
+		if _, seen := wanted[svc.ID]; !seen && !all[svc.ID] {
+			order = append(order, svc)
+		}
+		if toolName == "*" {
+			all[svc.ID] = true
+			wanted[svc.ID] = nil
+			continue
+		}
+		if !all[svc.ID] && !slices.Contains(wanted[svc.ID], toolName) {
+			wanted[svc.ID] = append(wanted[svc.ID], toolName)
+		}
+	}
+
+	result := make([]tool.BaseTool, 0, len(refs))
+	for _, svc := range order {
+		tools, err := s.getEinoTools(ctx, svc, wanted[svc.ID])
+		if err != nil {
+			return nil, err
+		}
+		if !all[svc.ID] {
+			missing, err := missingTools(ctx, tools, wanted[svc.ID])
+			if err != nil {
+				return nil, err
+			}
+			if len(missing) > 0 {
+				return nil, fmt.Errorf("tools not found in MCP service %s: %s", svc.Name, strings.Join(missing, ", "))
+			}
+		}
+		result = append(result, tools...)
+	}
+
+	return result, nil
+}
+
+// missingTools 返回 wanted 中未出现在 tools 里的工具名
+func missingTools(ctx context.Context, tools []tool.BaseTool, wanted []string) ([]string, error) {
+	found := make(map[string]bool, len(tools))
+	for _, t := range tools {
+		info, err := t.Info(ctx)
+		if err != nil {
+			return nil, err
+		}
+		found[info.Name] = true
+	}
+
+	var missing []string
+	for _, name := range wanted {
+		if !found[name] {
+			missing = append(missing, name)
+		}
+	}
+	return missing, nil
 }
 
 // EnableMCPService 启用 MCP 服务
@@ -234,5 +382,6 @@ func (s *Service) DisableMCPService(ctx context.Context, id string) error {
 	if err := s.repo.MCP.UpdateEnabled(id, false); err != nil {
 		return fmt.Errorf("failed to disable MCP service: %w", err)
 	}
+	s.pool.evict(id)
 	return nil
 }
@@ -0,0 +1,107 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/cloudwego/eino/components/tool"
+	"github.com/cloudwego/eino/schema"
+	"github.com/eino-contrib/jsonschema"
+	mcpsdk "github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// toolCaller 调用 MCP 工具，*mcpsdk.ClientSession 和 poolCaller 均实现该接口
+type toolCaller interface {
+	CallTool(ctx context.Context, params *mcpsdk.CallToolParams) (*mcpsdk.CallToolResult, error)
+}
+
+// einoTool 将 MCP 工具适配为 Eino 可调用工具，调用通过 caller 转发给服务端
+type einoTool struct {
+	caller toolCaller
+	info   *schema.ToolInfo
+}
+
+// Info 返回工具描述
+func (t *einoTool) Info(ctx context.Context) (*schema.ToolInfo, error) {
+	return t.info, nil
+}
+
+// InvokableRun 调用 MCP 工具，返回 JSON 序列化的调用结果
+func (t *einoTool) InvokableRun(ctx context.Context, argumentsInJSON string, opts ...tool.Option) (string, error) {
+	var args map[string]any
+	if argumentsInJSON != "" {
+		if err := json.Unmarshal([]byte(argumentsInJSON), &args); err != nil {
+			return "", fmt.Errorf("failed to parse arguments of MCP tool %s: %w", t.info.Name, err)
+		}
+	}
+
+	result, err := t.caller.CallTool(ctx, &mcpsdk.CallToolParams{
+		Name:      t.info.Name,
+		Arguments: args,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to call MCP tool %s: %w", t.info.Name, err)
+	}
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal result of MCP tool %s: %w", t.info.Name, err)
+	}
+	if result.IsError {
+		return "", fmt.Errorf("MCP tool %s returned error: %s", t.info.Name, data)
+	}
+	return string(data), nil
+}
+
+// getTools 列出会话中的工具并转换为 Eino 工具，工具调用经由 caller 转发
+// toolNames 为空时返回全部工具
+func getTools(ctx context.Context, session *mcpsdk.ClientSession, caller toolCaller, toolNames []string) ([]tool.BaseTool, error) {
+	wanted := make(map[string]bool, len(toolNames))
+	for _, name := range toolNames {
+		wanted[name] = true
+	}
+
+	var tools []tool.BaseTool
+	params := &mcpsdk.ListToolsParams{}
+	for {
+		res, err := session.ListTools(ctx, params)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list tools: %w", err)
+		}
+
+		for _, t := range res.Tools {
+			if len(wanted) > 0 && !wanted[t.Name] {
+				continue
+			}
+			info, err := toolInfo(t)
+			if err != nil {
+				return nil, err
+			}
+			tools = append(tools, &einoTool{caller: caller, info: info})
+		}
+
+		if res.NextCursor == "" {
+			return tools, nil
+		}
+		params.Cursor = res.NextCursor
+	}
+}
+
+// toolInfo 将 MCP 工具定义转换为 Eino 工具描述
+func toolInfo(t *mcpsdk.Tool) (*schema.ToolInfo, error) {
+	data, err := json.Marshal(t.InputSchema)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal input schema of %s: %w", t.Name, err)
+	}
+	var inputSchema jsonschema.Schema
+	if err := json.Unmarshal(data, &inputSchema); err != nil {
+		return nil, fmt.Errorf("failed to parse input schema of %s: %w", t.Name, err)
+	}
+
+	return &schema.ToolInfo{
+		Name:        t.Name,
+		Desc:        t.Description,
+		ParamsOneOf: schema.NewParamsOneOfByJSONSchema(&inputSchema),
+	}, nil
+}
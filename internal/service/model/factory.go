@@ -0,0 +1,179 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/ashwinyue/next-ai/internal/config"
+	"github.com/ashwinyue/next-ai/internal/model"
+	"github.com/cloudwego/eino-ext/components/model/ollama"
+	"github.com/cloudwego/eino-ext/components/model/openai"
+	ecomodel "github.com/cloudwego/eino/components/model"
+	"gorm.io/gorm"
+)
+
+// 接口类型（ModelParameters.InterfaceType）
+const (
+	InterfaceTypeOpenAI = "openai" // OpenAI 兼容接口（默认）
+	InterfaceTypeOllama = "ollama" // Ollama 原生接口
+)
+
+// defaultOllamaBaseURL 未配置 OLLAMA_BASE_URL 时的 Ollama 地址
+const defaultOllamaBaseURL = "http://localhost:11434"
+
+// defaultModelName 未指定模型名称时使用的模型
+const defaultModelName = "gpt-4o-mini"
+
+// ErrNoDefaultChatModel models 表中没有默认对话模型
+var ErrNoDefaultChatModel = errors.New("no default chat model")
+
+// defaultBaseURLs 各模型来源的 OpenAI 兼容接口地址（未配置 BaseURL 时使用）
+var defaultBaseURLs = map[model.ModelSource]string{
+	model.ModelSourceAliyun:      "https://dashscope.aliyuncs.com/compatible-mode/v1",
+	model.ModelSourceDeepseek:    "https://api.deepseek.com/v1",
+	model.ModelSourceZhipu:       "https://open.bigmodel.cn/api/paas/v4",
+	model.ModelSourceVolcengine:  "https://ark.cn-beijing.volces.com/api/v3",
+	model.ModelSourceHunyuan:     "https://api.hunyuan.cloud.tencent.com/v1",
+	model.ModelSourceMinimax:     "https://api.minimax.chat/v1",
+	model.ModelSourceGemini:      "https://generativelanguage.googleapis.com/v1beta/openai",
+	model.ModelSourceSiliconFlow: "https://api.siliconflow.cn/v1",
+	model.ModelSourceOpenRouter:  "https://openrouter.ai/api/v1",
+}
+
+// defaultInterfaceTypes 各模型来源的默认接口类型（未配置 InterfaceType 时使用，缺省为 OpenAI 兼容接口）
+var defaultInterfaceTypes = map[model.ModelSource]string{
+	model.ModelSourceLocal: InterfaceTypeOllama,
+}
+
+// ChatModelConfig 创建 ChatModel 所需的连接参数
+type ChatModelConfig struct {
+	InterfaceType string
+	BaseURL       string
+	APIKey        string
+	Model         string
+	Temperature   *float32
+}
+
+// NewChatModel 根据连接参数创建支持工具调用的 ChatModel
+func NewChatModel(ctx context.Context, cfg *ChatModelConfig) (ecomodel.ToolCallingChatModel, error) {
+	modelName := cfg.Model
+	if modelName == "" {
+		modelName = defaultModelName
+	}
+
+	switch cfg.InterfaceType {
+	case "", InterfaceTypeOpenAI:
+		return openai.NewChatModel(ctx, &openai.ChatModelConfig{
+			APIKey:      cfg.APIKey,
+			BaseURL:     cfg.BaseURL,
+			Model:       modelName,
+			Temperature: cfg.Temperature,
+		})
+	case InterfaceTypeOllama:
+		ollamaCfg := &ollama.ChatModelConfig{
+			BaseURL: ollamaBaseURL(cfg.BaseURL),
+			Model:   modelName,
+		}
+		if cfg.Temperature != nil {
+			ollamaCfg.Options = &ollama.Options{Temperature: *cfg.Temperature}
+		}
+		return ollama.NewChatModel(ctx, ollamaCfg)
+	default:
+		return nil, fmt.Errorf("unsupported interface type: %s", cfg.InterfaceType)
+	}
+}
+
+// ChatModelConfigFromModel 从 models 表中的对话模型构建连接参数
+func ChatModelConfigFromModel(m *model.Model) (*ChatModelConfig, error) {
+	if m.Type != model.ModelTypeChatModel {
+		return nil, fmt.Errorf("model %s is not a chat model", m.Name)
+	}
+
+	interfaceType := m.Parameters.InterfaceType
+	if interfaceType == "" {
+		interfaceType = defaultInterfaceTypes[m.Source]
+	}
+
+	baseURL := m.Parameters.BaseURL
+	if baseURL == "" {
+		baseURL = defaultBaseURLs[m.Source]
+	}
+	if m.Parameters.APIKey == "" && interfaceType != InterfaceTypeOllama && m.Source != model.ModelSourceLocal {
+		return nil, fmt.Errorf("api_key is required for model %s", m.Name)
+	}
+
+	return &ChatModelConfig{
+		InterfaceType: interfaceType,
+		BaseURL:       baseURL,
+		APIKey:        m.Parameters.APIKey,
+		Model:         m.Name,
+	}, nil
+}
+
+// ChatModelConfigFromAIConfig 从全局 AI 配置构建连接参数（models 表未配置默认对话模型时的回退）
+func ChatModelConfigFromAIConfig(aiCfg config.AIConfig) (*ChatModelConfig, error) {
+	cfg := &ChatModelConfig{InterfaceType: InterfaceTypeOpenAI}
+
+	switch aiCfg.Provider {
+	case "openai":
+		cfg.APIKey = aiCfg.OpenAI.APIKey
+		cfg.BaseURL = aiCfg.OpenAI.BaseURL
+		cfg.Model = aiCfg.OpenAI.Model
+	case "alibaba", "qwen", "dashscope":
+		cfg.APIKey = aiCfg.Alibaba.AccessKeySecret
+		cfg.BaseURL = defaultBaseURLs[model.ModelSourceAliyun]
+		cfg.Model = aiCfg.Alibaba.Model
+	case "deepseek":
+		cfg.APIKey = aiCfg.DeepSeek.APIKey
+		cfg.BaseURL = aiCfg.DeepSeek.BaseURL
+		cfg.Model = aiCfg.DeepSeek.Model
+	default:
+		return nil, fmt.Errorf("unsupported ai provider: %s", aiCfg.Provider)
+	}
+
+	if cfg.APIKey == "" {
+		return nil, fmt.Errorf("api_key is required for provider: %s", aiCfg.Provider)
+	}
+	return cfg, nil
+}
+
+// ChatModelConfigFor 解析对话模型的连接参数
+// modelID 非空时使用指定模型，否则使用默认对话模型；没有默认模型时返回 ErrNoDefaultChatModel
+func (s *Service) ChatModelConfigFor(ctx context.Context, modelID string) (*ChatModelConfig, error) {
+	var m *model.Model
+	var err error
+	if modelID != "" {
+		m, err = s.repo.GetByID(ctx, modelID)
+		if err != nil {
+			return nil, fmt.Errorf("model %s not found: %w", modelID, err)
+		}
+	} else {
+		m, err = s.repo.GetDefaultByType(ctx, model.ModelTypeChatModel)
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, ErrNoDefaultChatModel
+			}
+			return nil, err
+		}
+	}
+
+	if m.Status != "" && m.Status != model.ModelStatusActive {
+		return nil, fmt.Errorf("model %s is not active: %s", m.Name, m.Status)
+	}
+	return ChatModelConfigFromModel(m)
+}
+
+// ollamaBaseURL Ollama 原生接口地址
+// 未配置时使用 OLLAMA_BASE_URL（与初始化服务一致），并去掉 OpenAI 兼容路径 /v1
+func ollamaBaseURL(baseURL string) string {
+	if baseURL == "" {
+		baseURL = os.Getenv("OLLAMA_BASE_URL")
+	}
+	if baseURL == "" {
+		baseURL = defaultOllamaBaseURL
+	}
+	return strings.TrimSuffix(strings.TrimSuffix(baseURL, "/"), "/v1")
+}
@@ -5,6 +5,7 @@ import (
 
 	"github.com/ashwinyue/next-ai/internal/service/agent"
 	"github.com/ashwinyue/next-ai/internal/service/chat"
+	svctypes "github.com/ashwinyue/next-ai/internal/service/types"
 )
 
 // ========== Provider 适配器（用于 Agent 服务依赖注入）==========
@@ -14,11 +15,15 @@ type agentServiceAdapter struct {
 	agentSvc *agent.Service
 }
 
-func (a *agentServiceAdapter) StreamWithContext(ctx context.Context, agentID string, req interface{}) (<-chan interface{}, error) {
+func (a *agentServiceAdapter) StreamWithContext(ctx context.Context, agentID string, req interface{}) (<-chan svctypes.StreamEvent, error) {
 	// 直接调用 agent 服务的适配方法
 	return a.agentSvc.StreamWithContextForChat(ctx, agentID, req)
 }
 
+func (a *agentServiceAdapter) ReleaseSession(ctx context.Context, sessionID string) {
+	a.agentSvc.ReleaseSession(ctx, sessionID)
+}
+
 // ========== 适配器创建 ==========
 
 // newAgentServiceAdapter 创建 Agent 服务适配器
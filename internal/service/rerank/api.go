@@ -0,0 +1,154 @@
+package rerank
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ashwinyue/next-ai/internal/model"
+	"github.com/cloudwego/eino/schema"
+)
+
+// dashscopeRerankURL DashScope 原生 Rerank 接口（未配置 BaseURL 的阿里云模型使用）
+const dashscopeRerankURL = "https://dashscope.aliyuncs.com/api/v1/services/rerank/text-rerank/text-rerank"
+
+// APIReranker 调用远程 Rerank 模型
+// 默认使用 Cohere/Jina/SiliconFlow 通用格式（POST {base_url}/rerank），阿里云模型使用 DashScope 原生格式
+type APIReranker struct {
+	endpoint  string
+	apiKey    string
+	modelName string
+	dashscope bool
+	opts      Options
+	client    *http.Client
+}
+
+// NewAPIReranker 根据 Rerank 类型的 Model 创建重排器
+func NewAPIReranker(m *model.Model, opts Options) (*APIReranker, error) {
+	if m.Type != model.ModelTypeRerank {
+		return nil, fmt.Errorf("model %s is not a rerank model", m.Name)
+	}
+
+	baseURL := strings.TrimSuffix(m.Parameters.BaseURL, "/")
+	r := &APIReranker{
+		apiKey:    m.Parameters.APIKey,
+		modelName: m.Name,
+		opts:      opts,
+		client:    &http.Client{Timeout: 30 * time.Second},
+	}
+
+	switch {
+	case baseURL == "" && m.Source == model.ModelSourceAliyun:
+		r.endpoint = dashscopeRerankURL
+		r.dashscope = true
+	case baseURL == "":
+		return nil, fmt.Errorf("base_url is required for rerank model %s", m.Name)
+	case strings.HasSuffix(baseURL, "/rerank"):
+		r.endpoint = baseURL
+	default:
+		r.endpoint = baseURL + "/rerank"
+	}
+
+	return r, nil
+}
+
+// rerankResponse 兼容通用格式（results）和 DashScope 格式（output.results）
+type rerankResponse struct {
+	Results []rerankResult `json:"results"`
+	Output  struct {
+		Results []rerankResult `json:"results"`
+	} `json:"output"`
+}
+
+type rerankResult struct {
+	Index          int     `json:"index"`
+	RelevanceScore float64 `json:"relevance_score"`
+}
+
+// Rerank 实现 types.Reranker
+func (r *APIReranker) Rerank(ctx context.Context, query string, docs []*schema.Document) ([]*schema.Document, error) {
+	if len(docs) == 0 {
+		return docs, nil
+	}
+
+	documents := make([]string, len(docs))
+	for i, d := range docs {
+		documents[i] = d.Content
+	}
+
+	var payload map[string]any
+	if r.dashscope {
+		payload = map[string]any{
+			"model": r.modelName,
+			"input": map[string]any{
+				"query":     query,
+				"documents": documents,
+			},
+			"parameters": map[string]any{
+				"top_n":            len(documents),
+				"return_documents": false,
+			},
+		}
+	} else {
+		payload = map[string]any{
+			"model":            r.modelName,
+			"query":            query,
+			"documents":        documents,
+			"top_n":            len(documents),
+			"return_documents": false,
+		}
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal rerank request: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, r.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create rerank request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	if r.apiKey != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+r.apiKey)
+	}
+
+	resp, err := r.client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("rerank request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rerank response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("rerank request failed with status %d: %s", resp.StatusCode, string(respBody))
+	}
+
+	var parsed rerankResponse
+	if err := json.Unmarshal(respBody, &parsed); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal rerank response: %w", err)
+	}
+
+	results := parsed.Results
+	if len(results) == 0 {
+		results = parsed.Output.Results
+	}
+
+	items := make([]scored, 0, len(results))
+	for _, res := range results {
+		if res.Index < 0 || res.Index >= len(docs) {
+			return nil, fmt.Errorf("rerank result index %d out of range", res.Index)
+		}
+		items = append(items, scored{doc: docs[res.Index], score: res.RelevanceScore})
+	}
+
+	return apply(items, r.opts), nil
+}
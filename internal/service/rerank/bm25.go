@@ -0,0 +1,93 @@
+package rerank
+
+import (
+	"context"
+	"math"
+
+	"github.com/ashwinyue/next-ai/internal/pkg/tokenizer"
+	"github.com/cloudwego/eino/schema"
+)
+
+// BM25 参数
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// BM25Reranker 本地词法重排器
+// 以候选文档集合为语料计算 BM25，无需外部服务；分数按最高分归一化到 [0,1]，
+// 因此 Threshold 表示相对最佳文档的比例
+type BM25Reranker struct {
+	opts Options
+}
+
+// NewBM25Reranker 创建 BM25 重排器
+func NewBM25Reranker(opts Options) *BM25Reranker {
+	return &BM25Reranker{opts: opts}
+}
+
+// Rerank 实现 types.Reranker
+func (r *BM25Reranker) Rerank(ctx context.Context, query string, docs []*schema.Document) ([]*schema.Document, error) {
+	if len(docs) == 0 {
+		return docs, nil
+	}
+
+	queryTerms := tokenizer.Tokenize(query)
+
+	// 统计词频、文档长度和文档频率
+	termFreqs := make([]map[string]int, len(docs))
+	docFreq := make(map[string]int)
+	var totalLen int
+	for i, d := range docs {
+		tf := make(map[string]int)
+		for _, t := range tokenizer.Tokenize(d.Content) {
+			tf[t]++
+		}
+		termFreqs[i] = tf
+		for t := range tf {
+			docFreq[t]++
+		}
+		for _, n := range tf {
+			totalLen += n
+		}
+	}
+
+	n := float64(len(docs))
+	avgLen := float64(totalLen) / n
+	if avgLen == 0 {
+		avgLen = 1
+	}
+
+	items := make([]scored, len(docs))
+	var maxScore float64
+	for i, d := range docs {
+		var docLen int
+		for _, c := range termFreqs[i] {
+			docLen += c
+		}
+
+		var score float64
+		for _, t := range queryTerms {
+			tf := float64(termFreqs[i][t])
+			if tf == 0 {
+				continue
+			}
+			df := float64(docFreq[t])
+			idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+			score += idf * tf * (bm25K1 + 1) / (tf + bm25K1*(1-bm25B+bm25B*float64(docLen)/avgLen))
+		}
+
+		items[i] = scored{doc: d, score: score}
+		if score > maxScore {
+			maxScore = score
+		}
+	}
+
+	if maxScore > 0 {
+		for i := range items {
+			items[i].score /= maxScore
+		}
+	}
+
+	return apply(items, r.opts), nil
+}
@@ -0,0 +1,68 @@
+// Package rerank 提供检索结果重排实现（types.Reranker）
+// APIReranker 调用远程 Rerank 模型，BM25Reranker 作为本地词法兜底
+package rerank
+
+import (
+	"context"
+	"log"
+	"sort"
+
+	"github.com/ashwinyue/next-ai/internal/service/types"
+	"github.com/cloudwego/eino/schema"
+)
+
+// Options 重排参数
+type Options struct {
+	TopK      int     // 保留前 K 条，<=0 表示不截断
+	Threshold float64 // 分数低于阈值的文档被丢弃，<=0 表示不过滤
+}
+
+// scored 带重排分数的文档
+type scored struct {
+	doc   *schema.Document
+	score float64
+}
+
+// apply 按分数排序、过滤并截断，分数写回 Document
+func apply(items []scored, opts Options) []*schema.Document {
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].score > items[j].score
+	})
+
+	result := make([]*schema.Document, 0, len(items))
+	for _, it := range items {
+		if opts.Threshold > 0 && it.score < opts.Threshold {
+			continue
+		}
+		result = append(result, it.doc.WithScore(it.score))
+		if opts.TopK > 0 && len(result) >= opts.TopK {
+			break
+		}
+	}
+	return result
+}
+
+// FallbackReranker 主重排器失败时使用兜底重排器
+type FallbackReranker struct {
+	primary  types.Reranker
+	fallback types.Reranker
+}
+
+// NewFallbackReranker 创建带兜底的重排器
+func NewFallbackReranker(primary, fallback types.Reranker) *FallbackReranker {
+	return &FallbackReranker{
+		primary:  primary,
+		fallback: fallback,
+	}
+}
+
+// Rerank 实现 types.Reranker
+func (r *FallbackReranker) Rerank(ctx context.Context, query string, docs []*schema.Document) ([]*schema.Document, error) {
+	result, err := r.primary.Rerank(ctx, query, docs)
+	if err == nil {
+		return result, nil
+	}
+
+	log.Printf("Warning: rerank failed, falling back to local reranker: %v", err)
+	return r.fallback.Rerank(ctx, query, docs)
+}
@@ -3,6 +3,7 @@ package service
 import (
 	"context"
 	"log"
+	"time"
 
 	"github.com/ashwinyue/next-ai/internal/config"
 	"github.com/ashwinyue/next-ai/internal/repository"
@@ -10,8 +11,10 @@ import (
 	"github.com/ashwinyue/next-ai/internal/service/auth"
 	"github.com/ashwinyue/next-ai/internal/service/callback"
 	"github.com/ashwinyue/next-ai/internal/service/chat"
+	"github.com/ashwinyue/next-ai/internal/service/faq"
 	"github.com/ashwinyue/next-ai/internal/service/file"
 	"github.com/ashwinyue/next-ai/internal/service/initialization"
+	"github.com/ashwinyue/next-ai/internal/service/knowledge"
 	svcmcp "github.com/ashwinyue/next-ai/internal/service/mcp"
 	svcModel "github.com/ashwinyue/next-ai/internal/service/model"
 	"github.com/ashwinyue/next-ai/internal/service/session"
@@ -19,6 +22,7 @@ import (
 	"github.com/ashwinyue/next-ai/internal/service/tool"
 	ecomodel "github.com/cloudwego/eino/components/model"
 	einotool "github.com/cloudwego/eino/components/tool"
+	"github.com/cloudwego/eino/compose"
 	"github.com/redis/go-redis/v9"
 )
 
@@ -34,6 +38,8 @@ type Services struct {
 	MCP            *svcmcp.Service         // MCP 服务管理
 	Tenant         *svctenant.Service      // 租户管理
 	File           *file.Service           // 文件存储服务
+	Knowledge      *knowledge.Service      // 知识库服务
+	FAQ            *faq.Service            // FAQ 服务
 
 	// 配置
 	Config     *config.Config
@@ -41,9 +47,12 @@ type Services struct {
 
 	// Eino 组件（直接使用 eino 类型，无封装）
 	AllTools  []einotool.BaseTool
-	ChatModel ecomodel.ChatModel // 用于查询处理的 ChatModel
+	ChatModel ecomodel.BaseChatModel // 用于查询处理的 ChatModel
 }
 
+// checkpointTTL Agent 检查点（工具审批中断）的保留时间
+const checkpointTTL = 24 * time.Hour
+
 // NewServices 创建所有服务
 // 参考 eino-examples，使用简单的 newXxx() 函数直接初始化 eino 组件
 func NewServices(repo *repository.Repositories, cfg *config.Config, redisClient *redis.Client) (*Services, error) {
@@ -55,21 +64,49 @@ func NewServices(repo *repository.Repositories, cfg *config.Config, redisClient
 	// 创建 Session 管理器
 	sessionMgr := session.NewManager(redisClient)
 
+	// 创建模型管理服务（Agent 按 ModelConfig.ModelID 解析模型）
+	modelSvc := svcModel.NewService(repo.Model)
+
 	// 创建 ChatModel
-	chatModel, err := newChatModel(ctx, cfg)
+	chatModel, err := newChatModel(ctx, cfg, modelSvc)
 	if err != nil {
 		log.Printf("Warning: failed to create chat model: %v", err)
 	}
 
-	// 初始化工具（不依赖知识库）
-	allTools := newTools(ctx, cfg, repo)
-	log.Printf("Initialized %d tools", len(allTools))
-
 	// 创建文件存储服务
 	fileSvc := newFileService(repo, cfg)
 
+	// 创建 Embedder 和 Elasticsearch 客户端（知识库索引）
+	embedder, err := newEmbedder(ctx, cfg)
+	if err != nil {
+		log.Printf("Warning: failed to create embedder: %v", err)
+	}
+	esClient, err := newESClient(cfg)
+	if err != nil {
+		log.Printf("Warning: failed to create elasticsearch client: %v", err)
+	}
+
+	// 创建知识库服务
+	knowledgeSvc := knowledge.NewService(ctx, repo, cfg, fileSvc, embedder, esClient)
+
+	// 初始化工具（含知识库检索）
+	allTools := newTools(ctx, cfg, repo, knowledgeSvc)
+	log.Printf("Initialized %d tools", len(allTools))
+
+	// 创建 MCP 服务（内部维护会话连接池）
+	mcpSvc := svcmcp.NewService(repo)
+
+	// 创建 Agent 检查点存储（工具审批中断后恢复）和会话状态（plan-execute 计划）
+	sessionCfg := session.DefaultConfig()
+	var checkpointStore compose.CheckPointStore
+	var stateMgr *session.StateManager
+	if redisClient != nil {
+		checkpointStore = session.NewRedisCheckpointStore(redisClient, checkpointTTL)
+		stateMgr = session.NewStateManager(checkpointStore, repo, redisClient, sessionCfg)
+	}
+
 	// 创建 Agent 服务（不再需要 EventBus）
-	agentSvc := agent.NewService(repo, cfg, allTools)
+	agentSvc := agent.NewService(repo, cfg, allTools, mcpSvc, modelSvc, checkpointStore, stateMgr, sessionMgr, sessionCfg)
 
 	// 创建 Chat 服务
 	chatSvc := chat.NewService(repo, chatModel)
@@ -77,8 +114,11 @@ func NewServices(repo *repository.Repositories, cfg *config.Config, redisClient
 	// 创建 Agent 服务适配器
 	agentSvcAdapter := newAgentServiceAdapter(agentSvc)
 
-	// 创建带 Agent 集成的 Chat 服务
-	chatSvcWithAgent := chat.NewServiceWithAgent(chatSvc, agentSvcAdapter)
+	// 创建 FAQ 服务（复用知识库的 Embedder 做语义匹配）
+	faqSvc := faq.NewService(repo, embedder)
+
+	// 创建带 Agent 集成的 Chat 服务（支持 FAQ 前置回答）
+	chatSvcWithAgent := chat.NewServiceWithAgent(chatSvc, agentSvcAdapter, faqSvc, sessionMgr)
 
 	return &Services{
 		Auth:           auth.NewService(repo),
@@ -86,10 +126,12 @@ func NewServices(repo *repository.Repositories, cfg *config.Config, redisClient
 		Agent:          agentSvc,
 		Tool:           tool.NewService(repo),
 		Initialization: initialization.NewService(repo, chatModel),
-		Model:          svcModel.NewService(repo.Model),
-		MCP:            svcmcp.NewService(repo),
+		Model:          modelSvc,
+		MCP:            mcpSvc,
 		Tenant:         svctenant.NewService(repo),
 		File:           fileSvc,
+		Knowledge:      knowledgeSvc,
+		FAQ:            faqSvc,
 
 		Config:     cfg,
 		SessionMgr: sessionMgr,
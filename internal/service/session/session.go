@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"log"
 	"strings"
 	"sync"
 	"time"
@@ -17,6 +18,10 @@ const (
 	sessionTTL = 24 * time.Hour
 	// Redis key 前缀
 	sessionKeyPrefix = "session:"
+	// 流事件在 Redis 中的 key 前缀（跨副本续传和停止）
+	streamKeyPrefix = "stream:"
+	// 流结束后事件的保留时间（用于断线续传）
+	streamRetention = 10 * time.Minute
 )
 
 // Manager 会话管理器（简化版）
@@ -73,7 +78,10 @@ type ActiveStream struct {
 	Done         bool
 	CreatedAt    time.Time
 	UpdatedAt    time.Time
-	partialCache []string // 部分响应缓存
+	partialCache []string          // 部分响应缓存
+	events       []json.RawMessage // 已输出的事件（按序号排列，用于续传）
+	redis        *redis.Client
+	stopSub      *redis.PubSub // 跨副本停止信号订阅
 	mu           sync.Mutex
 }
 
@@ -144,7 +152,7 @@ func (m *Manager) Append(ctx context.Context, sessionID string, msg *schema.Mess
 	if m.redis != nil {
 		if err := m.saveToRedis(ctx, sess); err != nil {
 			// 记录错误但不影响主流程
-			fmt.Printf("Warning: failed to save session to redis: %v\n", err)
+			log.Printf("Warning: failed to save session to redis: %v", err)
 		}
 	}
 
@@ -171,7 +179,7 @@ func (m *Manager) Clear(ctx context.Context, sessionID string) error {
 	if m.redis != nil {
 		key := sessionKeyPrefix + sessionID
 		if err := m.redis.Del(ctx, key).Err(); err != nil {
-			fmt.Printf("Warning: failed to delete session from redis: %v\n", err)
+			log.Printf("Warning: failed to delete session from redis: %v", err)
 		}
 	}
 
@@ -241,6 +249,7 @@ func (m *Manager) saveToRedis(ctx context.Context, sess *Session) error {
 // ========== 流控制功能 ==========
 
 // RegisterStream 注册活跃流
+// 配置 Redis 时订阅停止信号，其他副本收到的停止请求也能取消本副本上的流
 func (m *Manager) RegisterStream(sessionID, messageID string, cancelFunc context.CancelFunc) *ActiveStream {
 	m.mu.Lock()
 	defer m.mu.Unlock()
@@ -254,6 +263,23 @@ func (m *Manager) RegisterStream(sessionID, messageID string, cancelFunc context
 		CreatedAt:    time.Now(),
 		UpdatedAt:    time.Now(),
 		partialCache: make([]string, 0),
+		redis:        m.redis,
+	}
+
+	// 在 Redis 中登记流，其他副本在首个事件写入前也能找到该流
+	if m.redis != nil {
+		if err := m.redis.Set(context.Background(), streamKey(sessionID, messageID, "started"), 1, sessionTTL).Err(); err != nil {
+			log.Printf("Warning: failed to register stream in redis: %v", err)
+		}
+	}
+
+	if m.redis != nil && cancelFunc != nil {
+		stream.stopSub = m.redis.Subscribe(context.Background(), streamKey(sessionID, messageID, "stop"))
+		go func(ch <-chan *redis.Message) {
+			if _, ok := <-ch; ok {
+				cancelFunc()
+			}
+		}(stream.stopSub.Channel())
 	}
 
 	key := sessionID + ":" + messageID
@@ -262,17 +288,44 @@ func (m *Manager) RegisterStream(sessionID, messageID string, cancelFunc context
 }
 
 // UnregisterStream 注销流
+// 未完成即注销（如启动失败）的流同时撤销 Redis 中的登记
 func (m *Manager) UnregisterStream(sessionID, messageID string) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
 	key := sessionID + ":" + messageID
 	if stream, ok := m.activeStreams[key]; ok {
-		stream.Done = true
+		if !stream.IsDone() && m.redis != nil {
+			m.redis.Del(context.Background(), streamKey(sessionID, messageID, "started"))
+		}
+		stream.MarkDone()
+		stream.closeStopSub()
 		delete(m.activeStreams, key)
 	}
 }
 
+// FinishStream 标记流完成，事件保留 streamRetention 供断线续传后注销
+func (m *Manager) FinishStream(ctx context.Context, sessionID, messageID string) {
+	stream := m.GetStream(sessionID, messageID)
+	if stream == nil {
+		return
+	}
+
+	stream.MarkDone()
+	stream.closeStopSub()
+	if m.redis != nil {
+		if err := m.redis.Set(ctx, streamKey(sessionID, messageID, "done"), 1, streamRetention).Err(); err != nil {
+			log.Printf("Warning: failed to mark stream done in redis: %v", err)
+		}
+		m.redis.Expire(ctx, streamKey(sessionID, messageID, "events"), streamRetention)
+		m.redis.Expire(ctx, streamKey(sessionID, messageID, "started"), streamRetention)
+	}
+
+	time.AfterFunc(streamRetention, func() {
+		m.UnregisterStream(sessionID, messageID)
+	})
+}
+
 // GetStream 获取活跃流
 func (m *Manager) GetStream(sessionID, messageID string) *ActiveStream {
 	m.mu.RLock()
@@ -283,26 +336,180 @@ func (m *Manager) GetStream(sessionID, messageID string) *ActiveStream {
 }
 
 // StopStream 停止流
+// 流不在本副本时通过 Redis 通知持有该流的副本
 func (m *Manager) StopStream(sessionID, messageID string) bool {
 	m.mu.Lock()
-	defer m.mu.Unlock()
-
 	key := sessionID + ":" + messageID
 	stream, ok := m.activeStreams[key]
+	m.mu.Unlock()
+
 	if !ok {
+		if m.redis == nil {
+			return false
+		}
+		receivers, err := m.redis.Publish(context.Background(), streamKey(sessionID, messageID, "stop"), 1).Result()
+		return err == nil && receivers > 0
+	}
+	if stream.IsDone() {
 		return false
 	}
 
-	// 调用取消函数
+	// 调用取消函数，流在输出结束事件后由 FinishStream 标记完成
 	if stream.CancelFunc != nil {
 		stream.CancelFunc()
 	}
-
-	stream.Done = true
-	delete(m.activeStreams, key)
 	return true
 }
 
+// ReleaseSession 停止会话的所有流并删除会话在内存和 Redis 中的数据（删除会话时调用）
+// 其他副本上的流通过 Redis 中的登记 key 找到消息 ID 后发送停止信号
+func (m *Manager) ReleaseSession(ctx context.Context, sessionID string) {
+	prefix := sessionID + ":"
+	var running []*ActiveStream
+	m.mu.Lock()
+	for key, stream := range m.activeStreams {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		if stream.IsDone() {
+			stream.closeStopSub()
+			delete(m.activeStreams, key)
+			continue
+		}
+		running = append(running, stream)
+	}
+	m.mu.Unlock()
+
+	// 运行中的流取消后由 FinishStream 标记完成并在保留期后注销
+	for _, stream := range running {
+		if stream.CancelFunc != nil {
+			stream.CancelFunc()
+		}
+	}
+
+	if m.redis != nil {
+		keyPrefix := streamKeyPrefix + prefix
+		var keys []string
+		stopped := make(map[string]bool)
+		iter := m.redis.Scan(ctx, 0, keyPrefix+"*", 100).Iterator()
+		for iter.Next(ctx) {
+			key := iter.Val()
+			keys = append(keys, key)
+			messageID, ok := strings.CutSuffix(strings.TrimPrefix(key, keyPrefix), ":started")
+			if !ok {
+				messageID, ok = strings.CutSuffix(strings.TrimPrefix(key, keyPrefix), ":events")
+			}
+			if ok && !stopped[messageID] {
+				stopped[messageID] = true
+				m.redis.Publish(ctx, streamKey(sessionID, messageID, "stop"), 1)
+			}
+		}
+		if err := iter.Err(); err != nil {
+			log.Printf("Warning: failed to scan session streams in redis: %v", err)
+		}
+		if len(keys) > 0 {
+			if err := m.redis.Del(ctx, keys...).Err(); err != nil {
+				log.Printf("Warning: failed to delete session streams from redis: %v", err)
+			}
+		}
+	}
+
+	_ = m.Clear(ctx, sessionID)
+}
+
+// ReadEvents 读取流从 offset 开始的事件
+// 本副本没有该流时从 Redis 读取；found 为 false 表示流不存在或已过期
+func (m *Manager) ReadEvents(ctx context.Context, sessionID, messageID string, offset int) (events []json.RawMessage, done, found bool, err error) {
+	if offset < 0 {
+		offset = 0
+	}
+
+	if stream := m.GetStream(sessionID, messageID); stream != nil {
+		events, done = stream.EventsFrom(offset)
+		return events, done, true, nil
+	}
+	if m.redis == nil {
+		return nil, false, false, nil
+	}
+
+	// 流注册时即登记 started key，尚未写入事件的流也视为存在
+	eventsKey := streamKey(sessionID, messageID, "events")
+	exists, err := m.redis.Exists(ctx, streamKey(sessionID, messageID, "started"), eventsKey).Result()
+	if err != nil {
+		return nil, false, false, fmt.Errorf("failed to check stream: %w", err)
+	}
+	if exists == 0 {
+		return nil, false, false, nil
+	}
+
+	values, err := m.redis.LRange(ctx, eventsKey, int64(offset), -1).Result()
+	if err != nil {
+		return nil, false, false, fmt.Errorf("failed to read stream events: %w", err)
+	}
+	for _, v := range values {
+		events = append(events, json.RawMessage(v))
+	}
+
+	n, err := m.redis.Exists(ctx, streamKey(sessionID, messageID, "done")).Result()
+	if err != nil {
+		return nil, false, false, fmt.Errorf("failed to check stream state: %w", err)
+	}
+	return events, n > 0, true, nil
+}
+
+// streamKey 流在 Redis 中的 key
+func streamKey(sessionID, messageID, suffix string) string {
+	return fmt.Sprintf("%s%s:%s:%s", streamKeyPrefix, sessionID, messageID, suffix)
+}
+
+// AppendEvent 记录流事件（调用方按顺序单协程写入），配置 Redis 时同步写入供其他副本续传
+func (s *ActiveStream) AppendEvent(ctx context.Context, event json.RawMessage) {
+	s.mu.Lock()
+	s.events = append(s.events, event)
+	s.UpdatedAt = time.Now()
+	s.mu.Unlock()
+
+	if s.redis == nil {
+		return
+	}
+	key := streamKey(s.SessionID, s.MessageID, "events")
+	pipe := s.redis.Pipeline()
+	pipe.RPush(ctx, key, []byte(event))
+	pipe.Expire(ctx, key, sessionTTL)
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Printf("Warning: failed to save stream event to redis: %v", err)
+	}
+}
+
+// EventCount 已记录的事件数（即下一个事件的序号）
+func (s *ActiveStream) EventCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.events)
+}
+
+// EventsFrom 获取从 offset 开始的事件，以及流是否已完成
+func (s *ActiveStream) EventsFrom(offset int) ([]json.RawMessage, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if offset >= len(s.events) {
+		return nil, s.Done
+	}
+	return append([]json.RawMessage{}, s.events[offset:]...), s.Done
+}
+
+// closeStopSub 取消停止信号订阅
+func (s *ActiveStream) closeStopSub() {
+	s.mu.Lock()
+	sub := s.stopSub
+	s.stopSub = nil
+	s.mu.Unlock()
+
+	if sub != nil {
+		_ = sub.Close()
+	}
+}
+
 // AppendStreamContent 追加流内容
 func (s *ActiveStream) AppendChunk(chunk string) {
 	s.mu.Lock()
@@ -10,6 +10,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/ashwinyue/next-ai/internal/model"
 	"github.com/ashwinyue/next-ai/internal/repository"
 	"github.com/cloudwego/eino/compose"
 	"github.com/cloudwego/eino/schema"
@@ -178,6 +179,31 @@ func (m *StateManager) AppendMessages(ctx context.Context, sessionID string, mes
 	return m.SaveState(ctx, state)
 }
 
+// SetMetadata 设置会话元数据
+func (m *StateManager) SetMetadata(ctx context.Context, sessionID, key string, value any) error {
+	state, err := m.LoadState(ctx, sessionID)
+	if err != nil {
+		return err
+	}
+
+	if state.Metadata == nil {
+		state.Metadata = make(map[string]any)
+	}
+	state.Metadata[key] = value
+	return m.SaveState(ctx, state)
+}
+
+// GetMetadata 获取会话元数据
+func (m *StateManager) GetMetadata(ctx context.Context, sessionID, key string) (any, bool, error) {
+	state, err := m.LoadState(ctx, sessionID)
+	if err != nil {
+		return nil, false, err
+	}
+
+	value, ok := state.Metadata[key]
+	return value, ok, nil
+}
+
 // ClearHistory 清空历史
 func (m *StateManager) ClearHistory(ctx context.Context, sessionID string) error {
 	m.mu.Lock()
@@ -218,8 +244,12 @@ func (m *StateManager) UpdateConfig(config *Config) {
 
 // buildStateFromDB 从数据库构建状态（回退方案）
 func (m *StateManager) buildStateFromDB(ctx context.Context, sessionID string) (*State, error) {
-	// 从 repository 获取消息
-	messages, err := m.messageRepo.Chat.GetMessagesBySessionID(sessionID)
+	// 从 repository 获取当前分支的消息
+	leafID, err := m.messageRepo.Chat.ResolveActiveLeaf(sessionID)
+	var messages []*model.ChatMessage
+	if err == nil {
+		messages, err = m.messageRepo.Chat.GetMessagePath(sessionID, leafID)
+	}
 	if err != nil {
 		// 返回空状态而不是错误
 		return &State{
@@ -304,3 +334,20 @@ func (s *RedisCheckpointStore) Set(ctx context.Context, key string, value []byte
 	}
 	return s.client.Set(ctx, key, value, s.ttl).Err()
 }
+
+// Take 原子地读取并删除 key（GETDEL），并发调用时只有一个能取到值
+func (s *RedisCheckpointStore) Take(ctx context.Context, key string) ([]byte, bool, error) {
+	val, err := s.client.GetDel(ctx, key).Result()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, false, nil
+		}
+		return nil, false, err
+	}
+
+	if val == "" {
+		return nil, false, nil
+	}
+
+	return []byte(val), true, nil
+}
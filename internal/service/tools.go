@@ -7,6 +7,7 @@ import (
 
 	"github.com/ashwinyue/next-ai/internal/config"
 	"github.com/ashwinyue/next-ai/internal/repository"
+	"github.com/ashwinyue/next-ai/internal/service/knowledge"
 	"github.com/cloudwego/eino-ext/components/tool/duckduckgo/v2"
 	httptool "github.com/cloudwego/eino-ext/components/tool/httprequest"
 	sequencethinking "github.com/cloudwego/eino-ext/components/tool/sequentialthinking"
@@ -67,13 +68,16 @@ func newWebSearchTool(ctx context.Context) tool.InvokableTool {
 	return searchTool
 }
 
-// newTools 初始化所有工具（仅通用工具，不依赖知识库）
-func newTools(ctx context.Context, cfg *config.Config, repo *repository.Repositories) []tool.BaseTool {
+// newTools 初始化所有工具
+func newTools(ctx context.Context, cfg *config.Config, repo *repository.Repositories, knowledgeSvc *knowledge.Service) []tool.BaseTool {
 	tools := []tool.BaseTool{}
 
 	// 添加网络搜索工具 (eino-ext duckduckgo)
 	tools = append(tools, newWebSearchTool(ctx))
 
+	// 添加知识库检索工具（检索范围由 Agent 绑定的知识库决定）
+	tools = append(tools, knowledge.NewSearchTool(knowledgeSvc))
+
 	// 添加 HTTP 请求工具 (eino-ext httprequest)
 	httpTools, err := httptool.NewToolKit(ctx, &httptool.Config{})
 	if err != nil {
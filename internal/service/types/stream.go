@@ -0,0 +1,39 @@
+package types
+
+// 流式事件类型（同时作为 SSE 的 event 名称）
+const (
+	EventStreamStart      = "stream_start"      // 流开始，公布本次回复的 message_id（用于停止和续传）
+	EventStart            = "start"             // 开始输出助手回复（每次运行一次）
+	EventMessage          = "message"           // 助手消息内容增量
+	EventReasoning        = "reasoning"         // 思考过程增量
+	EventToolCallStart    = "tool_call_start"   // 模型发起工具调用（名称和参数）
+	EventToolResult       = "tool_result"       // 工具执行结果
+	EventTransfer         = "transfer"          // 转交给其他 Agent
+	EventPlanUpdate       = "plan_update"       // plan-execute 计划更新
+	EventApprovalRequired = "approval_required" // 工具调用等待审批
+	EventUsage            = "usage"             // token 用量
+	EventFAQ              = "faq"               // FAQ 命中
+	EventError            = "error"             // 错误
+	EventEnd              = "end"               // 运行结束
+)
+
+// StreamEvent Agent 聊天流式事件（agent 和 chat 共用）
+type StreamEvent struct {
+	Seq        int         `json:"seq"` // 事件序号（SSE id），续传时从该序号之后重放
+	Type       string      `json:"type"`
+	MessageID  string      `json:"message_id,omitempty"` // 本次回复的消息 ID
+	Data       string      `json:"data,omitempty"`
+	ToolCallID string      `json:"tool_call_id,omitempty"`
+	ToolName   string      `json:"tool_name,omitempty"`
+	Arguments  string      `json:"arguments,omitempty"`  // tool_call_start 的调用参数（JSON）
+	AgentName  string      `json:"agent_name,omitempty"` // 产生事件的 Agent（supervisor 模式下区分子 Agent）
+	Model      string      `json:"model,omitempty"`      // 实际应答的模型（end 事件）
+	Usage      *TokenUsage `json:"usage,omitempty"`
+}
+
+// TokenUsage token 用量
+type TokenUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}